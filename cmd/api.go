@@ -0,0 +1,437 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// apiSnapshotVersion is the format version of api snapshot files. Bump it
+// when apiSymbol or the snapshot layout changes.
+const apiSnapshotVersion = 1
+
+var apiCmd = &cobra.Command{
+	Use:   "api",
+	Short: "Record and check the exported API of a module",
+	Long: `Record the exported surface of a module in a snapshot file that can be
+committed, and check the current code against it, for example in CI.`,
+}
+
+var apiSnapshotCmd = &cobra.Command{
+	Use:   "snapshot [dir]",
+	Short: "Print a sorted, versioned snapshot of the module's exported API",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runAPISnapshotCmd,
+}
+
+var apiCheckCmd = &cobra.Command{
+	Use:   "check <snapshot.json> [dir]",
+	Short: "Compare the module's exported API with a snapshot and fail on differences",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE:  runAPICheckCmd,
+}
+
+func init() {
+	apiCmd.AddCommand(apiSnapshotCmd, apiCheckCmd)
+	rootCmd.AddCommand(apiCmd)
+}
+
+// apiSymbol is one element of a module's exported surface.
+type apiSymbol struct {
+	Package   string // package directory relative to the module root, "." for the root
+	Name      string // F, T, T.Field or T.Method
+	Kind      string // func, method, type, field, embedded field, interface method, embedded interface, const or var
+	Signature string
+}
+
+// ID identifies the symbol across two versions of the same module. It is a
+// map key; use displayName to show the symbol.
+func (s apiSymbol) ID() string {
+	return s.Package + "." + s.Name
+}
+
+// displayName is the symbol as reports show it: qualified by its package
+// directory, or bare in the module's root package.
+func (s apiSymbol) displayName() string {
+	if s.Package == "." {
+		return s.Name
+	}
+	return s.Package + "." + s.Name
+}
+
+// apiSurface is the exported surface of a module, keyed by symbol ID.
+type apiSurface struct {
+	Module  string
+	Version string // the semver tag of a git revision, if it has one
+	Symbols map[string]apiSymbol
+}
+
+// apiSnapshot is the serialized form of an apiSurface. Symbols are sorted by
+// ID so that snapshots diff cleanly in review.
+type apiSnapshot struct {
+	SchemaVersion int
+	Module        string
+	Symbols       []apiSymbol
+}
+
+func newAPISurface(module string) *apiSurface {
+	return &apiSurface{Module: module, Symbols: make(map[string]apiSymbol)}
+}
+
+func (s *apiSurface) add(symbol apiSymbol) {
+	s.Symbols[symbol.ID()] = symbol
+}
+
+// snapshot returns the surface in its stable, sorted serialized form.
+func (s *apiSurface) snapshot() *apiSnapshot {
+	snapshot := &apiSnapshot{SchemaVersion: apiSnapshotVersion, Module: s.Module, Symbols: []apiSymbol{}}
+	for _, symbol := range s.Symbols {
+		snapshot.Symbols = append(snapshot.Symbols, symbol)
+	}
+	sort.Slice(snapshot.Symbols, func(i, j int) bool {
+		return snapshot.Symbols[i].ID() < snapshot.Symbols[j].ID()
+	})
+	return snapshot
+}
+
+// readAPISnapshot parses a snapshot written by "api snapshot". It reports
+// false when data is not a snapshot, such as saved describe output.
+func readAPISnapshot(data []byte) (*apiSurface, bool, error) {
+	var snapshot apiSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil || snapshot.Symbols == nil {
+		return nil, false, nil
+	}
+	if snapshot.SchemaVersion != apiSnapshotVersion {
+		return nil, true, fmt.Errorf("unsupported snapshot version %d, expected %d", snapshot.SchemaVersion, apiSnapshotVersion)
+	}
+
+	surface := newAPISurface(snapshot.Module)
+	for _, symbol := range snapshot.Symbols {
+		surface.add(symbol)
+	}
+	return surface, true, nil
+}
+
+// extractAPI walks the module containing root and collects the exported
+// surface of every importable package. Test files, main packages and
+// internal packages are not part of the surface.
+func extractAPI(root string) (*apiSurface, error) {
+	moduleRoot := root
+	module := ""
+	if goModPath, err := findGoMod(root); err == nil {
+		moduleRoot = filepath.Dir(goModPath)
+		module, _, err = readGoModFile(goModPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	surface := newAPISurface(module)
+	// Generated code is part of the API its package exports.
+	opts := walkOptions{IncludeGenerated: true}
+	err := walkGoFiles(moduleRoot, opts, func(filePath string, info os.FileInfo) error {
+		rel, err := filepath.Rel(moduleRoot, filepath.Dir(filePath))
+		if err != nil {
+			return err
+		}
+		pkg := filepath.ToSlash(rel)
+		if isInternalPackage(pkg) {
+			return nil
+		}
+
+		node, err := parseFile(filePath)
+		if err != nil {
+			return fmt.Errorf("error parsing %s: %v", filePath, err)
+		}
+		if node.Name.Name == "main" {
+			return nil
+		}
+		addFileAPI(surface, pkg, node)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return surface, nil
+}
+
+func isInternalPackage(pkg string) bool {
+	for _, elem := range strings.Split(pkg, "/") {
+		if elem == "internal" {
+			return true
+		}
+	}
+	return false
+}
+
+// addFileAPI adds the exported declarations of one file to the surface.
+func addFileAPI(surface *apiSurface, pkg string, node *ast.File) {
+	for _, decl := range node.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() {
+				continue
+			}
+			if d.Recv == nil {
+				surface.add(apiSymbol{Package: pkg, Name: d.Name.Name, Kind: "func", Signature: funcTypeSignature(d.Type)})
+				continue
+			}
+			recv := receiverTypeName(d.Recv.List[0].Type)
+			if !ast.IsExported(recv) {
+				continue
+			}
+			surface.add(apiSymbol{Package: pkg, Name: recv + "." + d.Name.Name, Kind: "method", Signature: funcTypeSignature(d.Type)})
+		case *ast.GenDecl:
+			addGenDeclAPI(surface, pkg, d)
+		}
+	}
+}
+
+func addGenDeclAPI(surface *apiSurface, pkg string, d *ast.GenDecl) {
+	var constType string
+	for _, spec := range d.Specs {
+		switch s := spec.(type) {
+		case *ast.TypeSpec:
+			if s.Name.IsExported() {
+				addTypeAPI(surface, pkg, s)
+			}
+		case *ast.ValueSpec:
+			kind := "var"
+			if d.Tok == token.CONST {
+				kind = "const"
+			}
+			typ := ""
+			if s.Type != nil {
+				typ = types.ExprString(s.Type)
+			}
+			// Constants without a type or value repeat the previous spec,
+			// as in iota sequences.
+			if d.Tok == token.CONST {
+				if s.Type == nil && len(s.Values) == 0 {
+					typ = constType
+				}
+				constType = typ
+			}
+			if typ == "" {
+				typ = "untyped"
+			}
+			for _, name := range s.Names {
+				if name.IsExported() {
+					surface.add(apiSymbol{Package: pkg, Name: name.Name, Kind: kind, Signature: typ})
+				}
+			}
+		}
+	}
+}
+
+func addTypeAPI(surface *apiSurface, pkg string, s *ast.TypeSpec) {
+	typeParams := ""
+	if s.TypeParams != nil {
+		typeParams = "[" + fieldListTypes(s.TypeParams, true) + "] "
+	}
+
+	switch t := s.Type.(type) {
+	case *ast.StructType:
+		surface.add(apiSymbol{Package: pkg, Name: s.Name.Name, Kind: "type", Signature: typeParams + "struct"})
+		for _, field := range t.Fields.List {
+			typ := types.ExprString(field.Type)
+			if len(field.Names) == 0 {
+				name := receiverTypeName(field.Type)
+				if ast.IsExported(name) {
+					surface.add(apiSymbol{Package: pkg, Name: s.Name.Name + "." + name, Kind: "embedded field", Signature: typ})
+				}
+				continue
+			}
+			for _, name := range field.Names {
+				if name.IsExported() {
+					surface.add(apiSymbol{Package: pkg, Name: s.Name.Name + "." + name.Name, Kind: "field", Signature: typ})
+				}
+			}
+		}
+	case *ast.InterfaceType:
+		surface.add(apiSymbol{Package: pkg, Name: s.Name.Name, Kind: "type", Signature: typeParams + "interface"})
+		for _, method := range t.Methods.List {
+			if len(method.Names) == 0 {
+				typ := types.ExprString(method.Type)
+				surface.add(apiSymbol{Package: pkg, Name: s.Name.Name + "." + typ, Kind: "embedded interface", Signature: typ})
+				continue
+			}
+			if ft, ok := method.Type.(*ast.FuncType); ok && method.Names[0].IsExported() {
+				surface.add(apiSymbol{Package: pkg, Name: s.Name.Name + "." + method.Names[0].Name, Kind: "interface method", Signature: funcTypeSignature(ft)})
+			}
+		}
+	default:
+		sig := typeParams + types.ExprString(s.Type)
+		if s.Assign.IsValid() {
+			sig = "= " + sig
+		}
+		surface.add(apiSymbol{Package: pkg, Name: s.Name.Name, Kind: "type", Signature: sig})
+	}
+}
+
+// receiverTypeName returns the base type name of a receiver or embedded
+// field, without pointers, package qualifiers or type arguments.
+func receiverTypeName(expr ast.Expr) string {
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.IndexExpr:
+			expr = t.X
+		case *ast.IndexListExpr:
+			expr = t.X
+		case *ast.SelectorExpr:
+			return t.Sel.Name
+		case *ast.Ident:
+			return t.Name
+		default:
+			return types.ExprString(expr)
+		}
+	}
+}
+
+// funcTypeSignature renders a function type with parameter names dropped, so
+// that renaming a parameter does not register as an API change.
+func funcTypeSignature(ft *ast.FuncType) string {
+	sig := "func"
+	if ft.TypeParams != nil {
+		sig += "[" + fieldListTypes(ft.TypeParams, true) + "]"
+	}
+	sig += "(" + fieldListTypes(ft.Params, false) + ")"
+	if ft.Results != nil && len(ft.Results.List) > 0 {
+		results := fieldListTypes(ft.Results, false)
+		if len(ft.Results.List) == 1 && len(ft.Results.List[0].Names) <= 1 {
+			sig += " " + results
+		} else {
+			sig += " (" + results + ")"
+		}
+	}
+	return sig
+}
+
+// fieldListTypes lists the types of a field list, repeating the type for
+// every name it declares. Type parameter lists keep their names since they
+// are referenced by the rest of the signature.
+func fieldListTypes(list *ast.FieldList, keepNames bool) string {
+	if list == nil {
+		return ""
+	}
+	var parts []string
+	for _, field := range list.List {
+		typ := types.ExprString(field.Type)
+		if len(field.Names) == 0 {
+			parts = append(parts, typ)
+			continue
+		}
+		for _, name := range field.Names {
+			if keepNames {
+				parts = append(parts, name.Name+" "+typ)
+			} else {
+				parts = append(parts, typ)
+			}
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// packageOf returns the module-relative package directory of a file path.
+func packageOf(filePath string) string {
+	dir := path.Clean(filepath.ToSlash(filepath.Dir(filePath)))
+	return strings.TrimPrefix(dir, "./")
+}
+
+// writeAPIReport writes a human-readable summary of API changes.
+func writeAPIReport(w io.Writer, changes []apiChange) {
+	var breaking, compatible []apiChange
+	for _, change := range changes {
+		if change.Breaking {
+			breaking = append(breaking, change)
+		} else {
+			compatible = append(compatible, change)
+		}
+	}
+
+	for _, group := range []struct {
+		title   string
+		changes []apiChange
+	}{
+		{"Breaking changes", breaking},
+		{"Compatible changes", compatible},
+	} {
+		if len(group.changes) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s:\n", group.title)
+		for _, change := range group.changes {
+			switch change.Change {
+			case "added":
+				fmt.Fprintf(w, "  + %s: %s (%s)\n", change.Symbol.displayName(), change.New, change.Reason)
+			case "removed":
+				fmt.Fprintf(w, "  - %s: %s (%s)\n", change.Symbol.displayName(), change.Old, change.Reason)
+			default:
+				fmt.Fprintf(w, "  ~ %s: %s -> %s (%s)\n", change.Symbol.displayName(), change.Old, change.New, change.Reason)
+			}
+		}
+	}
+}
+
+func runAPISnapshotCmd(cmd *cobra.Command, args []string) error {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+
+	surface, err := extractAPI(dir)
+	if err != nil {
+		return fmt.Errorf("extracting API: %w", err)
+	}
+
+	jsonSnapshot, _ := json.MarshalIndent(surface.snapshot(), "", "  ")
+	fmt.Println(string(jsonSnapshot))
+	return nil
+}
+
+func runAPICheckCmd(cmd *cobra.Command, args []string) error {
+	dir := "."
+	if len(args) > 1 {
+		dir = args[1]
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+	recorded, ok, err := readAPISnapshot(data)
+	if !ok && err == nil {
+		err = fmt.Errorf("%s is not an api snapshot", args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+
+	current, err := extractAPI(dir)
+	if err != nil {
+		return fmt.Errorf("extracting API: %w", err)
+	}
+
+	changes := diffAPI(recorded, current)
+	if len(changes) == 0 {
+		fmt.Println("API matches", args[0])
+		return nil
+	}
+
+	fmt.Printf("API differs from %s:\n\n", args[0])
+	writeAPIReport(os.Stdout, changes)
+	fmt.Printf("\nRun \"gosymex api snapshot > %s\" to accept these changes.\n", args[0])
+	return withExitCode(exitFailure, fmt.Errorf("API differs from %s: %d changes", args[0], len(changes)))
+}
@@ -0,0 +1,403 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"golang.org/x/mod/semver"
+)
+
+var apidiffCmd = &cobra.Command{
+	Use:   "apidiff <old> <new>",
+	Short: "Compare the exported API of two versions of a module",
+	Long: `Compare the exported types, fields, methods, funcs, consts and interfaces of
+two versions of a module and classify each change as compatible or breaking.
+
+Each side can be a directory, an api snapshot, a saved describe JSON output,
+or a git revision of the local repository.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runAPIDiffCmd,
+}
+
+func init() {
+	rootCmd.AddCommand(apidiffCmd)
+}
+
+// apiChange is a single difference between two API surfaces.
+type apiChange struct {
+	Symbol   apiSymbol
+	Change   string // added, removed or changed
+	Breaking bool
+	Reason   string
+	Old      string
+	New      string
+}
+
+// diffAPI compares two surfaces and returns the changes, breaking ones first.
+func diffAPI(old, newSide *apiSurface) []apiChange {
+	var changes []apiChange
+	for id, symbol := range newSide.Symbols {
+		prev, ok := old.Symbols[id]
+		switch {
+		case !ok:
+			// Adding a method to an interface breaks every implementation
+			// outside the module.
+			breaking := symbol.Kind == "interface method" || symbol.Kind == "embedded interface"
+			changes = append(changes, apiChange{Symbol: symbol, Change: "added", Breaking: breaking, Reason: "added " + symbol.Kind, New: symbol.Signature})
+		case prev.Kind != symbol.Kind:
+			changes = append(changes, apiChange{Symbol: symbol, Change: "changed", Breaking: true, Reason: fmt.Sprintf("changed from %s to %s", prev.Kind, symbol.Kind), Old: prev.Signature, New: symbol.Signature})
+		case prev.Signature != symbol.Signature:
+			changes = append(changes, apiChange{Symbol: symbol, Change: "changed", Breaking: true, Reason: changeReason(symbol.Kind), Old: prev.Signature, New: symbol.Signature})
+		}
+	}
+	for id, symbol := range old.Symbols {
+		if _, ok := newSide.Symbols[id]; !ok {
+			changes = append(changes, apiChange{Symbol: symbol, Change: "removed", Breaking: true, Reason: "removed " + symbol.Kind, Old: symbol.Signature})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Breaking != changes[j].Breaking {
+			return changes[i].Breaking
+		}
+		return changes[i].Symbol.ID() < changes[j].Symbol.ID()
+	})
+	return changes
+}
+
+func changeReason(kind string) string {
+	switch kind {
+	case "func", "method", "interface method":
+		return "changed " + kind + " signature"
+	case "type":
+		return "changed type definition"
+	default:
+		return "changed " + kind + " type"
+	}
+}
+
+var majorSuffix = regexp.MustCompile(`/v([0-9]+)$`)
+
+// recommendBump returns the semver bump required by the given changes for a
+// module at modulePath whose old side is at baseVersion, "" when unknown.
+func recommendBump(modulePath, baseVersion string, changes []apiChange) string {
+	breaking, added := false, false
+	for _, change := range changes {
+		breaking = breaking || change.Breaking
+		added = added || change.Change == "added"
+	}
+
+	switch {
+	case breaking && semver.Major(baseVersion) == "v0":
+		return fmt.Sprintf("minor (breaking changes, allowed in a minor bump while the module is at %s)", baseVersion)
+	case breaking:
+		if modulePath == "" {
+			return "major (breaking changes)"
+		}
+		m := majorSuffix.FindStringSubmatch(modulePath)
+		if m == nil {
+			return fmt.Sprintf("major: the module path becomes %s/v2", modulePath)
+		}
+		major, _ := strconv.Atoi(m[1])
+		return fmt.Sprintf("major: the module path becomes %s/v%d", strings.TrimSuffix(modulePath, m[0]), major+1)
+	case added:
+		return "minor (compatible additions only)"
+	default:
+		return "patch (no exported API changes)"
+	}
+}
+
+// loadAPISide resolves one argument of apidiff to an API surface.
+func loadAPISide(arg string) (*apiSurface, error) {
+	info, err := os.Stat(arg)
+	switch {
+	case err == nil && info.IsDir():
+		return extractAPI(arg)
+	case err == nil:
+		return loadAPIFile(arg)
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	if exec.Command("git", "rev-parse", "--verify", "--quiet", arg+"^{commit}").Run() != nil {
+		return nil, fmt.Errorf("'%s' is neither a path nor a git revision", arg)
+	}
+	return loadGitRevisionAPI(arg)
+}
+
+// loadAPIFile reads either an api snapshot or saved describe output.
+func loadAPIFile(filePath string) (*apiSurface, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if surface, ok, err := readAPISnapshot(data); ok {
+		return surface, err
+	}
+	return loadDescribeSnapshot(filePath, data)
+}
+
+// loadDescribeSnapshot reads the output of describe and converts it to an API
+// surface. Both the envelope and the bare FileDetails documents written by
+// earlier releases are accepted. Constants and variables are not part of
+// describe output and are therefore absent.
+func loadDescribeSnapshot(filePath string, data []byte) (*apiSurface, error) {
+	surface := newAPISurface("")
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc struct {
+			FileDetails
+			Files []*FileDetails
+		}
+		if err := decoder.Decode(&doc); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading describe snapshot %s: %v", filePath, err)
+		}
+		files := doc.Files
+		if files == nil {
+			files = []*FileDetails{&doc.FileDetails}
+		}
+		for _, details := range files {
+			if strings.HasSuffix(details.FilePath, "_test.go") {
+				continue
+			}
+			addDetailsAPI(surface, packageOf(details.FilePath), details)
+		}
+	}
+	return surface, nil
+}
+
+// addDetailsAPI adds the exported symbols of a describe result to the surface.
+func addDetailsAPI(surface *apiSurface, pkg string, details *FileDetails) {
+	for name, fields := range details.Structs {
+		if !ast.IsExported(name) {
+			continue
+		}
+		surface.add(apiSymbol{Package: pkg, Name: name, Kind: "type", Signature: "struct"})
+		for _, field := range fields {
+			fieldName, typ, _ := strings.Cut(field, " ")
+			if ast.IsExported(fieldName) {
+				surface.add(apiSymbol{Package: pkg, Name: name + "." + fieldName, Kind: "field", Signature: typ})
+			}
+		}
+	}
+	for name, methods := range details.Interfaces {
+		if !ast.IsExported(name) {
+			continue
+		}
+		surface.add(apiSymbol{Package: pkg, Name: name, Kind: "type", Signature: "interface"})
+		for _, method := range methods {
+			methodName, typ, _ := strings.Cut(method, " ")
+			if ast.IsExported(methodName) {
+				surface.add(apiSymbol{Package: pkg, Name: name + "." + methodName, Kind: "interface method", Signature: normalizeFuncType(typ)})
+			}
+		}
+	}
+	for _, sig := range details.Funcs {
+		key := funcKey(sig)
+		funcType := funcSigType(sig)
+
+		name := key
+		kind := "func"
+		if recv, ok := funcReceiverType(sig); ok {
+			if !ast.IsExported(recv) {
+				continue
+			}
+			_, method, _ := strings.Cut(key, ").")
+			name, kind = recv+"."+method, "method"
+		}
+		if ast.IsExported(name[strings.LastIndex(name, ".")+1:]) {
+			surface.add(apiSymbol{Package: pkg, Name: name, Kind: kind, Signature: funcType})
+		}
+	}
+}
+
+// funcSigType turns a signature rendered by handleFuncDecl into a func type
+// without parameter names, such as "func(int) bool".
+func funcSigType(sig string) string {
+	// describe renders results as "returns (...)"; turn the rest of the
+	// signature back into a func type so parameter names can be dropped.
+	return normalizeFuncType("func" + strings.Replace(sig[len(funcKey(sig)):], " returns ", " ", 1))
+}
+
+// normalizeFuncType reparses a func type expression and renders it without
+// parameter names. Unparseable input is returned unchanged.
+func normalizeFuncType(expr string) string {
+	parsed, err := parser.ParseExpr(expr)
+	if err != nil {
+		return expr
+	}
+	if ft, ok := parsed.(*ast.FuncType); ok {
+		return funcTypeSignature(ft)
+	}
+	return expr
+}
+
+// loadGitRevisionAPI exports the module at the given revision of the local
+// repository into a temporary directory and extracts its API.
+func loadGitRevisionAPI(rev string) (*apiSurface, error) {
+	topLevel, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error locating git repository: %v", err)
+	}
+
+	// Extract the module the current directory belongs to, wherever it
+	// lives inside the repository.
+	moduleDir := "."
+	if goModPath, err := findGoMod("."); err == nil {
+		if rel, err := filepath.Rel(strings.TrimSpace(string(topLevel)), filepath.Dir(goModPath)); err == nil && !strings.HasPrefix(rel, "..") {
+			moduleDir = rel
+		}
+	}
+
+	tmp, err := os.MkdirTemp("", "gosymex-apidiff-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := exportGitTree(strings.TrimSpace(string(topLevel)), rev, tmp); err != nil {
+		return nil, err
+	}
+	surface, err := extractAPI(filepath.Join(tmp, moduleDir))
+	if err != nil {
+		return nil, err
+	}
+	surface.Version = gitTagVersion(rev)
+	return surface, nil
+}
+
+// gitTagVersion returns the semver tag rev is at or descends from, or ""
+// when there is none.
+func gitTagVersion(rev string) string {
+	tag, err := exec.Command("git", "describe", "--tags", "--abbrev=0", "--match", "v[0-9]*", rev).Output()
+	if err != nil {
+		return ""
+	}
+	version := strings.TrimSpace(string(tag))
+	if !semver.IsValid(version) {
+		return ""
+	}
+	return version
+}
+
+// exportGitTree writes the Go sources and go.mod files of rev into dest.
+func exportGitTree(repo, rev, dest string) (err error) {
+	archive := exec.Command("git", "-C", repo, "archive", "--format=tar", rev)
+	stdout, err := archive.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := archive.Start(); err != nil {
+		return fmt.Errorf("error running git archive: %v", err)
+	}
+	// Wait on every return, so git is reaped even when reading stops early;
+	// closing the pipe first keeps it from blocking on unread output.
+	defer func() {
+		if err != nil {
+			stdout.Close()
+		}
+		if waitErr := archive.Wait(); err == nil && waitErr != nil {
+			err = fmt.Errorf("error running git archive: %v", waitErr)
+		}
+	}()
+
+	reader := tar.NewReader(stdout)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading git archive: %v", err)
+		}
+		if header.Typeflag != tar.TypeReg || (filepath.Ext(header.Name) != ".go" && filepath.Base(header.Name) != "go.mod") {
+			continue
+		}
+
+		target := filepath.Join(dest, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dest)+string(os.PathSeparator)) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		file, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(file, reader)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printAPIChanges(changes []apiChange) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleLight)
+
+	t.AppendHeader(table.Row{"#", "Change", "Symbol", "Reason", "Old", "New", "Breaking"})
+	for i, change := range changes {
+		breaking := ""
+		if change.Breaking {
+			breaking = "yes"
+		}
+		t.AppendRow(table.Row{i + 1, change.Change, change.Symbol.displayName(), change.Reason, change.Old, change.New, breaking})
+	}
+
+	t.Render()
+}
+
+func runAPIDiffCmd(cmd *cobra.Command, args []string) error {
+	old, err := loadAPISide(args[0])
+	if err != nil {
+		return fmt.Errorf("loading old API: %w", err)
+	}
+	newSide, err := loadAPISide(args[1])
+	if err != nil {
+		return fmt.Errorf("loading new API: %w", err)
+	}
+
+	modulePath := newSide.Module
+	if modulePath == "" {
+		modulePath = old.Module
+	}
+	if modulePath == "" {
+		modulePath, _, _ = detectGoProject(".")
+	}
+
+	changes := diffAPI(old, newSide)
+	if len(changes) > 0 {
+		printAPIChanges(changes)
+	}
+
+	breaking := 0
+	for _, change := range changes {
+		if change.Breaking {
+			breaking++
+		}
+	}
+	fmt.Printf("%d changes, %d breaking\n", len(changes), breaking)
+	fmt.Printf("Recommended version bump for %s: %s\n", modulePath, recommendBump(modulePath, old.Version, changes))
+	return nil
+}
@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+// surfaceFromSource extracts the API of a single-file package.
+func surfaceFromSource(t *testing.T, src string) *apiSurface {
+	t.Helper()
+	node, err := parser.ParseFile(token.NewFileSet(), "a.go", src, parser.SkipObjectResolution)
+	if err != nil {
+		t.Fatalf("Failed to parse source: %v", err)
+	}
+	surface := newAPISurface("example.com/m")
+	addFileAPI(surface, "pkg", node)
+	return surface
+}
+
+func TestAddFileAPI(t *testing.T) {
+	surface := surfaceFromSource(t, `package pkg
+
+const (
+	A Kind = iota
+	B
+)
+
+type Kind int
+
+type Reader interface {
+	Read(p []byte) (n int, err error)
+	io.Closer
+}
+
+type S struct {
+	X, Y int
+	hidden string
+	Embedded
+}
+
+func (s *S) Do(a, b int) error { return nil }
+func (s *S) private() {}
+func F(name string, opts ...int) {}
+func unexported() {}
+`)
+
+	want := map[string]apiSymbol{
+		"pkg.A":                {Package: "pkg", Name: "A", Kind: "const", Signature: "Kind"},
+		"pkg.B":                {Package: "pkg", Name: "B", Kind: "const", Signature: "Kind"},
+		"pkg.Kind":             {Package: "pkg", Name: "Kind", Kind: "type", Signature: "int"},
+		"pkg.Reader":           {Package: "pkg", Name: "Reader", Kind: "type", Signature: "interface"},
+		"pkg.Reader.Read":      {Package: "pkg", Name: "Reader.Read", Kind: "interface method", Signature: "func([]byte) (int, error)"},
+		"pkg.Reader.io.Closer": {Package: "pkg", Name: "Reader.io.Closer", Kind: "embedded interface", Signature: "io.Closer"},
+		"pkg.S":                {Package: "pkg", Name: "S", Kind: "type", Signature: "struct"},
+		"pkg.S.X":              {Package: "pkg", Name: "S.X", Kind: "field", Signature: "int"},
+		"pkg.S.Y":              {Package: "pkg", Name: "S.Y", Kind: "field", Signature: "int"},
+		"pkg.S.Embedded":       {Package: "pkg", Name: "S.Embedded", Kind: "embedded field", Signature: "Embedded"},
+		"pkg.S.Do":             {Package: "pkg", Name: "S.Do", Kind: "method", Signature: "func(int, int) error"},
+		"pkg.F":                {Package: "pkg", Name: "F", Kind: "func", Signature: "func(string, ...int)"},
+	}
+	if !reflect.DeepEqual(surface.Symbols, want) {
+		t.Errorf("Symbols = %+v, want %+v", surface.Symbols, want)
+	}
+}
+
+func TestDiffAPI(t *testing.T) {
+	old := surfaceFromSource(t, `package pkg
+
+type Reader interface{ Read(p []byte) (int, error) }
+
+func F(name string) {}
+func Gone() {}
+`)
+
+	// Define a table of test cases
+	testCases := []struct {
+		name     string
+		src      string // The new version of the package
+		want     []apiChange
+		wantBump string
+	}{
+		{
+			name: "Test with renamed parameters only",
+			src: `package pkg
+
+type Reader interface{ Read(buf []byte) (int, error) }
+
+func F(other string) {}
+func Gone() {}
+`,
+			want:     nil,
+			wantBump: "patch (no exported API changes)",
+		},
+		{
+			name: "Test with compatible additions",
+			src: `package pkg
+
+type Reader interface{ Read(p []byte) (int, error) }
+
+func F(name string) {}
+func Gone() {}
+func New() {}
+`,
+			want: []apiChange{
+				{Symbol: apiSymbol{Package: "pkg", Name: "New", Kind: "func", Signature: "func()"}, Change: "added", Reason: "added func", New: "func()"},
+			},
+			wantBump: "minor (compatible additions only)",
+		},
+		{
+			name: "Test with breaking changes",
+			src: `package pkg
+
+type Reader interface {
+	Read(p []byte) (int, error)
+	Close() error
+}
+
+func F(name string, n int) {}
+`,
+			want: []apiChange{
+				{Symbol: apiSymbol{Package: "pkg", Name: "F", Kind: "func", Signature: "func(string, int)"}, Change: "changed", Breaking: true, Reason: "changed func signature", Old: "func(string)", New: "func(string, int)"},
+				{Symbol: apiSymbol{Package: "pkg", Name: "Gone", Kind: "func", Signature: "func()"}, Change: "removed", Breaking: true, Reason: "removed func", Old: "func()"},
+				{Symbol: apiSymbol{Package: "pkg", Name: "Reader.Close", Kind: "interface method", Signature: "func() error"}, Change: "added", Breaking: true, Reason: "added interface method", New: "func() error"},
+			},
+			wantBump: "major: the module path becomes example.com/m/v2",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			got := diffAPI(old, surfaceFromSource(t, testCase.src))
+			if !reflect.DeepEqual(got, testCase.want) {
+				t.Errorf("diffAPI() = %+v, want %+v", got, testCase.want)
+			}
+			if bump := recommendBump("example.com/m", "", got); bump != testCase.wantBump {
+				t.Errorf("recommendBump() = %v, want %v", bump, testCase.wantBump)
+			}
+		})
+	}
+}
+
+func TestRecommendBump(t *testing.T) {
+	breaking := []apiChange{{Change: "removed", Breaking: true}}
+	testCases := []struct {
+		name        string
+		modulePath  string
+		baseVersion string
+		want        string
+	}{
+		{name: "Test with an unknown base", modulePath: "example.com/m", want: "major: the module path becomes example.com/m/v2"},
+		{name: "Test with a v0 base", modulePath: "example.com/m", baseVersion: "v0.4.1", want: "minor (breaking changes, allowed in a minor bump while the module is at v0.4.1)"},
+		{name: "Test with a v1 base", modulePath: "example.com/m", baseVersion: "v1.2.0", want: "major: the module path becomes example.com/m/v2"},
+		{name: "Test with a major suffix", modulePath: "example.com/m/v3", baseVersion: "v3.0.0", want: "major: the module path becomes example.com/m/v4"},
+		{name: "Test without a module path", want: "major (breaking changes)"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if got := recommendBump(testCase.modulePath, testCase.baseVersion, breaking); got != testCase.want {
+				t.Errorf("recommendBump() = %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestAPISymbolDisplayName(t *testing.T) {
+	testCases := []struct {
+		symbol apiSymbol
+		want   string
+	}{
+		{apiSymbol{Package: ".", Name: "Show"}, "Show"},
+		{apiSymbol{Package: ".", Name: "Getter.Put"}, "Getter.Put"},
+		{apiSymbol{Package: "internal/store", Name: "Cache.Get"}, "internal/store.Cache.Get"},
+	}
+	for _, testCase := range testCases {
+		if got := testCase.symbol.displayName(); got != testCase.want {
+			t.Errorf("displayName() = %v, want %v", got, testCase.want)
+		}
+	}
+}
+
+func TestNormalizeFuncType(t *testing.T) {
+	// Define a table of test cases
+	testCases := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "Test with a describe signature",
+			input: "func(param1 int, param2 string) (result bool)",
+			want:  "func(int, string) bool",
+		},
+		{
+			name:  "Test with multiple results",
+			input: "func() (int, error)",
+			want:  "func() (int, error)",
+		},
+		{
+			name:  "Test with an unparseable signature",
+			input: "func(",
+			want:  "func(",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if got := normalizeFuncType(testCase.input); got != testCase.want {
+				t.Errorf("normalizeFuncType() = %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestReadAPISnapshot(t *testing.T) {
+	surface := surfaceFromSource(t, `package pkg
+
+type S struct{ X int }
+
+func F() {}
+`)
+	data, err := json.Marshal(surface.snapshot())
+	if err != nil {
+		t.Fatalf("Failed to marshal snapshot: %v", err)
+	}
+
+	// Define a table of test cases
+	testCases := []struct {
+		name    string
+		data    []byte
+		want    *apiSurface
+		wantOK  bool
+		wantErr bool
+	}{
+		{
+			name:   "Test with a snapshot",
+			data:   data,
+			want:   surface,
+			wantOK: true,
+		},
+		{
+			name:   "Test with describe output",
+			data:   []byte(`{"FilePath":"pkg/a.go","Imports":[],"Structs":{},"Interfaces":null,"Funcs":["F()"]}`),
+			wantOK: false,
+		},
+		{
+			name:    "Test with a snapshot from another version",
+			data:    []byte(`{"SchemaVersion":99,"Module":"example.com/m","Symbols":[]}`),
+			wantOK:  true,
+			wantErr: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			got, ok, err := readAPISnapshot(testCase.data)
+			if (err != nil) != testCase.wantErr {
+				t.Errorf("readAPISnapshot() error = %v, wantErr %v", err, testCase.wantErr)
+			}
+			if ok != testCase.wantOK {
+				t.Errorf("readAPISnapshot() ok = %v, want %v", ok, testCase.wantOK)
+			}
+			if !reflect.DeepEqual(got, testCase.want) {
+				t.Errorf("readAPISnapshot() = %+v, want %+v", got, testCase.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,731 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply [snippet.go | -]",
+	Short: "Apply the declarations of a Go snippet to the module, matched by symbol",
+	Long: `Apply a Go snippet, such as one returned by a chat assistant, to the Go files
+under --dir. The snippet is read from the file given, or from stdin.
+
+Each declaration in the snippet replaces the top-level declaration with the
+same name (Type.Method for methods) in the package named by the snippet's
+package clause, if it has one. Declarations with no match are added: methods
+to the file declaring their type, anything else to the file of another
+declaration the snippet replaces, or to --into. Imports the snippet's code
+uses are added, and changed files are formatted with gofmt.
+
+The changes are printed as a unified diff; files are only written with
+--write.`,
+	Example: `  gosymex apply fix.go
+  pbpaste | gosymex apply --dir ./internal/store --write`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runApplyCmd,
+}
+
+func init() {
+	addWalkFlags(applyCmd)
+	applyCmd.Flags().String("dir", ".", "Directory whose Go files the snippet is applied to")
+	applyCmd.Flags().String("into", "", "File to add new declarations to that have no other place")
+	applyCmd.Flags().Bool("write", false, "Write the changed files instead of only printing the diff")
+	rootCmd.AddCommand(applyCmd)
+}
+
+// snippetDecl is one top-level declaration of a snippet.
+type snippetDecl struct {
+	Name  string   // Name, or Type.Method for methods
+	Names []string // every name of a multi-name spec or a kept group
+	Kind  string   // func, method, type, const or var
+	Group bool     // a const group kept whole, as its specs repeat implicit values
+	Recv  string   // the receiver type of methods
+	Decl  string   // the declaration on its own, with its doc comment
+	Spec  string   // the spec alone, for replacing one in a grouped declaration
+	Doc   bool     // whether it has a doc comment
+	uses  map[string]bool
+}
+
+// codeSnippet is a parsed snippet.
+type codeSnippet struct {
+	Package string            // empty when the snippet has no package clause
+	Imports map[string]string // import spec by the name code refers to it with
+	Unnamed []string          // import specs no code refers to by their assumed name
+	Decls   []snippetDecl
+}
+
+// declTarget is an existing top-level declaration a snippet can replace.
+type declTarget struct {
+	File    string
+	Package string
+	Name    string
+	Kind    string
+	Start   int // byte offsets of the declaration, with its doc comment
+	Node    int // byte offset of the declaration without its doc comment
+	End     int
+	Grouped bool // a spec inside a parenthesized declaration
+	// The offsets of the parenthesized declaration of a grouped spec.
+	GroupStart, GroupNode, GroupEnd int
+}
+
+// textEdit replaces src[Start:End] of a file with Text.
+type textEdit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// appliedFile is the result of applying a snippet to one file.
+type appliedFile struct {
+	Path    string
+	Old     []byte
+	New     []byte
+	Changes []string
+}
+
+func runApplyCmd(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("dir")
+	into, _ := cmd.Flags().GetString("into")
+	write, _ := cmd.Flags().GetBool("write")
+
+	src, _, err := readSnippet(args)
+	if err != nil {
+		return err
+	}
+	snippet, err := parseSnippet(src)
+	if err != nil {
+		return err
+	}
+
+	files, err := applySnippet(snippet, dir, walkOptionsFromFlags(cmd), into)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		for _, change := range file.Changes {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file.Path, change)
+		}
+		name := filepath.ToSlash(file.Path)
+		fmt.Print(unifiedDiff("a/"+name, "b/"+name, string(file.Old), string(file.New)))
+	}
+	if !write {
+		return nil
+	}
+	for _, file := range files {
+		if err := writeFileAtomic(file.Path, file.New); err != nil {
+			return fmt.Errorf("writing %s: %w", file.Path, err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", plural(len(files), "file"))
+	return nil
+}
+
+// readSnippet reads the snippet named by the arguments, or stdin when there
+// is none or it is "-". It also returns the name to report positions with.
+func readSnippet(args []string) ([]byte, string, error) {
+	if len(args) == 0 || args[0] == "-" {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, "", fmt.Errorf("reading snippet: %w", err)
+		}
+		return src, "snippet.go", nil
+	}
+	src, err := os.ReadFile(args[0])
+	if err != nil {
+		return nil, "", fmt.Errorf("reading snippet: %w", err)
+	}
+	return src, args[0], nil
+}
+
+// snippetPackageClause is put in front of snippets without a package clause.
+// It is on the first line so that line numbers still match the snippet.
+const snippetPackageClause = "package snippet; "
+
+// parseSnippetFile parses Go source that may lack a package clause and may be
+// wrapped in a markdown code fence. It returns the text that was parsed, and
+// whether the snippet had a package clause of its own.
+func parseSnippetFile(fset *token.FileSet, filename string, src []byte) (*ast.File, string, bool, error) {
+	text := stripSnippetFence(string(src))
+	hasPackage := true
+	if _, err := parser.ParseFile(token.NewFileSet(), "", text, parser.PackageClauseOnly); err != nil {
+		text = snippetPackageClause + text
+		hasPackage = false
+	}
+	file, err := parser.ParseFile(fset, filename, text, parser.ParseComments|parser.AllErrors)
+	if err != nil {
+		return nil, "", false, withExitCode(exitParseError, fmt.Errorf("parsing snippet: %w", err))
+	}
+	return file, text, hasPackage, nil
+}
+
+// parseSnippet parses a snippet into the declarations it holds.
+func parseSnippet(src []byte) (*codeSnippet, error) {
+	fset := token.NewFileSet()
+	file, text, hasPackage, err := parseSnippetFile(fset, "snippet.go", src)
+	if err != nil {
+		return nil, err
+	}
+	snippet := &codeSnippet{Imports: make(map[string]string)}
+	if hasPackage {
+		snippet.Package = file.Name.Name
+	}
+
+	offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+	cut := func(doc *ast.CommentGroup, node ast.Node) string {
+		start := node.Pos()
+		if doc != nil {
+			start = doc.Pos()
+		}
+		return text[offset(start):offset(node.End())]
+	}
+	// uses collects the qualifiers that are not declared in the snippet,
+	// which are those of imported packages.
+	allUses := make(map[string]bool)
+	uses := func(node ast.Node) map[string]bool {
+		used := make(map[string]bool)
+		ast.Inspect(node, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil {
+					used[id.Name] = true
+					allUses[id.Name] = true
+				}
+			}
+			return true
+		})
+		return used
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			item := snippetDecl{Name: declName(d), Kind: "func", Decl: cut(d.Doc, d), Doc: d.Doc != nil, uses: uses(d)}
+			item.Names = []string{item.Name}
+			if d.Recv != nil {
+				item.Kind = "method"
+				item.Recv = strings.TrimSuffix(item.Name, "."+d.Name.Name)
+			}
+			snippet.Decls = append(snippet.Decls, item)
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				for _, spec := range d.Specs {
+					imp := spec.(*ast.ImportSpec)
+					importPath, _ := strconv.Unquote(imp.Path.Value)
+					name := importPathName(importPath)
+					if imp.Name != nil {
+						name = imp.Name.Name
+					}
+					snippet.Imports[name] = text[offset(imp.Pos()):offset(imp.End())]
+				}
+				continue
+			}
+			if implicitValues(d) {
+				item := snippetDecl{Kind: d.Tok.String(), Group: true, Decl: cut(d.Doc, d), Doc: d.Doc != nil, uses: uses(d)}
+				for _, spec := range d.Specs {
+					for _, name := range spec.(*ast.ValueSpec).Names {
+						item.Names = append(item.Names, name.Name)
+					}
+				}
+				item.Name = item.Names[0]
+				snippet.Decls = append(snippet.Decls, item)
+				continue
+			}
+			for _, spec := range d.Specs {
+				item := snippetDecl{Kind: d.Tok.String(), uses: uses(spec)}
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					item.Names = []string{s.Name.Name}
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						item.Names = append(item.Names, name.Name)
+					}
+				}
+				item.Name = item.Names[0]
+				if d.Lparen.IsValid() {
+					item.Spec = cut(specDoc(spec), spec)
+					item.Decl = d.Tok.String() + " " + item.Spec
+					item.Doc = specDoc(spec) != nil
+				} else {
+					item.Spec = cut(nil, spec)
+					if d.Doc != nil {
+						item.Spec = cut(nil, d.Doc) + "\n" + item.Spec
+					}
+					item.Decl = cut(d.Doc, d)
+					item.Doc = d.Doc != nil
+				}
+				snippet.Decls = append(snippet.Decls, item)
+			}
+		}
+	}
+	if len(snippet.Decls) == 0 {
+		return nil, withExitCode(exitUsage, errors.New("the snippet has no declarations"))
+	}
+	// An import the code never refers to by its assumed name is presumably
+	// named otherwise in its package clause.
+	for name, spec := range snippet.Imports {
+		if !allUses[name] && name != "_" && name != "." {
+			delete(snippet.Imports, name)
+			snippet.Unnamed = append(snippet.Unnamed, spec)
+		}
+	}
+	sort.Strings(snippet.Unnamed)
+	return snippet, nil
+}
+
+// importPathName returns the name a package is assumed to have from its
+// import path, as goimports assumes it: a major version suffix such as /v2
+// is skipped, a go- prefix is dropped, and the name ends at the first
+// character that cannot be part of an identifier, as in gopkg.in/yaml.v3.
+func importPathName(importPath string) string {
+	base := path.Base(importPath)
+	if strings.HasPrefix(base, "v") {
+		if _, err := strconv.Atoi(base[1:]); err == nil && path.Dir(importPath) != "." {
+			base = path.Base(path.Dir(importPath))
+		}
+	}
+	base = strings.TrimPrefix(base, "go-")
+	if i := strings.IndexFunc(base, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}); i >= 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+// implicitValues reports whether a const group has specs that repeat the
+// values of the one before, such as an iota sequence. Such a group only
+// keeps its meaning as a whole.
+func implicitValues(d *ast.GenDecl) bool {
+	if d.Tok != token.CONST || !d.Lparen.IsValid() {
+		return false
+	}
+	for _, spec := range d.Specs {
+		if len(spec.(*ast.ValueSpec).Values) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// names lists the names of a declaration for messages.
+func (d snippetDecl) names() string {
+	return strings.Join(d.Names, ", ")
+}
+
+// stripSnippetFence blanks the lines of a surrounding markdown code fence,
+// keeping the line numbers of the code.
+func stripSnippetFence(text string) string {
+	lines := strings.Split(text, "\n")
+	first, last := -1, -1
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		last = i
+	}
+	if first < 0 || first == last || !strings.HasPrefix(strings.TrimSpace(lines[first]), "```") || strings.TrimSpace(lines[last]) != "```" {
+		return text
+	}
+	lines[first], lines[last] = "", ""
+	return strings.Join(lines, "\n")
+}
+
+// collectTargets lists the top-level declarations of the Go files under dir.
+func collectTargets(dir string, opts walkOptions) ([]declTarget, map[string][]byte, error) {
+	var targets []declTarget
+	sources := make(map[string][]byte)
+	var failures fileFailures
+	err := walkGoFiles(dir, opts, func(filePath string, info os.FileInfo) error {
+		src, err := os.ReadFile(filePath)
+		if err != nil {
+			failures.add(err)
+			return nil
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, filePath, src, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			failures.add(err)
+			return nil
+		}
+		sources[filePath] = src
+		// The parenthesized declaration of each grouped spec, by the offset
+		// of the spec.
+		groups := make(map[int]*ast.GenDecl)
+		for _, decl := range file.Decls {
+			if gen, ok := decl.(*ast.GenDecl); ok && gen.Lparen.IsValid() {
+				for _, spec := range gen.Specs {
+					groups[fset.Position(spec.Pos()).Offset] = gen
+				}
+			}
+		}
+		err = fileSymbols(filePath, src, func(name, kind string, node ast.Node, doc *ast.CommentGroup, fset *token.FileSet) {
+			start := node.Pos()
+			if doc != nil {
+				start = doc.Pos()
+			}
+			target := declTarget{
+				File:    filePath,
+				Package: file.Name.Name,
+				Name:    name,
+				Kind:    kind,
+				Start:   fset.Position(start).Offset,
+				Node:    fset.Position(node.Pos()).Offset,
+				End:     fset.Position(node.End()).Offset,
+			}
+			if _, grouped := node.(ast.Spec); grouped {
+				gen := groups[target.Node]
+				target.Grouped = true
+				target.GroupStart, target.GroupNode = fset.Position(gen.Pos()).Offset, fset.Position(gen.Pos()).Offset
+				if gen.Doc != nil {
+					target.GroupStart = fset.Position(gen.Doc.Pos()).Offset
+				}
+				target.GroupEnd = fset.Position(gen.End()).Offset
+			}
+			targets = append(targets, target)
+		})
+		failures.add(err)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(sources) == 0 {
+		if err := failures.err(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("no Go files in '%s'", dir)
+	}
+	return targets, sources, nil
+}
+
+// applySnippet works out the changed content of every file the snippet
+// touches, without writing anything.
+func applySnippet(snippet *codeSnippet, dir string, opts walkOptions, into string) ([]*appliedFile, error) {
+	targets, sources, err := collectTargets(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	if into != "" {
+		into = walkedPath(into, sources)
+	}
+	find := func(name string, kind func(string) bool) []declTarget {
+		var found []declTarget
+		for _, target := range targets {
+			if target.Name == name && kind(target.Kind) && (snippet.Package == "" || target.Package == snippet.Package) {
+				found = append(found, target)
+			}
+		}
+		return found
+	}
+	anyKind := func(string) bool { return true }
+
+	edits := make(map[string][]textEdit)
+	changes := make(map[string][]string)
+	uses := make(map[string]map[string]bool)
+	record := func(file string, decl snippetDecl, edit textEdit, change string) {
+		edits[file] = append(edits[file], edit)
+		changes[file] = append(changes[file], fmt.Sprintf("%s %s %s", change, decl.Kind, decl.names()))
+		if uses[file] == nil {
+			uses[file] = make(map[string]bool)
+		}
+		for name := range decl.uses {
+			uses[file][name] = true
+		}
+	}
+
+	// Replacements come first, as new declarations may be placed next to them.
+	anchor := ""
+	var added []snippetDecl
+	replaced := make(map[declTarget]bool)
+	for _, decl := range snippet.Decls {
+		var found []declTarget
+		for _, name := range decl.Names {
+			matches := find(name, anyKind)
+			if len(matches) > 1 {
+				var where []string
+				for _, target := range matches {
+					where = append(where, target.File)
+				}
+				return nil, withExitCode(exitUsage, fmt.Errorf("'%s' is declared more than once (%s); narrow it down with --dir or a package clause", name, strings.Join(where, ", ")))
+			}
+			found = append(found, matches...)
+		}
+		if len(found) == 0 {
+			added = append(added, decl)
+			continue
+		}
+		for _, target := range found {
+			if replaced[target] {
+				return nil, withExitCode(exitUsage, fmt.Errorf("'%s' appears more than once in the snippet", target.Name))
+			}
+		}
+
+		var edit textEdit
+		var extra, dropped []declTarget
+		var err error
+		if decl.Group {
+			edit, dropped, err = replaceGroup(decl, found, targets, replaced)
+		} else {
+			edit, extra, err = replaceSpecs(decl, found, targets, replaced)
+		}
+		if err != nil {
+			return nil, err
+		}
+		record(found[0].File, decl, edit, "replace")
+		for _, target := range dropped {
+			changes[target.File] = append(changes[target.File], fmt.Sprintf("remove %s %s", target.Kind, target.Name))
+		}
+		// Names declared apart are now declared by the first one.
+		for _, target := range extra {
+			edits[target.File] = append(edits[target.File], textEdit{Start: target.Start, End: target.End})
+		}
+		if anchor == "" {
+			anchor = found[0].File
+		}
+	}
+
+	for _, decl := range added {
+		file := into
+		if file == "" && decl.Recv != "" {
+			if types := find(decl.Recv, func(kind string) bool { return kind == "type" }); len(types) == 1 {
+				file = types[0].File
+			}
+		}
+		if file == "" {
+			file = anchor
+		}
+		if file == "" {
+			return nil, withExitCode(exitUsage, fmt.Errorf("no place to add %s %s; choose a file with --into", decl.Kind, decl.Name))
+		}
+		if _, ok := sources[file]; !ok {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", file, err)
+			}
+			sources[file] = src
+		}
+		end := len(sources[file])
+		record(file, decl, textEdit{Start: end, End: end, Text: "\n\n" + decl.Decl + "\n"}, "add")
+	}
+
+	var paths []string
+	for path := range edits {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var files []*appliedFile
+	for _, path := range paths {
+		updated, err := applyEdits(sources[path], edits[path])
+		if err != nil {
+			return nil, fmt.Errorf("applying to %s: %w", path, err)
+		}
+		updated, err = mergeSnippetImports(updated, snippet, uses[path])
+		if err != nil {
+			return nil, fmt.Errorf("applying to %s: %w", path, err)
+		}
+		updated, err = format.Source(updated)
+		if err != nil {
+			return nil, withExitCode(exitParseError, fmt.Errorf("applying to %s: %w", path, err))
+		}
+		files = append(files, &appliedFile{Path: path, Old: sources[path], New: updated, Changes: changes[path]})
+	}
+	return files, nil
+}
+
+// specTargets returns the targets declared by the same spec as target,
+// which are several for a spec such as var a, b = 1, 2.
+func specTargets(target declTarget, targets []declTarget) []declTarget {
+	var same []declTarget
+	for _, other := range targets {
+		if other.File == target.File && other.Node == target.Node {
+			same = append(same, other)
+		}
+	}
+	return same
+}
+
+// replaceSpecs returns the edit replacing the existing declaration of the
+// names of a spec, and the other declarations to remove when the names were
+// declared apart. A spec declaring names the snippet leaves out cannot be
+// replaced, as they would be lost.
+func replaceSpecs(decl snippetDecl, found, targets []declTarget, replaced map[declTarget]bool) (textEdit, []declTarget, error) {
+	wanted := make(map[string]bool)
+	for _, name := range decl.Names {
+		wanted[name] = true
+	}
+	var extra []declTarget
+	for i, target := range found {
+		if target.Grouped && decl.Kind != target.Kind {
+			return textEdit{}, nil, withExitCode(exitUsage, fmt.Errorf("cannot replace %s %s, declared in a group, with a %s", target.Kind, target.Name, decl.Kind))
+		}
+		for _, other := range specTargets(target, targets) {
+			if !wanted[other.Name] {
+				return textEdit{}, nil, withExitCode(exitUsage, fmt.Errorf("cannot replace %s %s alone; it is declared together with %s", target.Kind, target.Name, other.Name))
+			}
+			replaced[other] = true
+		}
+		if i > 0 && (target.File != found[0].File || target.Node != found[0].Node) && !containsSpec(extra, target) {
+			extra = append(extra, target)
+		}
+	}
+
+	target := found[0]
+	text := decl.Decl
+	if target.Grouped {
+		text = decl.Spec
+	}
+	// A declaration without a doc comment keeps the existing one.
+	start := target.Start
+	if !decl.Doc {
+		start = target.Node
+	}
+	return textEdit{Start: start, End: target.End, Text: text}, extra, nil
+}
+
+func containsSpec(targets []declTarget, target declTarget) bool {
+	for _, other := range targets {
+		if other.File == target.File && other.Node == target.Node {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceGroup returns the edit replacing the existing declarations of a
+// const group that is kept whole. The names must be declared in one group,
+// or by one ungrouped declaration, which is replaced as a whole. It also
+// returns the declarations of that group the snippet leaves out.
+func replaceGroup(decl snippetDecl, found, targets []declTarget, replaced map[declTarget]bool) (textEdit, []declTarget, error) {
+	first := found[0]
+	for _, target := range found {
+		sameGroup := target.Grouped && first.Grouped && target.File == first.File && target.GroupNode == first.GroupNode
+		sameSpec := !target.Grouped && !first.Grouped && target.File == first.File && target.Node == first.Node
+		if !sameGroup && !sameSpec {
+			return textEdit{}, nil, withExitCode(exitUsage, fmt.Errorf("cannot replace %s with one group; they are declared apart", decl.names()))
+		}
+		if target.Kind != decl.Kind {
+			return textEdit{}, nil, withExitCode(exitUsage, fmt.Errorf("cannot replace %s %s with a %s", target.Kind, target.Name, decl.Kind))
+		}
+	}
+
+	start, node, end := first.Start, first.Node, first.End
+	members := specTargets(first, targets)
+	if first.Grouped {
+		start, node, end = first.GroupStart, first.GroupNode, first.GroupEnd
+		members = nil
+		for _, other := range targets {
+			if other.Grouped && other.File == first.File && other.GroupNode == first.GroupNode {
+				members = append(members, other)
+			}
+		}
+	}
+	wanted := make(map[string]bool)
+	for _, name := range decl.Names {
+		wanted[name] = true
+	}
+	var dropped []declTarget
+	for _, member := range members {
+		replaced[member] = true
+		if !wanted[member.Name] {
+			dropped = append(dropped, member)
+		}
+	}
+	// A group without a doc comment keeps the existing one.
+	if !decl.Doc {
+		start = node
+	}
+	return textEdit{Start: start, End: end, Text: decl.Decl}, dropped, nil
+}
+
+// walkedPath returns the path the walk recorded for a file named on the
+// command line, so that ./a.go and a.go collect their edits together.
+func walkedPath(path string, sources map[string][]byte) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		for walked := range sources {
+			if walkedAbs, err := filepath.Abs(walked); err == nil && walkedAbs == abs {
+				return walked
+			}
+		}
+	}
+	return filepath.Clean(path)
+}
+
+// applyEdits applies non-overlapping edits to src. Edits at the same offset
+// keep their order.
+func applyEdits(src []byte, edits []textEdit) ([]byte, error) {
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].Start < edits[j].Start })
+	var out []byte
+	last := 0
+	for _, edit := range edits {
+		if edit.Start < last {
+			return nil, errors.New("overlapping changes")
+		}
+		out = append(out, src[last:edit.Start]...)
+		out = append(out, edit.Text...)
+		last = edit.End
+	}
+	return append(out, src[last:]...), nil
+}
+
+// mergeSnippetImports adds the snippet imports that the code placed in a file
+// uses and the file does not import yet. Imports whose name is not known go
+// to files where the code uses a qualifier no import accounts for.
+func mergeSnippetImports(src []byte, snippet *codeSnippet, used map[string]bool) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, withExitCode(exitParseError, fmt.Errorf("the result does not parse: %w", err))
+	}
+	have := make(map[string]bool)
+	known := make(map[string]bool)
+	for _, imp := range file.Imports {
+		have[imp.Path.Value] = true
+		importPath, _ := strconv.Unquote(imp.Path.Value)
+		if imp.Name != nil {
+			known[imp.Name.Name] = true
+		} else {
+			known[importPathName(importPath)] = true
+		}
+	}
+
+	var missing []string
+	unresolved := false
+	for name := range used {
+		spec, ok := snippet.Imports[name]
+		switch {
+		case ok && !have[spec[strings.Index(spec, `"`):]]:
+			missing = append(missing, spec)
+		case !ok && !known[name]:
+			unresolved = true
+		}
+	}
+	if unresolved {
+		for _, spec := range snippet.Unnamed {
+			if !have[spec[strings.Index(spec, `"`):]] {
+				missing = append(missing, spec)
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return src, nil
+	}
+	sort.Strings(missing)
+	return insertImports(fset, file, src, missing), nil
+}
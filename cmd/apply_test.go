@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplySnippet(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"shapes.go":        symbolsFixture,
+		"circle/circle.go": "package circle\n\ntype Circle struct{}\n\nfunc NewSquare() {}\n",
+		"vars.go":          "package shapes\n\nvar width, height = 1, 2\n\nvar depth = 3\n",
+	})
+	shapes := filepath.Join(dir, "shapes.go")
+	vars := filepath.Join(dir, "vars.go")
+
+	testCases := []struct {
+		name    string
+		snippet string
+		into    string
+		want    map[string][]string // expected substrings of the new content, by file
+		code    int
+	}{
+		{
+			name:    "Test with a replaced method and a new import",
+			snippet: "```go\npackage shapes\n\nimport \"math\"\n\n// Area returns the rounded area of s.\nfunc (s *Square) Area() Area {\n\treturn Area(math.Round(s.Side * s.Side))\n}\n```\n",
+			want: map[string][]string{shapes: {
+				"import (\n\t\"math\"\n)\n",
+				"// Area returns the rounded area of s.\nfunc (s *Square) Area() Area {\n\treturn Area(math.Round(s.Side * s.Side))\n}\n\nfunc NewSquare",
+			}},
+		},
+		{
+			name:    "Test with a new method and a grouped constant",
+			snippet: "package shapes\n\n// Perimeter returns the perimeter of s.\nfunc (s Square) Perimeter() float64 { return 4 * s.Side }\n\n// Unit is one.\nconst Unit = 1.5\n",
+			want: map[string][]string{shapes: {
+				"const (\n\t// Unit is one.\n\tUnit = 1.5\n\tZero = 0.0\n)\n",
+				"}\n\n// Perimeter returns the perimeter of s.\nfunc (s Square) Perimeter() float64 { return 4 * s.Side }\n",
+			}},
+		},
+		{
+			name:    "Test with a versioned import path",
+			snippet: "package shapes\n\nimport \"gopkg.in/yaml.v3\"\n\nfunc (s *Square) YAML() ([]byte, error) { return yaml.Marshal(s) }\n",
+			want:    map[string][]string{shapes: {"import (\n\t\"gopkg.in/yaml.v3\"\n)\n"}},
+		},
+		{
+			name:    "Test with an import named unlike its path",
+			snippet: "package shapes\n\nimport \"example.com/oddpath\"\n\nfunc (s *Square) Odd() int { return odd.Value(s) }\n",
+			want:    map[string][]string{shapes: {"import (\n\t\"example.com/oddpath\"\n)\n"}},
+		},
+		{
+			name:    "Test without a package clause or doc comment",
+			snippet: "type Area int\n",
+			want:    map[string][]string{shapes: {"// Area values are in square units.\ntype Area int\n"}},
+		},
+		{
+			name:    "Test with a replacement and an addition to an unclean --into",
+			snippet: "package shapes\n\ntype Area int\n\nfunc Triangle() {}\n",
+			into:    dir + string(filepath.Separator) + "." + string(filepath.Separator) + "shapes.go",
+			want:    map[string][]string{shapes: {"type Area int\n", "}\n\nfunc Triangle() {}\n"}},
+		},
+		{
+			name:    "Test with a const group of implicit values",
+			snippet: "package shapes\n\nconst (\n\tUnit = iota\n\tTwo\n)\n",
+			want:    map[string][]string{shapes: {"\tSide float64\n}\n\nconst (\n\tUnit = iota\n\tTwo\n)\n\n// Area returns"}},
+		},
+		{
+			name:    "Test with a spec of several names",
+			snippet: "package shapes\n\nvar width, height = 3, 4\n",
+			want:    map[string][]string{vars: {"package shapes\n\nvar width, height = 3, 4\n\nvar depth = 3\n"}},
+		},
+		{
+			name:    "Test with names declared apart",
+			snippet: "package shapes\n\nvar width, height, depth = 1, 2, 3\n",
+			want:    map[string][]string{vars: {"package shapes\n\nvar width, height, depth = 1, 2, 3\n"}},
+		},
+		{
+			name:    "Test with a name declared together with another",
+			snippet: "package shapes\n\nvar height = 5\n",
+			code:    exitUsage,
+		},
+		{
+			name:    "Test with a name declared in two packages",
+			snippet: "func NewSquare() *Square { return nil }\n",
+			code:    exitUsage,
+		},
+		{
+			name:    "Test with nowhere to add a function",
+			snippet: "package shapes\n\nfunc Triangle() {}\n",
+			code:    exitUsage,
+		},
+		{
+			name:    "Test with a func for a grouped constant",
+			snippet: "package shapes\n\nfunc Zero() {}\n",
+			code:    exitUsage,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			snippet, err := parseSnippet([]byte(tc.snippet))
+			if err != nil {
+				t.Fatalf("parseSnippet() error = %v", err)
+			}
+			files, err := applySnippet(snippet, dir, walkOptions{}, tc.into)
+			if tc.code != 0 {
+				if exitCode(err) != tc.code {
+					t.Fatalf("Expected exit code %d, but got %v", tc.code, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applySnippet() error = %v", err)
+			}
+			if len(files) != len(tc.want) {
+				t.Fatalf("Expected %d changed files, but got %d", len(tc.want), len(files))
+			}
+			for _, file := range files {
+				for _, want := range tc.want[file.Path] {
+					if !strings.Contains(string(file.New), want) {
+						t.Errorf("Expected %s to contain %q:\n%s", file.Path, want, file.New)
+					}
+				}
+			}
+		})
+	}
+
+	if _, err := parseSnippet([]byte("func {")); exitCode(err) != exitParseError {
+		t.Errorf("Expected a parse error, but got %v", err)
+	}
+}
+
+func TestImportPathName(t *testing.T) {
+	testCases := map[string]string{
+		"fmt":                                  "fmt",
+		"net/http":                             "http",
+		"gopkg.in/yaml.v3":                     "yaml",
+		"github.com/x/y/v2":                    "y",
+		"github.com/mattn/go-sqlite3":          "sqlite3",
+		"github.com/x/go-widgets/v3":           "widgets",
+		"github.com/russross/blackfriday-tool": "blackfriday",
+	}
+	for importPath, want := range testCases {
+		if got := importPathName(importPath); got != want {
+			t.Errorf("importPathName(%q): expected %s, but got %s", importPath, want, got)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and manage the extraction cache",
+	Long: `Describe results are cached per file, keyed by the file content and the
+output schema version, and the declarations each context pack showed are
+recorded next to them. These commands report on and clean up that cache.`,
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show cache location, size and number of stale entries",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheStatsCmd,
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove entries whose source file changed, moved or was written by another schema version, and old recorded packs",
+	Args:  cobra.NoArgs,
+	RunE:  runCachePruneCmd,
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove every cache entry and recorded pack",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheClearCmd,
+}
+
+var cacheDir string
+
+// describeCache is consulted by extractFile when set. It stays nil unless a
+// command opts into caching, which keeps tests and library use side-effect free.
+var describeCache *extractCache
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", "", "Directory for cached extraction results (default is the user cache dir)")
+
+	cachePruneCmd.Flags().Duration("pack-age", 30*24*time.Hour, "Remove recorded packs older than this")
+	cacheCmd.AddCommand(cacheStatsCmd, cachePruneCmd, cacheClearCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
+
+// cacheEntry is the on-disk record for one source file.
+type cacheEntry struct {
+	SchemaVersion int
+	SourcePath    string
+	ContentHash   string
+	Metrics       bool // whether Details carry function metrics
+	Details       *FileDetails
+}
+
+type cacheStats struct {
+	Entries int
+	Stale   int
+	Packs   int // recorded context packs
+	Bytes   int64
+}
+
+// extractCache stores serialized extraction results, one entry per source
+// file. Entries are addressed by the absolute source path and validated
+// against a hash of the file content, so a change to a file invalidates only
+// that file's entry.
+type extractCache struct {
+	dir string
+}
+
+// newExtractCache opens the cache rooted at dir, or at the default location
+// when dir is empty.
+func newExtractCache(dir string) (*extractCache, error) {
+	if dir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("error locating user cache dir: %v", err)
+		}
+		dir = filepath.Join(userCache, "gosymex")
+	}
+	return &extractCache{dir: dir}, nil
+}
+
+// contentHash returns the cache key for the given file content. The schema
+// version is part of the key so that entries from other versions never match.
+func contentHash(content []byte) string {
+	h := sha256.New()
+	h.Write([]byte("gosymex/" + strconv.Itoa(schemaVersion) + "\x00"))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// entryPath returns the location of the entry for the given source file.
+func (c *extractCache) entryPath(filePath string) string {
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		abs = filePath
+	}
+	sum := sha256.Sum256([]byte(abs))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, "entries", name[:2], name+".json")
+}
+
+// load returns the cached details for filePath if they were extracted from
+// content with the given hash. An entry without metrics cannot serve a
+// request for them; metrics an entry has but the request does not want are
+// dropped.
+func (c *extractCache) load(filePath, hash string, metrics bool) (*FileDetails, bool) {
+	entry, err := readCacheEntry(c.entryPath(filePath))
+	if err != nil || entry.SchemaVersion != schemaVersion || entry.ContentHash != hash || entry.Details == nil {
+		return nil, false
+	}
+	if metrics && !entry.Metrics {
+		return nil, false
+	}
+	if !metrics {
+		entry.Details.Metrics = nil
+	}
+	entry.Details.FilePath = filePath
+	return entry.Details, true
+}
+
+// store records details for filePath, replacing any previous entry.
+func (c *extractCache) store(filePath, hash string, metrics bool, details *FileDetails) error {
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(cacheEntry{
+		SchemaVersion: schemaVersion,
+		SourcePath:    abs,
+		ContentHash:   hash,
+		Metrics:       metrics,
+		Details:       details,
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(c.entryPath(filePath), data)
+}
+
+// writeFileAtomic writes data to path through a temporary file, so that
+// concurrent readers never see a partially written file. A file that already
+// exists keeps its mode.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// isStale reports whether an entry can no longer be served: it was written by
+// another schema version, or its source file is gone or has changed.
+func (entry *cacheEntry) isStale() bool {
+	if entry.SchemaVersion != schemaVersion {
+		return true
+	}
+	content, err := os.ReadFile(entry.SourcePath)
+	if err != nil {
+		return true
+	}
+	return contentHash(content) != entry.ContentHash
+}
+
+// walkEntries calls fn for every entry file in the cache. Unreadable entries
+// are passed with a nil entry.
+func (c *extractCache) walkEntries(fn func(path string, info fs.FileInfo, entry *cacheEntry) error) error {
+	root := filepath.Join(c.dir, "entries")
+	err := filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		entry, err := readCacheEntry(path)
+		if err != nil {
+			entry = nil
+		}
+		return fn(path, info, entry)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (c *extractCache) stats() (cacheStats, error) {
+	var stats cacheStats
+	err := c.walkEntries(func(path string, info fs.FileInfo, entry *cacheEntry) error {
+		stats.Entries++
+		stats.Bytes += info.Size()
+		if entry == nil || entry.isStale() {
+			stats.Stale++
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	err = c.walkPackStates(func(path string, info fs.FileInfo, state *packState) error {
+		stats.Packs++
+		stats.Bytes += info.Size()
+		return nil
+	})
+	return stats, err
+}
+
+// prune removes stale and unreadable entries and returns how many were removed.
+func (c *extractCache) prune() (int, error) {
+	removed := 0
+	err := c.walkEntries(func(path string, info fs.FileInfo, entry *cacheEntry) error {
+		if entry != nil && !entry.isStale() {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
+
+func (c *extractCache) clear() error {
+	if err := os.RemoveAll(filepath.Join(c.dir, "entries")); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(c.dir, "packs"))
+}
+
+func readCacheEntry(path string) (*cacheEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func runCacheStatsCmd(cmd *cobra.Command, args []string) error {
+	cache, err := newExtractCache(cacheDir)
+	if err != nil {
+		return fmt.Errorf("opening cache: %w", err)
+	}
+
+	stats, err := cache.stats()
+	if err != nil {
+		return fmt.Errorf("reading cache: %w", err)
+	}
+
+	fmt.Printf("Location:       %s\n", cache.dir)
+	fmt.Printf("Schema version: %d\n", schemaVersion)
+	fmt.Printf("Entries:        %d\n", stats.Entries)
+	fmt.Printf("Stale entries:  %d\n", stats.Stale)
+	fmt.Printf("Recorded packs: %d\n", stats.Packs)
+	fmt.Printf("Size:           %d bytes\n", stats.Bytes)
+	return nil
+}
+
+func runCachePruneCmd(cmd *cobra.Command, args []string) error {
+	packAge, _ := cmd.Flags().GetDuration("pack-age")
+	cache, err := newExtractCache(cacheDir)
+	if err != nil {
+		return fmt.Errorf("opening cache: %w", err)
+	}
+
+	removed, err := cache.prune()
+	if err != nil {
+		return fmt.Errorf("pruning cache: %w", err)
+	}
+	packs, err := cache.prunePackStates(packAge)
+	if err != nil {
+		return fmt.Errorf("pruning recorded packs: %w", err)
+	}
+	fmt.Printf("Removed %d stale entries and %s\n", removed, plural(packs, "recorded pack"))
+	return nil
+}
+
+func runCacheClearCmd(cmd *cobra.Command, args []string) error {
+	cache, err := newExtractCache(cacheDir)
+	if err != nil {
+		return fmt.Errorf("opening cache: %w", err)
+	}
+
+	if err := cache.clear(); err != nil {
+		return fmt.Errorf("clearing cache: %w", err)
+	}
+	fmt.Println("Cache cleared")
+	return nil
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExtractCache(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.go")
+	if err := os.WriteFile(source, []byte("package p\n\nfunc A() {}\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write source: %v", err)
+	}
+
+	cache, err := newExtractCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatalf("newExtractCache() error = %v", err)
+	}
+	describeCache = cache
+	defer func() { describeCache = nil }()
+
+	// Define a table of test cases, run in order against the same cache
+	testCases := []struct {
+		name      string
+		content   string // Content written before extraction, if any
+		wantFuncs []string
+		wantStale int // Stale entries after the content is written
+	}{
+		{
+			name:      "Test with a cold cache",
+			wantFuncs: []string{"A()"},
+		},
+		{
+			name:      "Test with a warm cache",
+			wantFuncs: []string{"A()"},
+		},
+		{
+			name:      "Test with a changed file",
+			content:   "package p\n\nfunc B() {}\n",
+			wantFuncs: []string{"B()"},
+			wantStale: 1,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if testCase.content != "" {
+				if err := os.WriteFile(source, []byte(testCase.content), 0o644); err != nil {
+					t.Fatalf("Failed to write source: %v", err)
+				}
+			}
+
+			stats, err := cache.stats()
+			if err != nil {
+				t.Fatalf("stats() error = %v", err)
+			}
+			if stats.Stale != testCase.wantStale {
+				t.Errorf("Stale = %d, want %d", stats.Stale, testCase.wantStale)
+			}
+
+			details, err := extractFile(source, describeOptions{})
+			if err != nil {
+				t.Fatalf("extractFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(details.Funcs, testCase.wantFuncs) {
+				t.Errorf("Funcs = %v, want %v", details.Funcs, testCase.wantFuncs)
+			}
+
+			stats, err = cache.stats()
+			if err != nil {
+				t.Fatalf("stats() error = %v", err)
+			}
+			if stats.Entries != 1 || stats.Stale != 0 {
+				t.Errorf("stats() = %+v, want 1 fresh entry", stats)
+			}
+		})
+	}
+}
+
+func TestExtractCacheMetrics(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.go")
+	if err := os.WriteFile(source, []byte("package p\n\nfunc A() {}\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write source: %v", err)
+	}
+
+	cache, err := newExtractCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatalf("newExtractCache() error = %v", err)
+	}
+	describeCache = cache
+	defer func() { describeCache = nil }()
+
+	// Run in order: an entry without metrics must not serve a metrics
+	// request, and metrics must not leak into a plain request.
+	testCases := []struct {
+		name        string
+		metrics     bool
+		wantMetrics int
+	}{
+		{"Test with a plain request", false, 0},
+		{"Test with a metrics request", true, 1},
+		{"Test with a plain request after metrics", false, 0},
+		{"Test with a warm metrics request", true, 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			details, err := extractFile(source, describeOptions{Metrics: testCase.metrics})
+			if err != nil {
+				t.Fatalf("extractFile() error = %v", err)
+			}
+			if len(details.Metrics) != testCase.wantMetrics {
+				t.Errorf("Metrics = %v, want %d entries", details.Metrics, testCase.wantMetrics)
+			}
+		})
+	}
+}
@@ -0,0 +1,424 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var checkSnippetCmd = &cobra.Command{
+	Use:   "check-snippet [snippet.go | -]",
+	Short: "Type-check a Go snippet as part of a package",
+	Long: `Type-check a Go snippet, read from the file given or from stdin, as if it
+were part of the package in --pkg. Declarations in the snippet take the place
+of the package's declarations with the same names, as apply would make them.
+
+Problems are reported with positions in the snippet, or in the package file
+the snippet breaks, and one of these kinds:
+  syntax          the snippet does not parse
+  undefined       an identifier, field or method that does not exist
+  interface       a method whose signature no longer matches an interface
+                  of the package, or a value that does not implement one
+  unused import   an import the snippet does not use
+  unused variable a variable declared and not used
+  compile         any other type error
+
+Problems the package already has without the snippet are not reported. The
+command fails when there are problems.`,
+	Example: `  gosymex check-snippet --pkg ./internal/foo snippet.go
+  pbpaste | gosymex check-snippet --pkg store --format json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runCheckSnippetCmd,
+}
+
+func init() {
+	checkSnippetCmd.Flags().String("pkg", ".", "Package directory, or package name in the current module, the snippet belongs to")
+	checkSnippetCmd.Flags().String("format", "text", "Output format: text or json")
+	rootCmd.AddCommand(checkSnippetCmd)
+}
+
+// snippetProblem is one problem found when checking a snippet.
+type snippetProblem struct {
+	File    string
+	Line    int
+	Column  int
+	Kind    string
+	Message string
+}
+
+func (p snippetProblem) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", p.File, p.Line, p.Column, p.Kind, p.Message)
+}
+
+func runCheckSnippetCmd(cmd *cobra.Command, args []string) error {
+	pkg, _ := cmd.Flags().GetString("pkg")
+	format, _ := cmd.Flags().GetString("format")
+	if format != "text" && format != "json" {
+		return withExitCode(exitUsage, fmt.Errorf("invalid --format %q: must be text or json", format))
+	}
+	dir, err := resolvePackageDir(pkg)
+	if err != nil {
+		return withExitCode(exitPathNotFound, fmt.Errorf("resolving package: %w", err))
+	}
+	src, name, err := readSnippet(args)
+	if err != nil {
+		return err
+	}
+
+	problems, err := checkSnippet(dir, name, src)
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		if problems == nil {
+			problems = []snippetProblem{}
+		}
+		out, err := json.MarshalIndent(problems, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	} else {
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		if len(problems) == 0 {
+			fmt.Println("No problems found")
+		}
+	}
+	if len(problems) > 0 {
+		return withExitCode(exitFailure, fmt.Errorf("%s in %s", plural(len(problems), "problem"), name))
+	}
+	return nil
+}
+
+// checkSnippet type-checks a snippet with the other files of the package in
+// dir and returns the problems it introduces.
+func checkSnippet(dir, name string, src []byte) ([]snippetProblem, error) {
+	fset := token.NewFileSet()
+	snippet, _, hasPackage, err := parseSnippetFile(fset, name, src)
+	var syntaxErrs scanner.ErrorList
+	if errors.As(err, &syntaxErrs) {
+		syntaxErrs.RemoveMultiples()
+		var problems []snippetProblem
+		for _, syntaxErr := range syntaxErrs {
+			problems = append(problems, snippetPosition(syntaxErr.Pos, hasPackage, "syntax", syntaxErr.Msg))
+		}
+		return problems, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := packageFiles(fset, dir, name)
+	if err != nil {
+		return nil, err
+	}
+	pkgName := files[0].Name.Name
+	var problems []snippetProblem
+	if hasPackage && snippet.Name.Name != pkgName {
+		problems = append(problems, snippetPosition(fset.Position(snippet.Name.Pos()), true, "compile",
+			fmt.Sprintf("package %s does not match package %s in %s", snippet.Name.Name, pkgName, dir)))
+	}
+	snippet.Name.Name = pkgName
+
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	typeErrors := func(files []*ast.File) ([]types.Error, *types.Package) {
+		var errs []types.Error
+		conf.Error = func(err error) {
+			if typeErr, ok := err.(types.Error); ok {
+				errs = append(errs, typeErr)
+			}
+		}
+		checked, _ := conf.Check(pkgName, fset, files, nil)
+		return errs, checked
+	}
+
+	known := make(map[string]bool)
+	before, original := typeErrors(files)
+	for _, typeErr := range before {
+		known[typeErr.Error()] = true
+	}
+
+	replaced := snippetNames(snippet)
+	var kept []*ast.File
+	for _, file := range files {
+		kept = append(kept, withoutDecls(file, replaced))
+	}
+	after, checked := typeErrors(append(kept, snippet))
+	for _, typeErr := range after {
+		if known[typeErr.Error()] {
+			continue
+		}
+		position := fset.Position(typeErr.Pos)
+		kind := typeErrorKind(typeErr.Msg)
+		// Some messages continue on indented lines; keep each on one.
+		msg := problemMessage(kind, strings.ReplaceAll(typeErr.Msg, "\n\t\t", "; "))
+		if position.Filename == name {
+			problems = append(problems, snippetPosition(position, hasPackage, kind, msg))
+		} else {
+			problems = append(problems, snippetProblem{File: position.Filename, Line: position.Line, Column: position.Column, Kind: kind, Message: msg})
+		}
+	}
+	for _, mismatch := range interfaceMismatches(snippet, original, checked) {
+		problems = append(problems, snippetPosition(fset.Position(mismatch.pos), hasPackage, "interface", mismatch.message))
+	}
+
+	// Problems in the snippet come first.
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i], problems[j]
+		if (a.File == name) != (b.File == name) {
+			return a.File == name
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return problems, nil
+}
+
+// packageFiles parses the non-test Go files of the package in dir that the
+// default build includes. The snippet may be one of them, or lie in dir
+// without being part of the package; either way it is left out.
+func packageFiles(fset *token.FileSet, dir, snippetName string) ([]*ast.File, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading package: %w", err)
+	}
+	snippetPath, _ := filepath.Abs(snippetName)
+	var files []*ast.File
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		filePath := filepath.Join(dir, name)
+		if abs, _ := filepath.Abs(filePath); abs == snippetPath {
+			continue
+		}
+		if match, err := build.Default.MatchFile(dir, name); err != nil || !match {
+			continue
+		}
+		// Files without a package clause, such as saved snippets, are not
+		// part of the package.
+		if _, err := parser.ParseFile(token.NewFileSet(), filePath, nil, parser.PackageClauseOnly); err != nil {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filePath, nil, 0)
+		if err != nil {
+			return nil, withExitCode(exitParseError, fmt.Errorf("parsing package file: %w", err))
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, withExitCode(exitPathNotFound, fmt.Errorf("no Go files in '%s'", dir))
+	}
+	return files, nil
+}
+
+// snippetPosition makes a problem at a position of the snippet, undoing the
+// shift of a package clause added in front of it.
+func snippetPosition(position token.Position, hasPackage bool, kind, message string) snippetProblem {
+	if !hasPackage && position.Line == 1 {
+		position.Column -= len(snippetPackageClause)
+	}
+	return snippetProblem{File: position.Filename, Line: position.Line, Column: position.Column, Kind: kind, Message: message}
+}
+
+// typeErrorKind classifies a go/types error message.
+func typeErrorKind(msg string) string {
+	switch {
+	case strings.HasPrefix(msg, "undefined: ") || strings.Contains(msg, " undefined (type "):
+		return "undefined"
+	case strings.Contains(msg, "imported and not used") || strings.Contains(msg, "imported as ") && strings.HasSuffix(msg, "and not used"):
+		return "unused import"
+	case strings.Contains(msg, "declared and not used"):
+		return "unused variable"
+	case strings.Contains(msg, "does not implement") || strings.Contains(msg, "(missing method ") || strings.Contains(msg, "(wrong type for method "):
+		return "interface"
+	}
+	return "compile"
+}
+
+// problemMessage drops the part of a go/types message that only repeats its
+// kind, which is printed in front of it.
+func problemMessage(kind, msg string) string {
+	switch kind {
+	case "undefined":
+		if name, ok := strings.CutPrefix(msg, "undefined: "); ok {
+			return name
+		}
+		return strings.Replace(msg, " undefined (", " (", 1)
+	case "unused import":
+		return strings.TrimSuffix(msg, " imported and not used")
+	case "unused variable":
+		return strings.TrimSuffix(strings.TrimPrefix(msg, "declared and not used: "), " declared and not used")
+	}
+	return msg
+}
+
+// snippetNames returns the names the snippet declares at the top level. init
+// and _ are left out, as they can be declared any number of times.
+func snippetNames(file *ast.File) map[string]bool {
+	names := make(map[string]bool)
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			names[declName(d)] = true
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					names[s.Name.Name] = true
+				case *ast.ValueSpec:
+					for _, id := range s.Names {
+						names[id.Name] = true
+					}
+				}
+			}
+		}
+	}
+	delete(names, "init")
+	delete(names, "_")
+	return names
+}
+
+// withoutDecls returns a copy of file without the top-level declarations
+// named in names. A spec declaring several names goes when any of them is
+// named.
+func withoutDecls(file *ast.File, names map[string]bool) *ast.File {
+	copied := *file
+	copied.Decls = nil
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if names[declName(d)] {
+				continue
+			}
+		case *ast.GenDecl:
+			var specs []ast.Spec
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if names[s.Name.Name] {
+						continue
+					}
+				case *ast.ValueSpec:
+					if anyNamed(s.Names, names) {
+						continue
+					}
+				}
+				specs = append(specs, spec)
+			}
+			if len(specs) == 0 {
+				continue
+			}
+			gen := *d
+			gen.Specs = specs
+			decl = &gen
+		}
+		copied.Decls = append(copied.Decls, decl)
+	}
+	return &copied
+}
+
+// anyNamed reports whether any of ids is named in names.
+func anyNamed(ids []*ast.Ident, names map[string]bool) bool {
+	for _, id := range ids {
+		if names[id.Name] {
+			return true
+		}
+	}
+	return false
+}
+
+type interfaceMismatch struct {
+	pos     token.Pos
+	message string
+}
+
+// interfaceMismatches finds the methods of the snippet whose signature
+// differs from the method of the same name in an interface of the package
+// that their type implemented before.
+func interfaceMismatches(snippet *ast.File, original, pkg *types.Package) []interfaceMismatch {
+	if original == nil || pkg == nil {
+		return nil
+	}
+	scope := pkg.Scope()
+	var interfaces []*types.TypeName
+	for _, name := range scope.Names() {
+		if typeName, ok := scope.Lookup(name).(*types.TypeName); ok {
+			if _, ok := typeName.Type().Underlying().(*types.Interface); ok && !typeName.IsAlias() {
+				interfaces = append(interfaces, typeName)
+			}
+		}
+	}
+	qualifier := types.RelativeTo(pkg)
+
+	var mismatches []interfaceMismatch
+	for _, decl := range snippet.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil {
+			continue
+		}
+		recv := strings.TrimSuffix(declName(fn), "."+fn.Name.Name)
+		typeName, ok := scope.Lookup(recv).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		have, _, _ := types.LookupFieldOrMethod(types.NewPointer(typeName.Type()), true, pkg, fn.Name.Name)
+		if have == nil {
+			continue
+		}
+		for _, iface := range interfaces {
+			if !implemented(original, recv, iface.Name()) {
+				continue
+			}
+			underlying := iface.Type().Underlying().(*types.Interface)
+			want, _, _ := types.LookupFieldOrMethod(underlying, false, pkg, fn.Name.Name)
+			if want == nil || types.Identical(have.Type(), want.Type()) {
+				continue
+			}
+			mismatches = append(mismatches, interfaceMismatch{
+				pos: fn.Name.Pos(),
+				message: fmt.Sprintf("%s.%s no longer matches interface %s: have %s, want %s",
+					recv, fn.Name.Name, iface.Name(),
+					strings.TrimPrefix(types.TypeString(have.Type(), qualifier), "func"),
+					strings.TrimPrefix(types.TypeString(want.Type(), qualifier), "func")),
+			})
+		}
+	}
+	return mismatches
+}
+
+// implemented reports whether the named type, or a pointer to it, implements
+// the named interface in pkg.
+func implemented(pkg *types.Package, typeName, ifaceName string) bool {
+	typ, ok := pkg.Scope().Lookup(typeName).(*types.TypeName)
+	if !ok {
+		return false
+	}
+	iface, ok := pkg.Scope().Lookup(ifaceName).(*types.TypeName)
+	if !ok {
+		return false
+	}
+	underlying, ok := iface.Type().Underlying().(*types.Interface)
+	return ok && types.Implements(types.NewPointer(typ.Type()), underlying)
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const shapesPackage = `package shapes
+
+import "fmt"
+
+// Shape has an area.
+type Shape interface {
+	Area() float64
+}
+
+type Square struct{ Side float64 }
+
+func (s Square) Area() float64 { return s.Side * s.Side }
+
+var _ Shape = Square{}
+
+func Describe(s Shape) string { return fmt.Sprint(s.Area()) }
+`
+
+func TestCheckSnippet(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":    "module example.com/shapes\n\ngo 1.21\n",
+		"shapes.go": shapesPackage,
+		"notes.go":  "func Draft() {}\n",
+		"sizes.go":  "package shapes\n\nvar width, height = 1.0, 2.0\n",
+	})
+
+	testCases := []struct {
+		name    string
+		snippet string
+		want    []string
+	}{
+		{
+			name:    "Test with a valid snippet replacing a method",
+			snippet: "```go\n// Area is the area of s.\nfunc (s Square) Area() float64 { return s.Side * s.Side }\n```\n",
+		},
+		{
+			name:    "Test with a variable declared together with another",
+			snippet: "var height = 3.0\n",
+		},
+		{
+			name:    "Test with undefined identifiers and unused imports",
+			snippet: "package shapes\n\nimport \"strings\"\n\nfunc Double(s Square) Square {\n\treturn Square{s.Sidez * float64(os.Getpid())}\n}\n",
+			want: []string{
+				`snippet.go:3:8: unused import: "strings"`,
+				"snippet.go:6:18: undefined: s.Sidez (type Square has no field or method Sidez)",
+				"snippet.go:6:34: undefined: os",
+			},
+		},
+		{
+			name:    "Test with an unused variable",
+			snippet: "func Local() {\n\tx := 1\n}\n",
+			want:    []string{"snippet.go:2:2: unused variable: x"},
+		},
+		{
+			name:    "Test with a method that no longer matches an interface",
+			snippet: "func (s Square) Area() int { return int(s.Side) }\n",
+			want: []string{
+				"snippet.go:1:17: interface: Square.Area no longer matches interface Shape: have () int, want () float64",
+				"shapes.go:14:15: interface: cannot use Square{} (value of struct type Square) as Shape value in variable declaration: Square does not implement Shape (wrong type for method Area); have Area() int; want Area() float64",
+			},
+		},
+		{
+			name:    "Test with a syntax error on the first line",
+			snippet: "func Broken( {\n",
+			want:    []string{"snippet.go:1:14: syntax: expected ')', found '{'"},
+		},
+		{
+			name:    "Test with another package clause",
+			snippet: "package circle\n\nfunc Round() {}\n",
+			want:    []string{"snippet.go:1:9: compile: package circle does not match package shapes in DIR"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			problems, err := checkSnippet(dir, "snippet.go", []byte(tc.snippet))
+			if err != nil {
+				t.Fatalf("checkSnippet() error = %v", err)
+			}
+			var got []string
+			for _, problem := range problems {
+				problem.File = filepath.Base(problem.File)
+				got = append(got, strings.ReplaceAll(problem.String(), dir, "DIR"))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %v, but got %v (%v)", tc.want, got, problems)
+			}
+		})
+	}
+}
+
+func TestTypeErrorKind(t *testing.T) {
+	testCases := map[string]string{
+		"undefined: foo": "undefined",
+		"x.Foo undefined (type T has no field or method Foo)": "undefined",
+		`"strings" imported and not used`:                     "unused import",
+		`"math/rand" imported as r and not used`:              "unused import",
+		"declared and not used: x":                            "unused variable",
+		"cannot use t (variable of type T) as I value in argument: T does not implement I (missing method M)": "interface",
+		"too many return values": "compile",
+	}
+	for msg, want := range testCases {
+		if got := typeErrorKind(msg); got != want {
+			t.Errorf("typeErrorKind(%q): expected %s, but got %s", msg, want, got)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const configFileName = ".gosymex.yaml"
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the project configuration file",
+	Long: `Flag defaults can be kept in a .gosymex.yaml file, found by walking up from
+the working directory or given with --config. Flags given on the command line
+always take precedence over the file.`,
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show [command]",
+	Short: "Print the effective configuration, or the effective flags of a command",
+	Example: `  gosymex config show
+  gosymex --profile ci config show graph imports`,
+	RunE: runConfigShowCmd,
+}
+
+var (
+	configPath    string
+	configProfile string
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Config file (default is the nearest "+configFileName+" at or above the working directory)")
+	rootCmd.PersistentFlags().StringVar(&configProfile, "profile", "", "Apply this named profile of the config file")
+
+	configCmd.AddCommand(configShowCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// configSettings are flag defaults. Flags apply to every command that has
+// the flag; Commands apply to a single command, keyed by its path below
+// gosymex such as "graph imports". Keys are flag names without dashes.
+type configSettings struct {
+	Flags    map[string]interface{}            `yaml:"flags,omitempty"`
+	Commands map[string]map[string]interface{} `yaml:"commands,omitempty"`
+}
+
+// projectConfig is the content of a config file. A profile's settings are
+// applied on top of the top-level ones.
+type projectConfig struct {
+	Path           string `yaml:"-"`
+	configSettings `yaml:",inline"`
+	Profiles       map[string]configSettings `yaml:"profiles,omitempty"`
+}
+
+// findConfigFile walks up from dir and returns the first config file it
+// finds, or "" when there is none.
+func findConfigFile(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	for {
+		configFile := filepath.Join(dir, configFileName)
+		if _, err := os.Stat(configFile); err == nil {
+			return configFile
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadProjectConfig reads the config file selected by --config, or the one
+// found from the working directory. It returns nil when there is none.
+func loadProjectConfig() (*projectConfig, error) {
+	configFile := configPath
+	if configFile == "" {
+		configFile = findConfigFile(".")
+	}
+	if configFile == "" {
+		if configProfile != "" {
+			return nil, fmt.Errorf("profile '%s' requested but no %s found", configProfile, configFileName)
+		}
+		return nil, nil
+	}
+	return readConfigFile(configFile)
+}
+
+// readConfigFile parses and validates a config file.
+func readConfigFile(configFile string) (*projectConfig, error) {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+
+	config := &projectConfig{Path: configFile}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing config %s: %w", configFile, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("config %s: %w", configFile, err)
+	}
+	return config, nil
+}
+
+// validate checks that every command and flag the config names exists, so
+// that typos do not go unnoticed.
+func (c *projectConfig) validate() error {
+	all := map[string]configSettings{"": c.configSettings}
+	for name, profile := range c.Profiles {
+		all[name] = profile
+	}
+	for profile, settings := range all {
+		where := ""
+		if profile != "" {
+			where = fmt.Sprintf(" in profile '%s'", profile)
+		}
+		for name := range settings.Flags {
+			if err := checkConfigFlag(name, flagDefined(rootCmd, name)); err != nil {
+				return fmt.Errorf("%w%s", err, where)
+			}
+		}
+		for key, flags := range settings.Commands {
+			cmd := findConfigCommand(key)
+			if cmd == nil {
+				return fmt.Errorf("unknown command '%s'%s", key, where)
+			}
+			for name := range flags {
+				if err := checkConfigFlag(name, commandFlag(cmd, name) != nil); err != nil {
+					return fmt.Errorf("%w for '%s'%s", err, key, where)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func checkConfigFlag(name string, defined bool) error {
+	switch {
+	case name == "config" || name == "profile":
+		return fmt.Errorf("flag '%s' cannot be set in the config file", name)
+	case !defined:
+		return fmt.Errorf("unknown flag '%s'", name)
+	}
+	return nil
+}
+
+// findConfigCommand returns the command with the given path below the root.
+func findConfigCommand(key string) *cobra.Command {
+	cmd, rest, err := rootCmd.Find(strings.Fields(key))
+	if err != nil || len(rest) > 0 || cmd == rootCmd {
+		return nil
+	}
+	return cmd
+}
+
+// commandKey is the key of cmd under commands: in the config file.
+func commandKey(cmd *cobra.Command) string {
+	return strings.TrimPrefix(strings.TrimPrefix(cmd.CommandPath(), rootCmd.Name()), " ")
+}
+
+// commandFlag looks up a flag of cmd, including those inherited from its
+// parents.
+func commandFlag(cmd *cobra.Command, name string) *pflag.Flag {
+	if flag := cmd.Flags().Lookup(name); flag != nil {
+		return flag
+	}
+	return cmd.InheritedFlags().Lookup(name)
+}
+
+// flagDefined reports whether any command in the tree has the flag.
+func flagDefined(cmd *cobra.Command, name string) bool {
+	if commandFlag(cmd, name) != nil {
+		return true
+	}
+	for _, child := range cmd.Commands() {
+		if flagDefined(child, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// layers returns the settings that apply to a command, lowest precedence
+// first: top-level flags, top-level command flags, then the same two of the
+// profile.
+func (c *projectConfig) layers(profile, key string) ([]map[string]interface{}, []string, error) {
+	values := []map[string]interface{}{c.Flags, c.Commands[key]}
+	sources := []string{"config", "config"}
+	if profile == "" {
+		return values, sources, nil
+	}
+	settings, ok := c.Profiles[profile]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown profile '%s' in %s", profile, c.Path)
+	}
+	source := "profile " + profile
+	return append(values, settings.Flags, settings.Commands[key]), append(sources, source, source), nil
+}
+
+// apply sets the flags of cmd that were not given on the command line from
+// the config. It returns where each flag it set came from.
+func (c *projectConfig) apply(cmd *cobra.Command, profile string) (map[string]string, error) {
+	values, sources, err := c.layers(profile, commandKey(cmd))
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[string]string)
+	for i, layer := range values {
+		names := make([]string, 0, len(layer))
+		for name := range layer {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			flag := commandFlag(cmd, name)
+			if flag == nil || flag.Changed {
+				continue
+			}
+			if err := setFlagValue(flag, layer[name]); err != nil {
+				return nil, fmt.Errorf("config %s: %w", c.Path, err)
+			}
+			applied[name] = sources[i]
+		}
+	}
+	return applied, nil
+}
+
+// setFlagValue sets a flag from a YAML value. Lists replace the value of
+// slice flags; anything else is parsed as on the command line.
+func setFlagValue(flag *pflag.Flag, value interface{}) error {
+	slice, isSlice := flag.Value.(pflag.SliceValue)
+	switch v := value.(type) {
+	case nil:
+		return fmt.Errorf("flag '%s' has no value", flag.Name)
+	case []interface{}:
+		if !isSlice {
+			return fmt.Errorf("flag '%s' takes a single value, not a list", flag.Name)
+		}
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		return slice.Replace(items)
+	default:
+		if isSlice {
+			return slice.Replace([]string{fmt.Sprint(v)})
+		}
+		if err := flag.Value.Set(fmt.Sprint(v)); err != nil {
+			return fmt.Errorf("flag '%s': %w", flag.Name, err)
+		}
+	}
+	return nil
+}
+
+// applyProjectConfig fills in the flags of the command about to run.
+func applyProjectConfig(cmd *cobra.Command) error {
+	config, err := loadProjectConfig()
+	if err != nil || config == nil {
+		return err
+	}
+	_, err = config.apply(cmd, configProfile)
+	return err
+}
+
+// effective merges a profile into the top-level settings.
+func (c *projectConfig) effective(profile string) (configSettings, error) {
+	merged := configSettings{Flags: make(map[string]interface{}), Commands: make(map[string]map[string]interface{})}
+	layers := []configSettings{c.configSettings}
+	if profile != "" {
+		settings, ok := c.Profiles[profile]
+		if !ok {
+			return merged, fmt.Errorf("unknown profile '%s' in %s", profile, c.Path)
+		}
+		layers = append(layers, settings)
+	}
+	for _, layer := range layers {
+		for name, value := range layer.Flags {
+			merged.Flags[name] = value
+		}
+		for key, flags := range layer.Commands {
+			if merged.Commands[key] == nil {
+				merged.Commands[key] = make(map[string]interface{})
+			}
+			for name, value := range flags {
+				merged.Commands[key][name] = value
+			}
+		}
+	}
+	return merged, nil
+}
+
+func runConfigShowCmd(cmd *cobra.Command, args []string) error {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		if config == nil {
+			fmt.Printf("# No %s found\n", configFileName)
+			return nil
+		}
+		settings, err := config.effective(configProfile)
+		if err != nil {
+			return err
+		}
+		out, err := yaml.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("# %s\n", config.Path)
+		if configProfile != "" {
+			fmt.Printf("# profile: %s\n", configProfile)
+		}
+		fmt.Print(string(out))
+		return nil
+	}
+
+	key := strings.Join(args, " ")
+	target := findConfigCommand(key)
+	if target == nil {
+		return withExitCode(exitUsage, fmt.Errorf("unknown command '%s'", key))
+	}
+	applied := make(map[string]string)
+	if config != nil {
+		if applied, err = config.apply(target, configProfile); err != nil {
+			return err
+		}
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleLight)
+	t.AppendHeader(table.Row{"Flag", "Value", "Source"})
+	flags := target.Flags()
+	flags.AddFlagSet(target.InheritedFlags())
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Name == "help" {
+			return
+		}
+		source, ok := applied[flag.Name]
+		switch {
+		case flag.Changed:
+			source = "command line"
+		case !ok:
+			source = "default"
+		}
+		t.AppendRow(table.Row{flag.Name, flag.Value.String(), source})
+	})
+	t.Render()
+	return nil
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestProjectConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		configFileName: `flags:
+  include-tests: true
+  exclude: ["**/*_gen.go"]
+commands:
+  graph imports:
+    format: mermaid
+profiles:
+  ci:
+    flags:
+      exclude: [vendor, "*.pb.go"]
+    commands:
+      graph imports:
+        format: json
+`,
+		"a/b/c.go": "package b\n",
+	})
+
+	if got, want := findConfigFile(filepath.Join(dir, "a", "b")), filepath.Join(dir, configFileName); got != want {
+		t.Errorf("findConfigFile() = %s, want %s", got, want)
+	}
+	config, err := readConfigFile(filepath.Join(dir, configFileName))
+	if err != nil {
+		t.Fatalf("readConfigFile() error = %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		profile string
+		args    []string
+		format  string
+		exclude []string
+	}{
+		{name: "Test with the top-level settings", format: "mermaid", exclude: []string{"**/*_gen.go"}},
+		{name: "Test with a profile", profile: "ci", format: "json", exclude: []string{"vendor", "*.pb.go"}},
+		{name: "Test with command line flags", profile: "ci", args: []string{"--format", "dot", "--exclude", "x"}, format: "dot", exclude: []string{"x"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// A detached copy of the graph imports command, so the
+			// real flags keep their defaults.
+			root := &cobra.Command{Use: "gosymex"}
+			graph := &cobra.Command{Use: "graph"}
+			imports := &cobra.Command{Use: "imports"}
+			addWalkFlags(imports)
+			imports.Flags().String("format", "dot", "")
+			graph.AddCommand(imports)
+			root.AddCommand(graph)
+			if err := imports.ParseFlags(tc.args); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := config.apply(imports, tc.profile); err != nil {
+				t.Fatalf("apply() error = %v", err)
+			}
+			format, _ := imports.Flags().GetString("format")
+			opts := walkOptionsFromFlags(imports)
+			if format != tc.format || !opts.IncludeTests || !reflect.DeepEqual(opts.Exclude, tc.exclude) {
+				t.Errorf("Expected format %s and exclude %v with tests, but got %s, %v, %v", tc.format, tc.exclude, format, opts.Exclude, opts.IncludeTests)
+			}
+		})
+	}
+
+	if _, err := config.apply(&cobra.Command{Use: "x"}, "nope"); err == nil {
+		t.Errorf("Expected an error for an unknown profile")
+	}
+}
+
+func TestReadConfigFileInvalid(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+	}{
+		{"Test with an unknown key", "flag:\n  include-tests: true\n"},
+		{"Test with an unknown flag", "flags:\n  include-test: true\n"},
+		{"Test with an unknown command", "commands:\n  graph import:\n    format: dot\n"},
+		{"Test with a flag the command lacks", "commands:\n  describe:\n    format: dot\n"},
+		{"Test with the profile flag", "profiles:\n  ci:\n    flags:\n      profile: chat\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, map[string]string{configFileName: tc.content})
+			if _, err := readConfigFile(filepath.Join(dir, configFileName)); err == nil {
+				t.Errorf("Expected an error for %q", tc.content)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"bufio"
+	"go/build"
+	"go/build/constraint"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// knownOS and knownArch are the GOOS and GOARCH values the go command
+// recognises in file name suffixes such as foo_linux_amd64.go.
+var knownOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true,
+	"hurd": true, "illumos": true, "ios": true, "js": true, "linux": true, "nacl": true,
+	"netbsd": true, "openbsd": true, "plan9": true, "solaris": true, "wasip1": true,
+	"windows": true, "zos": true,
+}
+
+var knownArch = map[string]bool{
+	"386": true, "amd64": true, "amd64p32": true, "arm": true, "armbe": true, "arm64": true,
+	"arm64be": true, "loong64": true, "mips": true, "mipsle": true, "mips64": true,
+	"mips64le": true, "mips64p32": true, "mips64p32le": true, "ppc": true, "ppc64": true,
+	"ppc64le": true, "riscv": true, "riscv64": true, "s390": true, "s390x": true,
+	"sparc": true, "sparc64": true, "wasm": true,
+}
+
+// addConstraintFlags registers the flags that select a build configuration.
+func addConstraintFlags(cmd *cobra.Command) {
+	cmd.Flags().String("goos", "", "Only include files built for this GOOS (default is the host when any build flag is set)")
+	cmd.Flags().String("goarch", "", "Only include files built for this GOARCH (default is the host when any build flag is set)")
+	cmd.Flags().StringSlice("tags", nil, "Only include files satisfied by these build tags")
+}
+
+// constrained reports whether the walk should evaluate build constraints.
+// Without any of the build flags every file is visited, as before.
+func (opts walkOptions) constrained() bool {
+	return opts.GOOS != "" || opts.GOARCH != "" || len(opts.Tags) > 0
+}
+
+// buildContext returns the build configuration selected by opts.
+func (opts walkOptions) buildContext() *build.Context {
+	ctx := build.Default
+	if opts.GOOS != "" {
+		ctx.GOOS = opts.GOOS
+	}
+	if opts.GOARCH != "" {
+		ctx.GOARCH = opts.GOARCH
+	}
+	ctx.BuildTags = opts.Tags
+	return &ctx
+}
+
+// matchesBuild reports whether the file is part of the selected build.
+func (opts walkOptions) matchesBuild(filePath string) bool {
+	if !opts.constrained() {
+		return true
+	}
+	match, err := opts.buildContext().MatchFile(filepath.Dir(filePath), filepath.Base(filePath))
+	return err == nil && match
+}
+
+// fileConstraint returns the build constraint a file is compiled under,
+// combining its file name suffixes with its //go:build (or legacy +build)
+// lines. It returns an empty string for unconstrained files.
+func fileConstraint(filePath string) (string, error) {
+	var exprs []constraint.Expr
+	for _, tag := range filenameTags(filepath.Base(filePath)) {
+		exprs = append(exprs, &constraint.TagExpr{Tag: tag})
+	}
+
+	expr, err := buildLineConstraint(filePath)
+	if err != nil {
+		return "", err
+	}
+	if expr != nil {
+		exprs = append(exprs, expr)
+	}
+
+	if len(exprs) == 0 {
+		return "", nil
+	}
+	combined := exprs[0]
+	for _, next := range exprs[1:] {
+		combined = &constraint.AndExpr{X: combined, Y: next}
+	}
+	return combined.String(), nil
+}
+
+// filenameTags returns the GOOS and GOARCH implied by a file name, following
+// the rules of the go command: the suffixes only count after the first
+// underscore, and _test is ignored.
+func filenameTags(name string) []string {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	name = strings.TrimSuffix(name, "_test")
+	i := strings.Index(name, "_")
+	if i < 0 {
+		return nil
+	}
+
+	parts := strings.Split(name[i:], "_")
+	n := len(parts)
+	switch {
+	case n >= 2 && knownOS[parts[n-2]] && knownArch[parts[n-1]]:
+		return []string{parts[n-2], parts[n-1]}
+	case knownOS[parts[n-1]] || knownArch[parts[n-1]]:
+		return []string{parts[n-1]}
+	}
+	return nil
+}
+
+// buildLineConstraint parses the build constraint lines in the file header.
+// A //go:build line takes precedence over +build lines, as in the go command.
+func buildLineConstraint(filePath string) (constraint.Expr, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var plusBuild []constraint.Expr
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+		switch {
+		case constraint.IsGoBuild(line):
+			return constraint.Parse(line)
+		case constraint.IsPlusBuild(line):
+			expr, err := constraint.Parse(line)
+			if err != nil {
+				return nil, err
+			}
+			plusBuild = append(plusBuild, expr)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(plusBuild) == 0 {
+		return nil, nil
+	}
+	combined := plusBuild[0]
+	for _, next := range plusBuild[1:] {
+		combined = &constraint.AndExpr{X: combined, Y: next}
+	}
+	return combined, nil
+}
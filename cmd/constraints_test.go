@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFileConstraint(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"plain.go":            "package p\n",
+		"file_linux.go":       "package p\n",
+		"file_linux_arm64.go": "package p\n",
+		"linux.go":            "package p\n",
+		"tagged_windows.go":   "//go:build integration || e2e\n\npackage p\n",
+		"legacy.go":           "// +build darwin,cgo\n\npackage p\n",
+		"late.go":             "package p\n\n//go:build ignored\n",
+	})
+
+	// Define a table of test cases
+	testCases := []struct {
+		name string
+		file string
+		want string
+	}{
+		{name: "Test with an unconstrained file", file: "plain.go", want: ""},
+		{name: "Test with a GOOS suffix", file: "file_linux.go", want: "linux"},
+		{name: "Test with GOOS and GOARCH suffixes", file: "file_linux_arm64.go", want: "linux && arm64"},
+		{name: "Test with a GOOS name but no suffix", file: "linux.go", want: ""},
+		{name: "Test with a suffix and a go:build line", file: "tagged_windows.go", want: "windows && (integration || e2e)"},
+		{name: "Test with a legacy +build line", file: "legacy.go", want: "darwin && cgo"},
+		{name: "Test with a constraint after the package clause", file: "late.go", want: ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			got, err := fileConstraint(filepath.Join(dir, testCase.file))
+			if err != nil {
+				t.Fatalf("fileConstraint() error = %v", err)
+			}
+			if got != testCase.want {
+				t.Errorf("fileConstraint() = %q, want %q", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestWalkGoFilesBuildConstraints(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"common.go":      "package p\n",
+		"foo_linux.go":   "package p\n",
+		"foo_windows.go": "package p\n",
+		"integration.go": "//go:build integration\n\npackage p\n",
+	})
+
+	// Define a table of test cases
+	testCases := []struct {
+		name string
+		opts walkOptions
+		want []string
+	}{
+		{
+			name: "Test without build flags",
+			opts: walkOptions{},
+			want: []string{"common.go", "foo_linux.go", "foo_windows.go", "integration.go"},
+		},
+		{
+			name: "Test with a GOOS",
+			opts: walkOptions{GOOS: "windows", GOARCH: "amd64"},
+			want: []string{"common.go", "foo_windows.go"},
+		},
+		{
+			name: "Test with a GOOS and tags",
+			opts: walkOptions{GOOS: "linux", GOARCH: "amd64", Tags: []string{"integration"}},
+			want: []string{"common.go", "foo_linux.go", "integration.go"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var got []string
+			err := walkGoFiles(dir, testCase.opts, func(filePath string, info os.FileInfo) error {
+				got = append(got, filepath.Base(filePath))
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("walkGoFiles() error = %v", err)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, testCase.want) {
+				t.Errorf("walkGoFiles() = %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
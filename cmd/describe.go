@@ -6,87 +6,130 @@ import (
 	"fmt"
 	"go/ast"
 	"go/parser"
+	"go/scanner"
 	"go/token"
 	"go/types"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 var describeCmd = &cobra.Command{
-	Use:   "describe",
+	Use:   "describe <filepath or directory>",
 	Short: "Describe a Go file",
 	Long:  `This command describes a Go file and prints out its details.`,
-	Run:   runDescribeCmd,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runDescribeCmd,
 }
 
 func init() {
-	describeCmd.Flags().BoolP("include-tests", "t", false, "Include test files in the recursive describe")
-	describeCmd.Flags().BoolP("include-mocks", "m", false, "Include mock files in the recursive describe")
+	addWalkFlags(describeCmd)
+	describeCmd.Flags().Bool("no-cache", false, "Do not read or write the extraction cache")
+	describeCmd.Flags().BoolP("watch", "w", false, "Keep running and re-describe files as they change, one JSON document per line")
+	describeCmd.Flags().Duration("watch-interval", time.Second, "How often to poll for changes in watch mode")
+	describeCmd.Flags().Bool("watch-events", false, "In watch mode, emit added/removed/changed symbol events instead of whole files")
+	describeCmd.Flags().Bool("constraints", false, "Annotate each file's symbols with the build constraint they are defined under")
+	describeCmd.Flags().Bool("metrics", false, "Add size and complexity metrics for each function")
+	describeCmd.Flags().Bool("tolerant", false, "Describe files with syntax errors, listing the errors and the symbols they damaged")
 	rootCmd.AddCommand(describeCmd)
 }
 
-func runDescribeCmd(cmd *cobra.Command, args []string) {
-	if len(args) != 1 {
-		fmt.Println("Usage: gosymex describe <filepath or directory>")
-		return
-	}
-
+func runDescribeCmd(cmd *cobra.Command, args []string) error {
 	path := args[0]
 	fileInfo, err := os.Stat(path)
 	if err != nil {
-		fmt.Println("Error accessing path:", err)
-		return
+		return fmt.Errorf("accessing path: %w", err)
+	}
+
+	opts := walkOptionsFromFlags(cmd)
+	var describeOpts describeOptions
+	describeOpts.Constraints, _ = cmd.Flags().GetBool("constraints")
+	describeOpts.Tolerant, _ = cmd.Flags().GetBool("tolerant")
+	describeOpts.Metrics, _ = cmd.Flags().GetBool("metrics")
+	noCache, _ := cmd.Flags().GetBool("no-cache")
+
+	if !noCache {
+		describeCache, err = newExtractCache(cacheDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Cache disabled:", err)
+		}
 	}
 
-	includeTests, _ := cmd.Flags().GetBool("include-tests")
-	includeMocks, _ := cmd.Flags().GetBool("include-mocks")
+	if watch, _ := cmd.Flags().GetBool("watch"); watch {
+		interval, _ := cmd.Flags().GetDuration("watch-interval")
+		events, _ := cmd.Flags().GetBool("watch-events")
+		return runDescribeWatch(path, interval, events, opts, describeOpts)
+	}
 
+	out := newDescribeOutput(opts, describeOpts)
 	if fileInfo.IsDir() {
-		processDirectory(path, includeTests, includeMocks)
+		err = processDirectory(path, opts, describeOpts, out)
+	} else if details, derr := describeDetails(path, describeOpts); derr != nil {
+		out.addError(path, derr)
+		err = fmt.Errorf("describing %s: %w", path, derr)
 	} else {
-		describeFile(path)
+		out.Files = append(out.Files, details)
 	}
+
+	jsonOutput, _ := json.MarshalIndent(out, "", "  ")
+	fmt.Println(string(jsonOutput))
+	return err
+}
+
+// describeOptions are the settings of a describe run that shape its output.
+type describeOptions struct {
+	Constraints bool
+	Tolerant    bool
+	Metrics     bool
 }
 
-func processDirectory(path string, includeTests bool, includeMocks bool) {
-	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+// processDirectory describes every Go file under path into out. A file that
+// fails does not stop the walk; it is recorded in out and the returned error
+// tells whether some or all files failed.
+func processDirectory(path string, opts walkOptions, describeOpts describeOptions, out *describeOutput) error {
+	var failures fileFailures
+	err := walkGoFiles(path, opts, func(filePath string, info os.FileInfo) error {
+		details, err := describeDetails(filePath, describeOpts)
+		failures.add(err)
 		if err != nil {
-			return err
-		}
-		if isGoFile(filePath, info, includeTests, includeMocks) {
-			describeFile(filePath)
+			reportFileError(filePath, err)
+			out.addError(filePath, err)
+			return nil
 		}
+		out.Files = append(out.Files, details)
 		return nil
 	})
 	if err != nil {
-		fmt.Println("Error walking the directory:", err)
+		return fmt.Errorf("walking the directory: %w", err)
 	}
+	return failures.err()
 }
 
-func isGoFile(filePath string, info os.FileInfo, includeTests bool, includeMocks bool) bool {
-	return !info.IsDir() && strings.HasSuffix(filePath, ".go") && (includeTests || !strings.HasSuffix(filePath, "_test.go")) && (includeMocks || !strings.HasSuffix(filePath, "_mock.go"))
+func isGoFile(filePath string, info os.FileInfo, includeTests bool) bool {
+	return !info.IsDir() && strings.HasSuffix(filePath, ".go") && (includeTests || !strings.HasSuffix(filePath, "_test.go"))
 }
 
+var errNotGoFile = errors.New("not a Go file")
+
 func describeFile(filePath string) (string, error) {
-	// Check if the file is a Go file
-	if filepath.Ext(filePath) != ".go" {
-		// If not, return a JSON object with an error field
-		return `{"error":"not a Go file"}`, errors.New("not a Go file")
-	}
+	return describeFileWith(filePath, describeOptions{})
+}
 
-	// Parse the Go file at the given path
-	node, err := parseFile(filePath)
+// describeFileWith describes a Go file and returns its details as JSON.
+func describeFileWith(filePath string, opts describeOptions) (string, error) {
+	details, err := describeDetails(filePath, opts)
+	if errors.Is(err, errNotGoFile) {
+		// If not a Go file, return a JSON object with an error field
+		return `{"error":"not a Go file"}`, err
+	}
 	if err != nil {
 		// If there's an error, return an empty string and the error
-		return "", fmt.Errorf("Error parsing file: %v", err)
+		return "", err
 	}
 
-	// Inspect the AST of the Go file and get its details
-	details := inspectFile(filePath, node)
-
 	// Marshal the details into a JSON string
 	jsonDetails, _ := json.MarshalIndent(details, "", "  ")
 
@@ -94,22 +137,129 @@ func describeFile(filePath string) (string, error) {
 	return string(jsonDetails), nil
 }
 
+// describeDetails extracts the details of a Go file and applies the
+// describe options to them.
+func describeDetails(filePath string, opts describeOptions) (*FileDetails, error) {
+	// Check if the file is a Go file
+	if filepath.Ext(filePath) != ".go" {
+		return nil, errNotGoFile
+	}
+
+	// Parse the Go file at the given path and inspect its AST
+	details, err := extractFile(filePath, opts)
+	if err != nil {
+		return nil, fmt.Errorf("parsing file: %w", err)
+	}
+
+	if opts.Constraints {
+		constraint, err := fileConstraint(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("reading build constraints: %w", err)
+		}
+		details.Constraint = constraint
+	}
+	return details, nil
+}
+
 type FileDetails struct {
-	FilePath   string
-	Imports    []string
-	Structs    map[string][]string
-	Interfaces map[string][]string
-	Funcs      []string
+	FilePath     string
+	Imports      []string
+	Structs      map[string][]string
+	Interfaces   map[string][]string
+	Funcs        []string
+	Constraint   string              `json:",omitempty"`
+	Mocks        map[string]string   `json:",omitempty"` // mock type -> interface it implements
+	SyntaxErrors []SyntaxError       `json:",omitempty"`
+	Incomplete   []string            `json:",omitempty"` // symbols whose declarations contain syntax errors
+	Metrics      []FuncMetrics       `json:",omitempty"`
+	Embeds       map[string][]string `json:",omitempty"` // struct or interface -> embedded types
+}
+
+// bodyAnalysis inspects the body of a function declaration. Extraction only
+// descends into function bodies when at least one analysis asks for them.
+type bodyAnalysis func(fn *ast.FuncDecl, details *FileDetails)
+
+// extractFile parses and inspects the Go file at the given path. When
+// describeCache is set, results are served from and written to the cache.
+func extractFile(filePath string, opts describeOptions) (*FileDetails, error) {
+	if describeCache == nil {
+		return extractSource(filePath, nil, opts)
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	hash := contentHash(content)
+	if details, ok := describeCache.load(filePath, hash, opts.Metrics); ok {
+		return details, nil
+	}
+
+	details, err := extractSource(filePath, content, opts)
+	if err != nil {
+		return nil, err
+	}
+	// Files with syntax errors are not cached: a strict run must still
+	// reject them.
+	if len(details.SyntaxErrors) > 0 {
+		return details, nil
+	}
+	if err := describeCache.store(filePath, hash, opts.Metrics, details); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: could not write cache entry:", err)
+	}
+	return details, nil
+}
+
+// extractSource parses and inspects Go source, reading it from filePath when
+// src is nil. In tolerant mode a file with syntax errors is still inspected:
+// the declarations the parser recovered are reported along with the errors,
+// and those overlapping an error are listed as incomplete.
+func extractSource(filePath string, src interface{}, opts describeOptions) (*FileDetails, error) {
+	fset := token.NewFileSet()
+	mode := parseMode
+	if opts.Tolerant {
+		mode |= parser.AllErrors
+	}
+	node, err := parser.ParseFile(fset, filePath, src, mode)
+	var errs scanner.ErrorList
+	if err != nil && (!opts.Tolerant || !errors.As(err, &errs)) {
+		return nil, err
+	}
+	// Without a package clause there is nothing to describe.
+	if node == nil || node.Name == nil || node.Name.Name == "" || node.Name.Name == "_" {
+		return nil, err
+	}
+
+	var analyses []bodyAnalysis
+	if opts.Metrics {
+		analyses = append(analyses, metricsAnalysis(fset))
+	}
+	details := inspectFile(filePath, node, analyses...)
+	if len(errs) > 0 {
+		markIncomplete(fset, node, errs, details)
+	}
+	return details, nil
 }
 
+// parseMode is the parser mode of every extraction. Identifier resolution is
+// skipped because none of the extractors rely on it.
+const parseMode = parser.ParseComments | parser.SkipObjectResolution
+
 // parseFile parses the Go file at the given path and returns the corresponding AST node.
 func parseFile(filePath string) (*ast.File, error) {
+	return parseSource(filePath, nil)
+}
+
+// parseSource parses Go source, reading it from filePath when src is nil.
+func parseSource(filePath string, src interface{}) (*ast.File, error) {
 	fset := token.NewFileSet()
-	return parser.ParseFile(fset, filePath, nil, parser.ParseComments)
+	return parser.ParseFile(fset, filePath, src, parseMode)
 }
 
 // inspectFile inspects the AST of a Go file and returns a FileDetails struct.
-func inspectFile(filePath string, node *ast.File) *FileDetails {
+// Only top-level declarations are visited; function bodies are handed to the
+// given analyses and are otherwise left untouched.
+func inspectFile(filePath string, node *ast.File, analyses ...bodyAnalysis) *FileDetails {
 	details := &FileDetails{
 		FilePath:   filePath,
 		Imports:    []string{},
@@ -118,19 +268,31 @@ func inspectFile(filePath string, node *ast.File) *FileDetails {
 		Funcs:      []string{},
 	}
 
-	handlers := map[string]func(ast.Node, *FileDetails){
-		"*ast.ImportSpec": handleImportSpec,
-		"*ast.TypeSpec":   handleTypeSpec,
-		"*ast.FuncDecl":   handleFuncDecl,
+	for _, decl := range node.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.ImportSpec:
+					handleImportSpec(s, details)
+				case *ast.TypeSpec:
+					handleTypeSpec(s, details)
+				}
+			}
+		case *ast.FuncDecl:
+			handleFuncDecl(d, details)
+			if d.Body == nil {
+				continue
+			}
+			for _, analyze := range analyses {
+				analyze(d, details)
+			}
+		}
 	}
 
-	ast.Inspect(node, func(n ast.Node) bool {
-		handler, ok := handlers[fmt.Sprintf("%T", n)]
-		if ok {
-			handler(n, details)
-		}
-		return true
-	})
+	if isMockAST(filePath, node) {
+		collapseMocks(node, details)
+	}
 
 	return details
 }
@@ -150,16 +312,32 @@ func handleInterfaceSpec(x *ast.TypeSpec, details *FileDetails) {
 	switch t := x.Type.(type) {
 	case *ast.InterfaceType:
 		// Add an entry for the interface to the Interfaces field
+		if details.Interfaces == nil {
+			details.Interfaces = make(map[string][]string)
+		}
 		details.Interfaces[x.Name.Name] = []string{}
 
 		// Then add each method to the entry
 		for _, f := range t.Methods.List {
+			if len(f.Names) == 0 {
+				// Embedded interfaces and type set elements
+				addEmbed(details, x.Name.Name, types.ExprString(f.Type))
+				continue
+			}
 			method := fmt.Sprintf("%s %s", f.Names[0].Name, types.ExprString(f.Type))
 			details.Interfaces[x.Name.Name] = append(details.Interfaces[x.Name.Name], method)
 		}
 	}
 }
 
+// addEmbed records that the named type embeds typ.
+func addEmbed(details *FileDetails, name, typ string) {
+	if details.Embeds == nil {
+		details.Embeds = make(map[string][]string)
+	}
+	details.Embeds[name] = append(details.Embeds[name], typ)
+}
+
 func handleTypeSpec(n ast.Node, details *FileDetails) {
 	x, ok := n.(*ast.TypeSpec)
 	if !ok {
@@ -176,9 +354,91 @@ func handleTypeSpec(n ast.Node, details *FileDetails) {
 			if len(f.Names) > 0 { // Check if the Names slice is not empty
 				field := fmt.Sprintf("%s %s", f.Names[0].Name, types.ExprString(f.Type))
 				details.Structs[x.Name.Name] = append(details.Structs[x.Name.Name], field)
+			} else {
+				addEmbed(details, x.Name.Name, types.ExprString(f.Type))
 			}
 		}
+	case *ast.InterfaceType:
+		handleInterfaceSpec(x, details)
+	}
+}
+
+// funcParam is a parameter or result of a function signature. Name is empty
+// for unnamed parameters.
+type funcParam struct {
+	Name string
+	Type string
+}
+
+// funcSignature is the structured form of a function declaration that
+// handleFuncDecl renders into FileDetails.Funcs.
+type funcSignature struct {
+	Receiver     string // receiver type expression, empty for functions
+	ReceiverName string
+	Name         string
+	Params       []funcParam
+	Results      []funcParam
+}
+
+// parseFuncSignature extracts the signature of a function declaration.
+func parseFuncSignature(x *ast.FuncDecl) funcSignature {
+	sig := funcSignature{Name: x.Name.Name}
+	if x.Recv != nil && len(x.Recv.List) > 0 { // Check if the function has a receiver
+		// A receiver is a single field, extract the type
+		recv := x.Recv.List[0]
+		sig.Receiver = types.ExprString(recv.Type)
+		if len(recv.Names) > 0 && recv.Names[0].Name != "_" {
+			sig.ReceiverName = recv.Names[0].Name
+		}
+	}
+	sig.Params = fieldParams(x.Type.Params)
+	sig.Results = fieldParams(x.Type.Results)
+	return sig
+}
+
+// fieldParams flattens a field list into one funcParam per name.
+func fieldParams(list *ast.FieldList) []funcParam {
+	if list == nil {
+		return nil
+	}
+	params := []funcParam{}
+	for _, field := range list.List {
+		typ := types.ExprString(field.Type)
+		if len(field.Names) == 0 {
+			params = append(params, funcParam{Type: typ})
+			continue
+		}
+		for _, name := range field.Names {
+			params = append(params, funcParam{Name: name.Name, Type: typ})
+		}
+	}
+	return params
+}
+
+// String renders the signature the way describe reports it, for example
+// "(*T).Name(a int, b string) returns (bool, error)".
+func (sig funcSignature) String() string {
+	funcSig := ""
+	if sig.Receiver != "" {
+		funcSig += fmt.Sprintf("(%s).", sig.Receiver)
+	}
+	funcSig += fmt.Sprintf("%s(%s)", sig.Name, joinParams(sig.Params))
+	if sig.Results != nil {
+		funcSig += fmt.Sprintf(" returns (%s)", joinParams(sig.Results))
+	}
+	return funcSig
+}
+
+func joinParams(params []funcParam) string {
+	parts := make([]string, len(params))
+	for i, p := range params {
+		if p.Name == "" {
+			parts[i] = p.Type
+		} else {
+			parts[i] = p.Name + " " + p.Type
+		}
 	}
+	return strings.Join(parts, ", ")
 }
 
 // handleFuncDecl handles a function declaration AST node.
@@ -187,40 +447,5 @@ func handleFuncDecl(n ast.Node, details *FileDetails) {
 	if !ok {
 		return // or handle the error as you see fit
 	}
-	// The rest of your function implementation remains the same
-	funcSig := ""
-	if x.Recv != nil { // Check if the function has a receiver
-		// Assuming the receiver is a single field, extract the type
-		receiverType := types.ExprString(x.Recv.List[0].Type)
-		funcSig += fmt.Sprintf("(%s).", receiverType)
-	}
-	funcSig += fmt.Sprintf("%s(", x.Name.Name)
-	if x.Type.Params != nil {
-		for i, p := range x.Type.Params.List {
-			if i > 0 {
-				funcSig += ", "
-			}
-			for j := range p.Names {
-				if j > 0 {
-					funcSig += ", "
-				}
-				funcSig += fmt.Sprintf("%s %s", p.Names[j], types.ExprString(p.Type))
-			}
-		}
-	}
-	funcSig += ")"
-	if x.Type.Results != nil {
-		funcSig += " returns ("
-		for i, r := range x.Type.Results.List {
-			if i > 0 {
-				funcSig += ", "
-			}
-			if len(r.Names) > 0 {
-				funcSig += fmt.Sprintf("%s ", r.Names[0])
-			}
-			funcSig += types.ExprString(r.Type)
-		}
-		funcSig += ")"
-	}
-	details.Funcs = append(details.Funcs, funcSig)
+	details.Funcs = append(details.Funcs, parseFuncSignature(x).String())
 }
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"go/ast"
+	"go/parser"
+	"go/token"
 	"io"
 	"os"
 	"reflect"
@@ -55,6 +57,14 @@ func Test_describeFile(t *testing.T) {
 			wantErr: false,
 			wantOut: `{"FilePath":"./test_files/testfile.go","Imports":["fmt","net/http"],"Structs":{"MyStruct":["Field1 int","Field2 string"]},"Interfaces":null,"Funcs":["MyFunc(param1 int, param2 string) returns (result bool)","mainTest()"]}`,
 		},
+		{
+			name: "Test with unnamed parameters and grouped results",
+			args: args{
+				filePath: "./test_files/signatures.go",
+			},
+			wantErr: false,
+			wantOut: `{"FilePath":"./test_files/signatures.go","Imports":[],"Structs":{"Shape":[]},"Interfaces":null,"Funcs":["(Shape).Scale(float64)","Split(string, int) returns (head string, tail string, err error)","Bounds(x int, y int) returns (min int, max int)"]}`,
+		},
 		{
 			name: "Test with non-Go file",
 			args: args{
@@ -519,3 +529,92 @@ func TestInspectFile(t *testing.T) {
 		})
 	}
 }
+
+// writeLargeGoFile generates a Go file with the given number of structs and
+// functions, each function carrying a non-trivial body, and returns its path.
+func writeLargeGoFile(b *testing.B, decls int) string {
+	b.Helper()
+
+	var src strings.Builder
+	src.WriteString("package large\n\nimport (\n\t\"fmt\"\n\t\"strings\"\n)\n\n")
+	for i := 0; i < decls; i++ {
+		fmt.Fprintf(&src, "type Struct%d struct {\n\tID int\n\tName string\n\tTags []string\n}\n\n", i)
+		fmt.Fprintf(&src, "func (s *Struct%d) Describe(prefix string, n int) (string, error) {\n", i)
+		src.WriteString("\tvar b strings.Builder\n")
+		src.WriteString("\tfor i := 0; i < n; i++ {\n\t\tif i%2 == 0 {\n\t\t\tb.WriteString(prefix)\n\t\t} else {\n\t\t\tb.WriteString(fmt.Sprint(s.ID, s.Name, len(s.Tags)))\n\t\t}\n\t}\n")
+		src.WriteString("\tfn := func(x int) int { return x * 2 }\n\t_ = fn(n)\n\treturn b.String(), nil\n}\n\n")
+	}
+
+	path := b.TempDir() + "/large.go"
+	if err := os.WriteFile(path, []byte(src.String()), 0o644); err != nil {
+		b.Fatalf("Failed to write large file: %v", err)
+	}
+	return path
+}
+
+// inspectFileReflective is the previous extraction path, which walked every
+// node and dispatched on fmt.Sprintf("%T"). It is kept as a benchmark baseline.
+func inspectFileReflective(filePath string, node *ast.File) *FileDetails {
+	details := &FileDetails{
+		FilePath: filePath,
+		Imports:  []string{},
+		Structs:  make(map[string][]string),
+		Funcs:    []string{},
+	}
+
+	handlers := map[string]func(ast.Node, *FileDetails){
+		"*ast.ImportSpec": handleImportSpec,
+		"*ast.TypeSpec":   handleTypeSpec,
+		"*ast.FuncDecl":   handleFuncDecl,
+	}
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		handler, ok := handlers[fmt.Sprintf("%T", n)]
+		if ok {
+			handler(n, details)
+		}
+		return true
+	})
+
+	return details
+}
+
+func BenchmarkParseFile(b *testing.B) {
+	path := writeLargeGoFile(b, 2000)
+
+	b.Run("SkipObjectResolution", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := parseFile(path); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("ObjectResolution", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ParseComments); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkInspectFile(b *testing.B) {
+	path := writeLargeGoFile(b, 2000)
+	node, err := parseFile(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("TypedTopLevel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			inspectFile(path, node)
+		}
+	})
+
+	b.Run("ReflectiveInspect", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			inspectFileReflective(path, node)
+		}
+	})
+}
@@ -15,7 +15,7 @@ var detectCmd = &cobra.Command{
 	Use:   "detect [path]",
 	Short: "Detect if a file or directory is part of a Go project and report basic info",
 	Args:  cobra.ExactArgs(1),
-	Run:   detectRun,
+	RunE:  detectRun,
 }
 
 var showAllDeps bool
@@ -33,11 +33,48 @@ type dependency struct {
 }
 
 func detectGoProject(path string) (string, []dependency, error) {
+	goModPath, err := findGoMod(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	modulePath, dependencies, err := readGoModFile(goModPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading go.mod file: %v", err)
+	}
+	return modulePath, dependencies, nil
+}
+
+// projectInfo is the machine-readable form of detect's report.
+type projectInfo struct {
+	GoMod        string
+	Module       string
+	Dependencies []dependency
+}
+
+func describeProject(path string) (*projectInfo, error) {
+	goModPath, err := findGoMod(path)
+	if err != nil {
+		return nil, err
+	}
+	module, dependencies, err := readGoModFile(goModPath)
+	if err != nil {
+		return nil, err
+	}
+	return &projectInfo{GoMod: goModPath, Module: module, Dependencies: dependencies}, nil
+}
+
+// findGoMod walks up from path and returns the first go.mod file it finds.
+func findGoMod(path string) (string, error) {
 	info, err := os.Stat(path)
 	if err != nil {
-		return "", nil, fmt.Errorf("error accessing path '%s': %v", path, err)
+		return "", fmt.Errorf("accessing path '%s': %w", path, err)
 	}
 
+	start := path
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
 	if info.Mode().IsRegular() {
 		path = filepath.Dir(path)
 	}
@@ -45,11 +82,7 @@ func detectGoProject(path string) (string, []dependency, error) {
 	for {
 		goModPath := filepath.Join(path, "go.mod")
 		if _, err := os.Stat(goModPath); err == nil {
-			modulePath, dependencies, err := readGoModFile(goModPath)
-			if err != nil {
-				return "", nil, fmt.Errorf("error reading go.mod file: %v", err)
-			}
-			return modulePath, dependencies, nil
+			return goModPath, nil
 		}
 
 		parent := filepath.Dir(path)
@@ -59,7 +92,7 @@ func detectGoProject(path string) (string, []dependency, error) {
 		path = parent
 	}
 
-	return "", nil, fmt.Errorf("'%s' is not a Go project. No go.mod file found", path)
+	return "", fmt.Errorf("'%s' is not a Go project. No go.mod file found", start)
 }
 
 func printProjectDetails(projectPath, modulePath string, dependencies []dependency) {
@@ -120,24 +153,14 @@ func parseRequire(requires ...*modfile.Require) []dependency {
 	return dependencies
 }
 
-func isValidPath(path string) bool {
-	_, err := os.Stat(path)
-	return err == nil
-}
-
-func detectRun(cmd *cobra.Command, args []string) {
+func detectRun(cmd *cobra.Command, args []string) error {
 	path := args[0]
 
-	if !isValidPath(path) {
-		fmt.Printf("Invalid path: '%s'\n", path)
-		return
-	}
-
 	modulePath, dependencies, err := detectGoProject(path)
 	if err != nil {
-		fmt.Printf("%v\n", err)
-		return
+		return err
 	}
 
 	printProjectDetails(path, modulePath, dependencies)
+	return nil
 }
@@ -0,0 +1,426 @@
+package cmd
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var diagramCmd = &cobra.Command{
+	Use:   "diagram",
+	Short: "Render diagrams of Go code",
+}
+
+var diagramClassesCmd = &cobra.Command{
+	Use:   "classes [path]",
+	Short: "Render a class diagram of the structs and interfaces under path",
+	Long: `Render a class diagram of the structs and interfaces under path as a
+Mermaid classDiagram or PlantUML text. Structs show their fields and
+methods, interfaces their methods. Edges show embedding, fields whose type
+is another type in the diagram, and structs implementing interfaces, judged
+by matching method names and signatures.`,
+	Example: `  gosymex diagram classes ./internal/store
+  gosymex diagram classes --format plantuml . > classes.puml`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runDiagramClassesCmd,
+}
+
+func init() {
+	addWalkFlags(diagramClassesCmd)
+	diagramClassesCmd.Flags().String("format", "mermaid", "Output format: mermaid or plantuml")
+
+	diagramCmd.AddCommand(diagramClassesCmd)
+	rootCmd.AddCommand(diagramCmd)
+}
+
+// Relation kinds of a class diagram.
+const (
+	relationEmbeds     = "embeds"
+	relationField      = "field"
+	relationImplements = "implements"
+)
+
+// classType is a struct or interface of a class diagram.
+type classType struct {
+	ID        string // unique diagram identifier
+	Name      string
+	Package   string // package directory
+	Interface bool
+	Fields    []string
+	Methods   []string // rendered as Name(params) results
+
+	embeds     []string
+	methodSigs map[string]string // method name -> func type without parameter names
+}
+
+// classRelation is an edge between two types of a class diagram.
+type classRelation struct {
+	From  string
+	To    string
+	Kind  string
+	Label string
+}
+
+// classDiagram holds the types and relations to render.
+type classDiagram struct {
+	Types     []*classType
+	Relations []classRelation
+
+	byPackage map[string]map[string]*classType
+	pkgDirs   map[string][]string // package name -> directories
+}
+
+// buildClassDiagram extracts the structs and interfaces of the Go files
+// under root and relates them.
+func buildClassDiagram(root string, opts walkOptions) (*classDiagram, error) {
+	diagram := &classDiagram{
+		byPackage: make(map[string]map[string]*classType),
+		pkgDirs:   make(map[string][]string),
+	}
+	methods := make(map[string]map[string][]string) // package -> receiver type -> describe signatures
+
+	var failures fileFailures
+	err := walkGoFiles(root, opts, func(filePath string, info os.FileInfo) error {
+		details, err := extractFile(filePath, describeOptions{})
+		failures.add(err)
+		if err != nil {
+			reportFileError(filePath, err)
+			return nil
+		}
+
+		pkg := packageOf(filePath)
+		for name, fields := range details.Structs {
+			diagram.add(&classType{Name: name, Package: pkg, Fields: fields, embeds: details.Embeds[name]})
+		}
+		for name, ifaceMethods := range details.Interfaces {
+			class := &classType{Name: name, Package: pkg, Interface: true, embeds: details.Embeds[name], methodSigs: make(map[string]string)}
+			for _, method := range ifaceMethods {
+				methodName, typ, _ := strings.Cut(method, " ")
+				class.Methods = append(class.Methods, methodName+strings.TrimPrefix(typ, "func"))
+				class.methodSigs[methodName] = normalizeFuncType(typ)
+			}
+			diagram.add(class)
+		}
+		for _, sig := range details.Funcs {
+			if recv, ok := funcReceiverType(sig); ok {
+				if methods[pkg] == nil {
+					methods[pkg] = make(map[string][]string)
+				}
+				methods[pkg][recv] = append(methods[pkg][recv], sig)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Methods may be declared in another file than their type.
+	for pkg, byType := range methods {
+		for recv, sigs := range byType {
+			class := diagram.byPackage[pkg][recv]
+			if class == nil || class.Interface {
+				continue
+			}
+			class.methodSigs = make(map[string]string)
+			for _, sig := range sigs {
+				key := funcKey(sig)
+				_, name, _ := strings.Cut(key, ").")
+				// Reprint the describe signature as a func type, which drops
+				// the parentheses around single results.
+				funcType := "func" + strings.Replace(sig[len(key):], " returns ", " ", 1)
+				if expr, err := parser.ParseExpr(funcType); err == nil {
+					funcType = types.ExprString(expr)
+				}
+				class.Methods = append(class.Methods, name+strings.TrimPrefix(funcType, "func"))
+				class.methodSigs[name] = funcSigType(sig)
+			}
+		}
+	}
+
+	diagram.assignIDs()
+	diagram.relate()
+	return diagram, failures.err()
+}
+
+func (d *classDiagram) add(class *classType) {
+	if d.byPackage[class.Package] == nil {
+		d.byPackage[class.Package] = make(map[string]*classType)
+		name := path.Base(class.Package)
+		d.pkgDirs[name] = append(d.pkgDirs[name], class.Package)
+	}
+	d.byPackage[class.Package][class.Name] = class
+	d.Types = append(d.Types, class)
+}
+
+var nonIdentChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// assignIDs sorts the types and gives each an identifier: its name, or its
+// package and name when several packages declare the same name.
+func (d *classDiagram) assignIDs() {
+	sort.Slice(d.Types, func(i, j int) bool {
+		if d.Types[i].Package != d.Types[j].Package {
+			return d.Types[i].Package < d.Types[j].Package
+		}
+		return d.Types[i].Name < d.Types[j].Name
+	})
+
+	count := make(map[string]int)
+	for _, class := range d.Types {
+		count[class.Name]++
+	}
+	for _, class := range d.Types {
+		class.ID = class.Name
+		if count[class.Name] > 1 {
+			class.ID = nonIdentChars.ReplaceAllString(class.Package, "_") + "_" + class.Name
+		}
+		sort.Strings(class.Methods)
+	}
+}
+
+// lookup resolves a type name used in package pkg: unqualified names refer
+// to pkg, qualified ones to the package with that name.
+func (d *classDiagram) lookup(pkg string, expr ast.Expr) *classType {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return d.byPackage[pkg][e.Name]
+	case *ast.SelectorExpr:
+		qualifier, ok := e.X.(*ast.Ident)
+		if !ok {
+			return nil
+		}
+		for _, dir := range d.pkgDirs[qualifier.Name] {
+			if class := d.byPackage[dir][e.Sel.Name]; class != nil {
+				return class
+			}
+		}
+	case *ast.StarExpr:
+		return d.lookup(pkg, e.X)
+	}
+	return nil
+}
+
+// typeRefs returns the diagram types referenced anywhere in a type expression.
+func (d *classDiagram) typeRefs(pkg, typ string) []*classType {
+	expr, err := parser.ParseExpr(typ)
+	if err != nil {
+		return nil
+	}
+	var refs []*classType
+	ast.Inspect(expr, func(n ast.Node) bool {
+		e, ok := n.(ast.Expr)
+		if !ok {
+			return true
+		}
+		if class := d.lookup(pkg, e); class != nil {
+			refs = append(refs, class)
+			return false
+		}
+		// The name of a qualified type must not match a local type.
+		_, qualified := e.(*ast.SelectorExpr)
+		return !qualified
+	})
+	return refs
+}
+
+// relate adds the embedding, field and implementation relations.
+func (d *classDiagram) relate() {
+	for _, class := range d.Types {
+		for _, embed := range class.embeds {
+			for _, ref := range d.typeRefs(class.Package, embed) {
+				d.Relations = append(d.Relations, classRelation{From: class.ID, To: ref.ID, Kind: relationEmbeds})
+			}
+		}
+		for _, field := range class.Fields {
+			name, typ, _ := strings.Cut(field, " ")
+			for _, ref := range d.typeRefs(class.Package, typ) {
+				d.Relations = append(d.Relations, classRelation{From: class.ID, To: ref.ID, Kind: relationField, Label: name})
+			}
+		}
+	}
+
+	for _, iface := range d.Types {
+		if !iface.Interface {
+			continue
+		}
+		want, complete := d.methodSet(iface, map[*classType]bool{})
+		if !complete || len(want) == 0 {
+			// Unknown embedded interfaces leave the method set open, and
+			// every type implements an empty interface.
+			continue
+		}
+		for _, class := range d.Types {
+			if class.Interface {
+				continue
+			}
+			have, _ := d.methodSet(class, map[*classType]bool{})
+			if implements(have, want) {
+				d.Relations = append(d.Relations, classRelation{From: class.ID, To: iface.ID, Kind: relationImplements})
+			}
+		}
+	}
+}
+
+// methodSet returns the methods of a type including those promoted from
+// embedded types, and whether every embedded type could be resolved.
+func (d *classDiagram) methodSet(class *classType, visiting map[*classType]bool) (map[string]string, bool) {
+	methods := make(map[string]string)
+	complete := true
+	if visiting[class] {
+		return methods, complete
+	}
+	visiting[class] = true
+
+	for _, embed := range class.embeds {
+		expr, err := parser.ParseExpr(embed)
+		var ref *classType
+		if err == nil {
+			ref = d.lookup(class.Package, expr)
+		}
+		if ref == nil {
+			complete = false
+			continue
+		}
+		promoted, ok := d.methodSet(ref, visiting)
+		complete = complete && ok
+		for name, sig := range promoted {
+			methods[name] = sig
+		}
+	}
+	// Declared methods shadow promoted ones.
+	for name, sig := range class.methodSigs {
+		methods[name] = sig
+	}
+	return methods, complete
+}
+
+func implements(have, want map[string]string) bool {
+	for name, sig := range want {
+		if have[name] != sig {
+			return false
+		}
+	}
+	return true
+}
+
+// memberVisibility renders Go exportedness as UML visibility.
+func memberVisibility(member string) string {
+	if ast.IsExported(member) {
+		return "+"
+	}
+	return "-"
+}
+
+// diagramMember makes a field or method readable by diagram parsers, which
+// treat braces as the end of a class body.
+func diagramMember(member string) string {
+	member = strings.ReplaceAll(member, "interface{}", "any")
+	member = strings.ReplaceAll(member, "struct{}", "struct")
+	return memberVisibility(member) + strings.NewReplacer("{", "(", "}", ")").Replace(member)
+}
+
+func (d *classDiagram) writeMermaid(w io.Writer) {
+	fmt.Fprintln(w, "classDiagram")
+	for _, class := range d.Types {
+		if class.ID != class.Name {
+			fmt.Fprintf(w, "\tclass %s[\"%s.%s\"] {\n", class.ID, path.Base(class.Package), class.Name)
+		} else {
+			fmt.Fprintf(w, "\tclass %s {\n", class.ID)
+		}
+		if class.Interface {
+			fmt.Fprintln(w, "\t\t<<interface>>")
+		}
+		for _, field := range class.Fields {
+			fmt.Fprintf(w, "\t\t%s\n", diagramMember(field))
+		}
+		for _, method := range class.Methods {
+			fmt.Fprintf(w, "\t\t%s\n", diagramMember(method))
+		}
+		fmt.Fprintln(w, "\t}")
+	}
+	for _, rel := range d.Relations {
+		switch rel.Kind {
+		case relationEmbeds:
+			fmt.Fprintf(w, "\t%s *-- %s : embeds\n", rel.From, rel.To)
+		case relationField:
+			fmt.Fprintf(w, "\t%s --> %s : %s\n", rel.From, rel.To, rel.Label)
+		case relationImplements:
+			fmt.Fprintf(w, "\t%s ..|> %s\n", rel.From, rel.To)
+		}
+	}
+}
+
+func (d *classDiagram) writePlantUML(w io.Writer) {
+	fmt.Fprintln(w, "@startuml")
+	pkg := ""
+	for _, class := range d.Types {
+		if class.Package != pkg {
+			if pkg != "" {
+				fmt.Fprintln(w, "}")
+			}
+			pkg = class.Package
+			fmt.Fprintf(w, "package %q {\n", pkg)
+		}
+		kind := "class"
+		if class.Interface {
+			kind = "interface"
+		}
+		fmt.Fprintf(w, "\t%s %q as %s {\n", kind, class.Name, class.ID)
+		for _, field := range class.Fields {
+			fmt.Fprintf(w, "\t\t%s\n", diagramMember(field))
+		}
+		for _, method := range class.Methods {
+			fmt.Fprintf(w, "\t\t%s\n", diagramMember(method))
+		}
+		fmt.Fprintln(w, "\t}")
+	}
+	if pkg != "" {
+		fmt.Fprintln(w, "}")
+	}
+	for _, rel := range d.Relations {
+		switch rel.Kind {
+		case relationEmbeds:
+			fmt.Fprintf(w, "%s *-- %s : embeds\n", rel.From, rel.To)
+		case relationField:
+			fmt.Fprintf(w, "%s --> %s : %s\n", rel.From, rel.To, rel.Label)
+		case relationImplements:
+			fmt.Fprintf(w, "%s ..|> %s\n", rel.From, rel.To)
+		}
+	}
+	fmt.Fprintln(w, "@enduml")
+}
+
+func runDiagramClassesCmd(cmd *cobra.Command, args []string) error {
+	root := "."
+	if len(args) > 0 {
+		root = args[0]
+	}
+	format, _ := cmd.Flags().GetString("format")
+	if format != "mermaid" && format != "plantuml" {
+		return withExitCode(exitUsage, fmt.Errorf("invalid --format %q: must be mermaid or plantuml", format))
+	}
+	if _, err := os.Stat(root); err != nil {
+		return fmt.Errorf("accessing path: %w", err)
+	}
+
+	diagram, err := buildClassDiagram(filepath.Clean(root), walkOptionsFromFlags(cmd))
+	if diagram == nil {
+		return err
+	}
+	if format == "plantuml" {
+		diagram.writePlantUML(os.Stdout)
+	} else {
+		diagram.writeMermaid(os.Stdout)
+	}
+	return err
+}
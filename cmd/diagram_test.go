@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInspectFileInterfacesAndEmbeds(t *testing.T) {
+	node, err := parseSource("shapes.go", `package shapes
+
+import "io"
+
+type Named interface {
+	Shape
+	io.Closer
+	Name() string
+}
+
+type Square struct {
+	Base
+	*Person
+	Side float64
+}
+`)
+	if err != nil {
+		t.Fatalf("parseSource() error = %v", err)
+	}
+
+	details := inspectFile("shapes.go", node)
+	if want := map[string][]string{"Named": {"Name func() string"}}; !reflect.DeepEqual(details.Interfaces, want) {
+		t.Errorf("Interfaces = %v, want %v", details.Interfaces, want)
+	}
+	if want := map[string][]string{"Square": {"Side float64"}}; !reflect.DeepEqual(details.Structs, want) {
+		t.Errorf("Structs = %v, want %v", details.Structs, want)
+	}
+	want := map[string][]string{"Named": {"Shape", "io.Closer"}, "Square": {"Base", "*Person"}}
+	if !reflect.DeepEqual(details.Embeds, want) {
+		t.Errorf("Embeds = %v, want %v", details.Embeds, want)
+	}
+}
+
+func TestBuildClassDiagram(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"shapes/shapes.go": `package shapes
+
+import "io"
+
+type Shape interface {
+	Area() float64
+}
+
+type Named interface {
+	Shape
+	Name() string
+}
+
+type Stream interface {
+	io.Reader
+	Close() error
+}
+
+type Base struct {
+	name string
+}
+
+type Square struct {
+	Base
+	Side   float64
+	Owner  *Person
+	Reader io.Reader
+}
+
+type Circle struct {
+	Radius int
+}
+
+type Person struct {
+	Name string
+}
+`,
+		"shapes/methods.go": `package shapes
+
+func (b Base) Name() string { return b.name }
+
+func (s *Square) Area() float64 { return s.Side * s.Side }
+
+func (c Circle) Area() int { return c.Radius }
+
+func (s *Square) Close() error { return nil }
+`,
+	})
+
+	diagram, err := buildClassDiagram(dir, walkOptions{})
+	if err != nil {
+		t.Fatalf("buildClassDiagram() error = %v", err)
+	}
+
+	var relations []string
+	for _, rel := range diagram.Relations {
+		relations = append(relations, rel.From+" "+rel.Kind+" "+rel.To+" "+rel.Label)
+	}
+	want := []string{
+		"Named embeds Shape ",
+		"Square embeds Base ",
+		"Square field Person Owner",
+		"Square implements Named ",
+		"Square implements Shape ",
+	}
+	if !reflect.DeepEqual(relations, want) {
+		t.Errorf("Expected relations %v, but got %v", want, relations)
+	}
+
+	testCases := []struct {
+		name   string
+		write  func(*strings.Builder)
+		expect []string
+	}{
+		{
+			name:  "Test with Mermaid output",
+			write: func(b *strings.Builder) { diagram.writeMermaid(b) },
+			expect: []string{
+				"classDiagram\n",
+				"\tclass Shape {\n\t\t<<interface>>\n\t\t+Area() float64\n\t}\n",
+				"\tclass Square {\n\t\t+Side float64\n\t\t+Owner *Person\n\t\t+Reader io.Reader\n\t\t+Area() float64\n\t\t+Close() error\n\t}\n",
+				"\tSquare *-- Base : embeds\n",
+				"\tSquare --> Person : Owner\n",
+				"\tSquare ..|> Shape\n",
+			},
+		},
+		{
+			name:  "Test with PlantUML output",
+			write: func(b *strings.Builder) { diagram.writePlantUML(b) },
+			expect: []string{
+				"@startuml\n",
+				"\tinterface \"Shape\" as Shape {\n\t\t+Area() float64\n\t}\n",
+				"\tclass \"Base\" as Base {\n\t\t-name string\n\t\t+Name() string\n\t}\n",
+				"Square ..|> Named\n",
+				"@enduml\n",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var b strings.Builder
+			tc.write(&b)
+			for _, want := range tc.expect {
+				if !strings.Contains(b.String(), want) {
+					t.Errorf("Expected output to contain %q:\n%s", want, b.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// diffOp is one line of an edit script: kept (' '), removed ('-') or added
+// ('+').
+type diffOp struct {
+	Kind byte
+	Line string // including its newline, if it has one
+}
+
+// unifiedDiff returns the difference between two texts in unified diff
+// format, or "" when they are equal.
+func unifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+	ops := diffLines(splitLines(oldText), splitLines(newText))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	// oldLine and newLine are the lines of each side before ops[i].
+	oldLine, newLine := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if op.Kind != '+' {
+			oldLine[i+1]++
+		}
+		if op.Kind != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == ' ' {
+			i++
+			continue
+		}
+		start := max(i-diffContext, 0)
+		// Extend the hunk while the next change is close enough to share
+		// context with this one.
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].Kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		end = min(end+diffContext, len(ops))
+
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n",
+			hunkRange(oldLine[start], oldLine[end]-oldLine[start]),
+			hunkRange(newLine[start], newLine[end]-newLine[start]))
+		for _, op := range ops[start:end] {
+			b.WriteByte(op.Kind)
+			b.WriteString(op.Line)
+			if !strings.HasSuffix(op.Line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return b.String()
+}
+
+// hunkRange formats the start and length of one side of a hunk. An empty
+// range starts at the line before it.
+func hunkRange(before, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if length == 1 {
+		return fmt.Sprint(before + 1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, length)
+}
+
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns an edit script turning a into b, built from a longest
+// common subsequence of their lines. Common leading and trailing lines are
+// set aside first, which keeps the table small for typical edits.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// lcs[i][j] is the length of the longest common subsequence of midA[i:]
+	// and midB[j:].
+	lcs := make([][]int32, len(midA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(midB)+1)
+	}
+	for i := len(midA) - 1; i >= 0; i-- {
+		for j := len(midB) - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(midA) || j < len(midB) {
+		switch {
+		case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+			ops = append(ops, diffOp{' ', midA[i]})
+			i++
+			j++
+		case j < len(midB) && (i == len(midA) || lcs[i][j+1] > lcs[i+1][j]):
+			ops = append(ops, diffOp{'+', midB[j]})
+			j++
+		default:
+			ops = append(ops, diffOp{'-', midA[i]})
+			i++
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
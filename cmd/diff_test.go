@@ -0,0 +1,53 @@
+package cmd
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	testCases := []struct {
+		name string
+		old  string
+		new  string
+		want string
+	}{
+		{
+			name: "Test with equal texts",
+			old:  lines,
+			new:  lines,
+			want: "",
+		},
+		{
+			name: "Test with a changed line",
+			old:  lines,
+			new:  "a\nb\nc\nd\nE\nf\ng\nh\ni\nj\nk\nl\n",
+			want: "--- a/x.go\n+++ b/x.go\n@@ -2,7 +2,7 @@\n b\n c\n d\n-e\n+E\n f\n g\n h\n",
+		},
+		{
+			name: "Test with distant changes",
+			old:  lines,
+			new:  "A\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n",
+			want: "--- a/x.go\n+++ b/x.go\n@@ -1,4 +1,4 @@\n-a\n+A\n b\n c\n d\n@@ -10,3 +10,4 @@\n j\n k\n l\n+m\n",
+		},
+		{
+			name: "Test with a new file",
+			old:  "",
+			new:  "a\nb\n",
+			want: "--- a/x.go\n+++ b/x.go\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "Test with no newline at the end",
+			old:  "a\nb",
+			new:  "a\nc\n",
+			want: "--- a/x.go\n+++ b/x.go\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := unifiedDiff("a/x.go", "b/x.go", tc.old, tc.new)
+			if got != tc.want {
+				t.Errorf("Expected:\n%s\nbut got:\n%s", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/scanner"
+	"io/fs"
+	"os"
+)
+
+// Exit codes. Scripts consuming gosymex output can rely on these.
+const (
+	exitOK           = 0
+	exitFailure      = 1 // the command failed
+	exitUsage        = 2 // invalid arguments or flags
+	exitPathNotFound = 3 // an input path does not exist
+	exitParseError   = 4 // an input file could not be parsed
+	exitPartial      = 5 // some files were described, others failed
+)
+
+// Error formats selected with --errors.
+const (
+	errorsText = "text"
+	errorsJSON = "json"
+)
+
+var errorFormat string
+
+// commandStarted is set once argument and flag parsing succeeded, so that
+// errors cobra returns before that are reported as usage errors.
+var commandStarted bool
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&errorFormat, "errors", errorsText, "Format of error reports: text, or json records")
+}
+
+// exitError is an error that ends the process with a specific exit code.
+type exitError struct {
+	Code int
+	Err  error
+}
+
+func (e *exitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.Err
+}
+
+// withExitCode attaches an exit code to err.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{Code: code, Err: err}
+}
+
+// exitCode classifies err into one of the documented exit codes.
+func exitCode(err error) int {
+	var exitErr *exitError
+	var parseErr scanner.ErrorList
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &exitErr):
+		return exitErr.Code
+	case errors.Is(err, fs.ErrNotExist):
+		return exitPathNotFound
+	case errors.As(err, &parseErr):
+		return exitParseError
+	}
+	return exitFailure
+}
+
+// errorRecord is the machine-readable form of an error with --errors json.
+type errorRecord struct {
+	File  string `json:",omitempty"`
+	Error string
+	Code  int
+}
+
+// reportFileError reports a failure to process one file as a diagnostic on
+// stderr, one JSON record per line in JSON mode.
+func reportFileError(filePath string, err error) {
+	if errorFormat == errorsJSON {
+		json.NewEncoder(os.Stderr).Encode(errorRecord{File: filePath, Error: err.Error(), Code: exitCode(err)})
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Error describing %s: %v\n", filePath, err)
+}
+
+// reportError writes the error that ended the command to stderr.
+func reportError(err error, code int) {
+	if errorFormat == errorsJSON {
+		json.NewEncoder(os.Stderr).Encode(errorRecord{Error: err.Error(), Code: code})
+		return
+	}
+	fmt.Fprintln(os.Stderr, "Error:", err)
+}
+
+// fileFailures counts the outcome of a run over several files.
+type fileFailures struct {
+	succeeded int
+	failed    int
+	code      int // exit code of the first failure
+}
+
+func (f *fileFailures) add(err error) {
+	if err == nil {
+		f.succeeded++
+		return
+	}
+	if f.failed == 0 {
+		f.code = exitCode(err)
+	}
+	f.failed++
+}
+
+// err summarises the run: nil when every file succeeded, a partial failure
+// when only some did, and the first failure's code when none did.
+func (f *fileFailures) err() error {
+	switch {
+	case f.failed == 0:
+		return nil
+	case f.succeeded > 0:
+		return withExitCode(exitPartial, fmt.Errorf("%d of %d files failed", f.failed, f.failed+f.succeeded))
+	}
+	return withExitCode(f.code, fmt.Errorf("all %d files failed", f.failed))
+}
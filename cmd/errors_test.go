@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	_, statErr := os.Stat(filepath.Join(t.TempDir(), "missing"))
+	_, parseErr := parseSource("bad.go", []byte("package a\nfunc {"))
+
+	testCases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"Test with no error", nil, exitOK},
+		{"Test with plain error", errors.New("boom"), exitFailure},
+		{"Test with explicit code", withExitCode(exitUsage, errors.New("bad flag")), exitUsage},
+		{"Test with missing path", fmt.Errorf("accessing path: %w", statErr), exitPathNotFound},
+		{"Test with parse error", fmt.Errorf("parsing file: %w", parseErr), exitParseError},
+		{"Test with wrapped explicit code", fmt.Errorf("outer: %w", withExitCode(exitPartial, statErr)), exitPartial},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := exitCode(tc.err); got != tc.want {
+				t.Errorf("Expected exit code %d, but got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestProcessDirectoryFailures(t *testing.T) {
+	testCases := []struct {
+		name  string
+		files map[string]string
+		want  int
+	}{
+		{
+			name:  "Test with all files described",
+			files: map[string]string{"a.go": "package a\n", "b.go": "package a\n"},
+			want:  exitOK,
+		},
+		{
+			name:  "Test with some files failing",
+			files: map[string]string{"a.go": "package a\n", "b.go": "package a\nfunc {"},
+			want:  exitPartial,
+		},
+		{
+			name:  "Test with all files failing",
+			files: map[string]string{"a.go": "package a\nfunc {", "b.go": "package"},
+			want:  exitParseError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, tc.files)
+
+			out := newDescribeOutput(walkOptions{}, describeOptions{})
+			err := processDirectory(dir, walkOptions{}, describeOptions{}, out)
+			if got := exitCode(err); got != tc.want {
+				t.Errorf("Expected exit code %d, but got %d (%v)", tc.want, got, err)
+			}
+			if got := len(out.Files) + len(out.Errors); got != len(tc.files) {
+				t.Errorf("Expected %d files and errors in the output, but got %d", len(tc.files), got)
+			}
+		})
+	}
+}
@@ -0,0 +1,519 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+var genTestCmd = &cobra.Command{
+	Use:   "gen-test <pkg>.<Func> | <pkg>.<Type>.<Method>",
+	Short: "Generate a table-driven test skeleton for a function or method",
+	Long: `Generate a table-driven test skeleton for a function or method and write it
+to the test file next to the source file, merging it into the file if it exists.
+
+<pkg> is a package directory such as ./internal/store, or a package name
+found in the current module.`,
+	Example: `  gosymex gen-test ./cmd.describeFile
+  gosymex gen-test store.Cache.Get`,
+	Args: cobra.ExactArgs(1),
+	RunE: runGenTestCmd,
+}
+
+func init() {
+	genTestCmd.Flags().Bool("dry-run", false, "Print the resulting test file instead of writing it")
+	rootCmd.AddCommand(genTestCmd)
+}
+
+// testTarget is the function a test skeleton is generated for.
+type testTarget struct {
+	File      string
+	Node      *ast.File
+	Decl      *ast.FuncDecl
+	Signature funcSignature
+	Fields    []funcParam // fields of the receiver struct, if any
+	IsStruct  bool
+}
+
+// splitTestTarget splits a gen-test argument into a package reference and
+// the function or Type.Method name.
+func splitTestTarget(arg string) (pkg string, symbol []string, err error) {
+	slash := strings.LastIndex(arg, "/")
+	head, tail := arg[:slash+1], arg[slash+1:]
+	parts := strings.Split(tail, ".")
+	switch {
+	case len(parts) == 1 && head == "":
+		return ".", parts, nil
+	case len(parts) == 2 || len(parts) == 3:
+		return head + parts[0], parts[1:], nil
+	}
+	return "", nil, fmt.Errorf("cannot parse '%s': expected <pkg>.<Func> or <pkg>.<Type>.<Method>", arg)
+}
+
+// resolvePackageDir returns the directory of a package given as a directory
+// or as a package name within the current module.
+func resolvePackageDir(pkg string) (string, error) {
+	if info, err := os.Stat(pkg); err == nil && info.IsDir() {
+		return pkg, nil
+	}
+
+	root := "."
+	if goModPath, err := findGoMod("."); err == nil {
+		root = filepath.Dir(goModPath)
+	}
+	var found []string
+	seen := make(map[string]bool)
+	err := walkGoFiles(root, walkOptions{}, func(filePath string, info os.FileInfo) error {
+		dir := filepath.Dir(filePath)
+		if seen[dir] {
+			return nil
+		}
+		node, err := parser.ParseFile(token.NewFileSet(), filePath, nil, parser.PackageClauseOnly)
+		if err == nil && node.Name.Name == pkg {
+			seen[dir] = true
+			found = append(found, dir)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("no package '%s' found", pkg)
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("package name '%s' is ambiguous: %s", pkg, strings.Join(found, ", "))
+}
+
+// findTestTarget locates the declaration of symbol (F or T.M) among the
+// non-test files of dir.
+func findTestTarget(dir string, symbol []string) (*testTarget, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	var target *testTarget
+	structs := make(map[string]*ast.StructType)
+	for _, filePath := range files {
+		if strings.HasSuffix(filePath, "_test.go") {
+			continue
+		}
+		node, err := parseFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %v", filePath, err)
+		}
+		for _, decl := range node.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Name.Name != symbol[len(symbol)-1] {
+					continue
+				}
+				isMethod := d.Recv != nil && len(d.Recv.List) > 0
+				if isMethod != (len(symbol) == 2) || (isMethod && receiverTypeName(d.Recv.List[0].Type) != symbol[0]) {
+					continue
+				}
+				target = &testTarget{File: filePath, Node: node, Decl: d, Signature: parseFuncSignature(d)}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok {
+						if st, ok := ts.Type.(*ast.StructType); ok {
+							structs[ts.Name.Name] = st
+						}
+					}
+				}
+			}
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%s not found in %s", strings.Join(symbol, "."), dir)
+	}
+
+	if len(symbol) == 2 {
+		if st, ok := structs[symbol[0]]; ok {
+			target.IsStruct = true
+			for _, field := range fieldParams(st.Fields) {
+				if field.Name == "" {
+					// Embedded fields are named after their type.
+					field.Name = receiverTypeName(mustParseExpr(field.Type))
+				}
+				target.Fields = append(target.Fields, field)
+			}
+		}
+	}
+	return target, nil
+}
+
+func mustParseExpr(expr string) ast.Expr {
+	parsed, err := parser.ParseExpr(expr)
+	if err != nil {
+		return ast.NewIdent(expr)
+	}
+	return parsed
+}
+
+// testName follows the naming of describe_test.go: TestExported,
+// Test_unexported and TestType_Method.
+func (target *testTarget) testName() string {
+	sig := target.Signature
+	if sig.Receiver != "" {
+		return "Test" + receiverTypeName(target.Decl.Recv.List[0].Type) + "_" + sig.Name
+	}
+	if ast.IsExported(sig.Name) {
+		return "Test" + sig.Name
+	}
+	return "Test_" + sig.Name
+}
+
+// displayName is the function name used in failure messages.
+func (target *testTarget) displayName() string {
+	if target.Signature.Receiver != "" {
+		return receiverTypeName(target.Decl.Recv.List[0].Type) + "." + target.Signature.Name
+	}
+	return target.Signature.Name
+}
+
+// generateTestFunc renders the test skeleton for target.
+func generateTestFunc(target *testTarget) string {
+	sig := target.Signature
+
+	// Name unnamed and blank parameters so they can be table fields.
+	params := make([]funcParam, len(sig.Params))
+	for i, p := range sig.Params {
+		if p.Name == "" || p.Name == "_" {
+			p.Name = fmt.Sprintf("arg%d", i)
+		}
+		params[i] = p
+	}
+
+	// A trailing error result becomes wantErr; the others become want fields.
+	results := sig.Results
+	returnsErr := len(results) > 0 && results[len(results)-1].Type == "error"
+	if returnsErr {
+		results = results[:len(results)-1]
+	}
+	var gots, wants []string
+	for i := range results {
+		suffix := ""
+		if i > 0 {
+			suffix = strconv.Itoa(i)
+		}
+		gots = append(gots, "got"+suffix)
+		wants = append(wants, "want"+suffix)
+	}
+
+	// A receiver type named like one of the skeleton's names is referred to
+	// by an alias, or, when it is t, the *testing.T is named test instead.
+	testVar, receiverType := "t", strings.TrimPrefix(sig.Receiver, "*")
+	var b strings.Builder
+	if sig.Receiver != "" && receiverTypeName(target.Decl.Recv.List[0].Type) == "t" {
+		testVar = "test"
+	}
+	fmt.Fprintf(&b, "func %s(%s *testing.T) {\n", target.testName(), testVar)
+
+	receiverVar := ""
+	if sig.Receiver != "" {
+		receiverVar = target.receiverVar()
+		if typeName := receiverTypeName(target.Decl.Recv.List[0].Type); typeName != "t" && skeletonName.MatchString(typeName) {
+			fmt.Fprintf(&b, "\ttype receiverType = %s\n", typeName)
+			receiverType = "receiverType" + strings.TrimPrefix(receiverType, typeName)
+		}
+		if target.IsStruct && len(target.Fields) > 0 {
+			b.WriteString("\ttype fields struct {\n")
+			for _, field := range target.Fields {
+				fmt.Fprintf(&b, "\t\t%s %s\n", field.Name, field.Type)
+			}
+			b.WriteString("\t}\n")
+		}
+	}
+	if len(params) > 0 {
+		b.WriteString("\ttype args struct {\n")
+		for _, p := range params {
+			fmt.Fprintf(&b, "\t\t%s %s\n", p.Name, variadicFieldType(p.Type))
+		}
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("\n\ttests := []struct {\n\t\tname string\n")
+	if sig.Receiver != "" {
+		if target.IsStruct && len(target.Fields) > 0 {
+			b.WriteString("\t\tfields fields\n")
+		} else if !target.IsStruct {
+			fmt.Fprintf(&b, "\t\treceiver %s\n", receiverType)
+		}
+	}
+	if len(params) > 0 {
+		b.WriteString("\t\targs args\n")
+	}
+	for i, want := range wants {
+		fmt.Fprintf(&b, "\t\t%s %s\n", want, results[i].Type)
+	}
+	if returnsErr {
+		b.WriteString("\t\twantErr bool\n")
+	}
+	b.WriteString("\t}{\n\t\t// TODO: Add test cases.\n\t}\n\n")
+
+	fmt.Fprintf(&b, "\tfor _, tt := range tests {\n\t\t%[1]s.Run(tt.name, func(%[1]s *testing.T) {\n", testVar)
+	callee := sig.Name
+	if sig.Receiver != "" {
+		switch {
+		case !target.IsStruct:
+			fmt.Fprintf(&b, "\t\t\t%s := tt.receiver\n", receiverVar)
+		default:
+			amp := ""
+			if strings.HasPrefix(sig.Receiver, "*") {
+				amp = "&"
+			}
+			fmt.Fprintf(&b, "\t\t\t%s := %s%s{\n", receiverVar, amp, receiverType)
+			for _, field := range target.Fields {
+				fmt.Fprintf(&b, "\t\t\t\t%s: tt.fields.%s,\n", field.Name, field.Name)
+			}
+			b.WriteString("\t\t\t}\n")
+		}
+		callee = receiverVar + "." + sig.Name
+	}
+
+	var callArgs []string
+	for _, p := range params {
+		arg := "tt.args." + p.Name
+		if strings.HasPrefix(p.Type, "...") {
+			arg += "..."
+		}
+		callArgs = append(callArgs, arg)
+	}
+	call := fmt.Sprintf("%s(%s)", callee, strings.Join(callArgs, ", "))
+
+	lhs := append([]string{}, gots...)
+	if returnsErr {
+		lhs = append(lhs, "err")
+	}
+	if len(lhs) > 0 {
+		fmt.Fprintf(&b, "\t\t\t%s := %s\n", strings.Join(lhs, ", "), call)
+	} else {
+		fmt.Fprintf(&b, "\t\t\t%s\n", call)
+	}
+	if returnsErr {
+		fmt.Fprintf(&b, "\t\t\tif (err != nil) != tt.wantErr {\n\t\t\t\t%s.Errorf(\"%s() error = %%v, wantErr %%v\", err, tt.wantErr)\n\t\t\t\treturn\n\t\t\t}\n", testVar, target.displayName())
+	}
+	for i, got := range gots {
+		label := target.displayName() + "()"
+		if len(gots) > 1 {
+			label += " " + got
+		}
+		fmt.Fprintf(&b, "\t\t\tif !reflect.DeepEqual(%s, tt.%s) {\n\t\t\t\t%s.Errorf(\"%s = %%v, want %%v\", %s, tt.%s)\n\t\t\t}\n", got, wants[i], testVar, label, got, wants[i])
+	}
+	b.WriteString("\t\t})\n\t}\n}\n")
+	return b.String()
+}
+
+// skeletonName matches the names the skeleton declares or uses, which the
+// receiver variable must not shadow and the receiver type must not be
+// shadowed by.
+var skeletonName = regexp.MustCompile(`^(t|test|tt|tests|fields|args|err|reflect|(got|want)[0-9]*)$`)
+
+// receiverVar names the variable holding the receiver in the skeleton: the
+// method's receiver name, or the first letter of its type, unless that
+// would clash with the skeleton's own names.
+func (target *testTarget) receiverVar() string {
+	name := target.Signature.ReceiverName
+	if name == "" || name == "_" {
+		first, _ := utf8.DecodeRuneInString(receiverTypeName(target.Decl.Recv.List[0].Type))
+		name = string(unicode.ToLower(first))
+	}
+	if skeletonName.MatchString(name) {
+		return "receiver"
+	}
+	return name
+}
+
+// variadicFieldType turns a variadic parameter type into the slice type of
+// the args field holding it.
+func variadicFieldType(typ string) string {
+	if rest, ok := strings.CutPrefix(typ, "..."); ok {
+		return "[]" + rest
+	}
+	return typ
+}
+
+// requiredImports returns the import paths the generated test needs: testing,
+// reflect when results are compared, and the packages referenced by the
+// types in the skeleton.
+func requiredImports(target *testTarget, testFunc string) []string {
+	paths := map[string]bool{"testing": true}
+	if strings.Contains(testFunc, "reflect.DeepEqual") {
+		paths["reflect"] = true
+	}
+
+	byName := make(map[string]string)
+	for _, imp := range target.Node.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		name := filepath.Base(path)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		byName[name] = path
+	}
+
+	var typeExprs []string
+	for _, p := range append(append([]funcParam{}, target.Signature.Params...), target.Signature.Results...) {
+		typeExprs = append(typeExprs, p.Type)
+	}
+	for _, field := range target.Fields {
+		typeExprs = append(typeExprs, field.Type)
+	}
+	for _, typ := range typeExprs {
+		ast.Inspect(mustParseExpr(variadicFieldType(typ)), func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if pkg, ok := sel.X.(*ast.Ident); ok {
+					if path, ok := byName[pkg.Name]; ok {
+						paths[path] = true
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	var sorted []string
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+var errTestExists = errors.New("test already exists")
+
+// mergeTestFile adds testFunc and its imports to an existing test file, or
+// creates a new one when existing is empty, and returns the formatted result.
+func mergeTestFile(existing []byte, pkgName, funcName, testFunc string, imports []string) ([]byte, error) {
+	if len(bytes.TrimSpace(existing)) == 0 {
+		var b strings.Builder
+		fmt.Fprintf(&b, "package %s\n\nimport (\n", pkgName)
+		for _, path := range imports {
+			fmt.Fprintf(&b, "\t%q\n", path)
+		}
+		b.WriteString(")\n\n")
+		b.WriteString(testFunc)
+		return format.Source([]byte(b.String()))
+	}
+
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, "", existing, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing existing test file: %v", err)
+	}
+	for _, decl := range node.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == funcName {
+			return nil, fmt.Errorf("%s: %w", funcName, errTestExists)
+		}
+	}
+
+	have := make(map[string]bool)
+	for _, imp := range node.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		have[path] = true
+	}
+	var missing []string
+	for _, path := range imports {
+		if !have[path] {
+			missing = append(missing, strconv.Quote(path))
+		}
+	}
+
+	src := existing
+	if len(missing) > 0 {
+		src = insertImports(fset, node, existing, missing)
+	}
+
+	var b bytes.Buffer
+	b.Write(bytes.TrimRight(src, "\n"))
+	b.WriteString("\n\n")
+	b.WriteString(testFunc)
+	return format.Source(b.Bytes())
+}
+
+// insertImports adds quoted import paths to the last import declaration of
+// a file, or after the package clause when there is none.
+func insertImports(fset *token.FileSet, node *ast.File, src []byte, quoted []string) []byte {
+	var last *ast.GenDecl
+	for _, decl := range node.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			last = gen
+		}
+	}
+
+	offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+	var out bytes.Buffer
+	switch {
+	case last == nil:
+		end := offset(node.Name.End())
+		out.Write(src[:end])
+		fmt.Fprintf(&out, "\n\nimport (\n\t%s\n)", strings.Join(quoted, "\n\t"))
+		out.Write(src[end:])
+	case last.Lparen.IsValid():
+		end := offset(last.Rparen)
+		out.Write(src[:end])
+		fmt.Fprintf(&out, "\t%s\n", strings.Join(quoted, "\n\t"))
+		out.Write(src[end:])
+	default:
+		// Turn a single-line import into a block.
+		start, end := offset(last.Pos()), offset(last.End())
+		out.Write(src[:start])
+		fmt.Fprintf(&out, "import (\n\t%s\n\t%s\n)", src[offset(last.Specs[0].Pos()):end], strings.Join(quoted, "\n\t"))
+		out.Write(src[end:])
+	}
+	return out.Bytes()
+}
+
+func runGenTestCmd(cmd *cobra.Command, args []string) error {
+	pkg, symbol, err := splitTestTarget(args[0])
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	dir, err := resolvePackageDir(pkg)
+	if err != nil {
+		return fmt.Errorf("resolving package: %w", err)
+	}
+	target, err := findTestTarget(dir, symbol)
+	if err != nil {
+		return err
+	}
+
+	testFunc := generateTestFunc(target)
+	testFile := strings.TrimSuffix(target.File, ".go") + "_test.go"
+
+	existing, err := os.ReadFile(testFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("reading test file: %w", err)
+	}
+	merged, err := mergeTestFile(existing, target.Node.Name.Name, target.testName(), testFunc, requiredImports(target, testFunc))
+	if err != nil {
+		return fmt.Errorf("generating test: %w", err)
+	}
+
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		fmt.Print(string(merged))
+		return nil
+	}
+	if err := os.WriteFile(testFile, merged, 0o644); err != nil {
+		return fmt.Errorf("writing test file: %w", err)
+	}
+	fmt.Printf("Wrote %s to %s\n", target.testName(), testFile)
+	return nil
+}
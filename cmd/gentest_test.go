@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"errors"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitTestTarget(t *testing.T) {
+	testCases := []struct {
+		name       string
+		arg        string
+		wantPkg    string
+		wantSymbol []string
+		wantErr    bool
+	}{
+		{"Test with bare function", "describeFile", ".", []string{"describeFile"}, false},
+		{"Test with package function", "store.Get", "store", []string{"Get"}, false},
+		{"Test with method", "store.Cache.Get", "store", []string{"Cache", "Get"}, false},
+		{"Test with package directory", "./internal/store.Cache.Get", "./internal/store", []string{"Cache", "Get"}, false},
+		{"Test with too many parts", "a.b.c.d", "", nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pkg, symbol, err := splitTestTarget(tc.arg)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if pkg != tc.wantPkg || !reflect.DeepEqual(symbol, tc.wantSymbol) {
+				t.Errorf("Expected %s %v, but got %s %v", tc.wantPkg, tc.wantSymbol, pkg, symbol)
+			}
+		})
+	}
+}
+
+func TestGenerateTestFunc(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"store.go": `package store
+
+import (
+	"io"
+	"time"
+)
+
+type Cache struct {
+	ttl time.Duration
+	io.Writer
+}
+
+func (c *Cache) Get(key string, _ int, opts ...string) ([]byte, bool, error) { return nil, false, nil }
+
+func parse(r io.Reader) {}
+`,
+		"tree.go": `package store
+
+type Tree struct{ size int }
+
+func (t *Tree) Size(x int) (int, error) { return t.size + x, nil }
+
+type tt []int
+
+func (tt) Len() int { return 0 }
+
+type t struct{ n int }
+
+func (test *t) N() int { return test.n }
+`,
+	})
+
+	testCases := []struct {
+		name        string
+		symbol      []string
+		wantName    string
+		wantImports []string
+		wantLines   []string
+	}{
+		{
+			name:        "Test with method on struct",
+			symbol:      []string{"Cache", "Get"},
+			wantName:    "TestCache_Get",
+			wantImports: []string{"io", "reflect", "testing", "time"},
+			wantLines: []string{
+				"ttl time.Duration",
+				"Writer io.Writer",
+				"arg1 int",
+				"opts []string",
+				"want1 bool",
+				"wantErr bool",
+				"c := &Cache{",
+				"got, got1, err := c.Get(tt.args.key, tt.args.arg1, tt.args.opts...)",
+			},
+		},
+		{
+			name:        "Test with a receiver named t",
+			symbol:      []string{"Tree", "Size"},
+			wantName:    "TestTree_Size",
+			wantImports: []string{"reflect", "testing"},
+			wantLines:   []string{"receiver := &Tree{", "got, err := receiver.Size(tt.args.x)"},
+		},
+		{
+			name:        "Test with a type named tt",
+			symbol:      []string{"tt", "Len"},
+			wantName:    "Testtt_Len",
+			wantImports: []string{"reflect", "testing"},
+			wantLines:   []string{"type receiverType = tt", "receiver receiverType", "receiver := tt.receiver", "got := receiver.Len()"},
+		},
+		{
+			name:        "Test with a type named t",
+			symbol:      []string{"t", "N"},
+			wantName:    "Testt_N",
+			wantImports: []string{"reflect", "testing"},
+			wantLines:   []string{"func Testt_N(test *testing.T) {", "test.Run(tt.name, func(test *testing.T) {", "receiver := &t{", "test.Errorf("},
+		},
+		{
+			name:        "Test with unexported function without results",
+			symbol:      []string{"parse"},
+			wantName:    "Test_parse",
+			wantImports: []string{"io", "testing"},
+			wantLines:   []string{"r io.Reader", "parse(tt.args.r)"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			target, err := findTestTarget(dir, tc.symbol)
+			if err != nil {
+				t.Fatalf("Failed to find target: %v", err)
+			}
+			if name := target.testName(); name != tc.wantName {
+				t.Errorf("Expected test name %s, but got %s", tc.wantName, name)
+			}
+
+			testFunc := generateTestFunc(target)
+			for _, line := range tc.wantLines {
+				if !strings.Contains(testFunc, line) {
+					t.Errorf("Expected generated test to contain %q:\n%s", line, testFunc)
+				}
+			}
+			imports := requiredImports(target, testFunc)
+			if !reflect.DeepEqual(imports, tc.wantImports) {
+				t.Errorf("Expected imports %v, but got %v", tc.wantImports, imports)
+			}
+
+			src, err := mergeTestFile(nil, "store", tc.wantName, testFunc, imports)
+			if err != nil {
+				t.Fatalf("Generated test does not format: %v", err)
+			}
+			// The generated test must compile with the package.
+			fset := token.NewFileSet()
+			files := []*ast.File{}
+			for _, name := range []string{"store.go", "tree.go"} {
+				file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+				if err != nil {
+					t.Fatalf("Failed to parse %s: %v", name, err)
+				}
+				files = append(files, file)
+			}
+			testFile, err := parser.ParseFile(fset, "store_test.go", src, 0)
+			if err != nil {
+				t.Fatalf("Generated test does not parse: %v", err)
+			}
+			conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+			if _, err := conf.Check("store", fset, append(files, testFile), nil); err != nil {
+				t.Errorf("Generated test does not type-check: %v\n%s", err, src)
+			}
+		})
+	}
+}
+
+func TestMergeTestFile(t *testing.T) {
+	testFunc := "func TestNew(t *testing.T) {\n\t_ = reflect.DeepEqual\n}\n"
+	imports := []string{"reflect", "testing"}
+
+	testCases := []struct {
+		name     string
+		existing string
+		wantErr  error
+		want     []string
+	}{
+		{
+			name:     "Test with import block",
+			existing: "package store\n\nimport (\n\t\"testing\"\n)\n\nfunc TestOld(t *testing.T) {}\n",
+			want:     []string{"\"reflect\"", "func TestOld", "func TestNew"},
+		},
+		{
+			name:     "Test with single import",
+			existing: "package store\n\nimport \"testing\"\n\nfunc TestOld(t *testing.T) {}\n",
+			want:     []string{"import (", "\"reflect\"", "func TestNew"},
+		},
+		{
+			name:     "Test with no imports",
+			existing: "package store\n",
+			want:     []string{"\"reflect\"", "\"testing\"", "func TestNew"},
+		},
+		{
+			name:     "Test with an empty file",
+			existing: "\n",
+			want:     []string{"package store\n", "\"reflect\"", "\"testing\"", "func TestNew"},
+		},
+		{
+			name:     "Test with existing test",
+			existing: "package store\n\nimport \"testing\"\n\nfunc TestNew(t *testing.T) {}\n",
+			wantErr:  errTestExists,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			merged, err := mergeTestFile([]byte(tc.existing), "store", "TestNew", testFunc, imports)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Expected error %v, but got %v", tc.wantErr, err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(string(merged), want) {
+					t.Errorf("Expected merged file to contain %q:\n%s", want, merged)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Render dependency graphs of a module",
+}
+
+var graphImportsCmd = &cobra.Command{
+	Use:   "imports [dir]",
+	Short: "Render the package import graph of the module containing dir",
+	Long: `Render the package import graph of the module containing dir as DOT,
+Mermaid or JSON. Each edge points from the importing package to the
+imported one.
+
+With --focus, only the packages upstream of a package (those it imports,
+directly or not), downstream of it (those importing it) or both are shown.`,
+	Example: `  gosymex graph imports --format mermaid
+  gosymex graph imports --external module --weights | dot -Tsvg > imports.svg
+  gosymex graph imports --focus cmd --direction down`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runGraphImportsCmd,
+}
+
+func init() {
+	addWalkFlags(graphImportsCmd)
+	graphImportsCmd.Flags().String("format", "dot", "Output format: dot, mermaid or json")
+	graphImportsCmd.Flags().String("external", "none", "How to show packages outside the module: none, module (one node per module) or package")
+	graphImportsCmd.Flags().Bool("std", false, "Include standard library packages, as a single std node unless --external is package")
+	graphImportsCmd.Flags().String("focus", "", "Only show packages related to this package (import path or module-relative directory)")
+	graphImportsCmd.Flags().String("direction", "both", "With --focus: up (its dependencies), down (its dependents) or both")
+	graphImportsCmd.Flags().Bool("weights", false, "Label edges with the number of importing files")
+
+	graphCmd.AddCommand(graphImportsCmd)
+	rootCmd.AddCommand(graphCmd)
+}
+
+// Node kinds of an import graph.
+const (
+	nodeInternal = "internal"
+	nodeExternal = "external"
+	nodeStd      = "std"
+)
+
+// importGraph is a package dependency graph. Nodes are import paths, or
+// module paths for collapsed external modules.
+type importGraph struct {
+	Module string
+	Nodes  []graphNode
+	Edges  []graphEdge
+}
+
+type graphNode struct {
+	ID   string
+	Kind string
+}
+
+type graphEdge struct {
+	From   string
+	To     string
+	Weight int // number of files of From importing To
+}
+
+// importGraphOptions select which imports become nodes.
+type importGraphOptions struct {
+	External string // none, module or package
+	Std      bool
+}
+
+// buildImportGraph walks the module containing dir and relates its packages
+// through their imports.
+func buildImportGraph(dir string, walkOpts walkOptions, opts importGraphOptions) (*importGraph, error) {
+	goModPath, err := findGoMod(dir)
+	if err != nil {
+		return nil, err
+	}
+	module, requires, err := readGoModFile(goModPath)
+	if err != nil {
+		return nil, err
+	}
+	moduleRoot := filepath.Dir(goModPath)
+
+	kinds := make(map[string]string)
+	weights := make(map[graphEdge]int)
+	var failures fileFailures
+	err = walkGoFiles(moduleRoot, walkOpts, func(filePath string, info os.FileInfo) error {
+		details, err := extractFile(filePath, describeOptions{})
+		failures.add(err)
+		if err != nil {
+			reportFileError(filePath, err)
+			return nil
+		}
+
+		rel, err := filepath.Rel(moduleRoot, filepath.Dir(filePath))
+		if err != nil {
+			return err
+		}
+		from := module
+		if rel != "." {
+			from = module + "/" + filepath.ToSlash(rel)
+		}
+		kinds[from] = nodeInternal
+
+		seen := make(map[string]bool)
+		for _, imp := range details.Imports {
+			to, kind := importNode(imp, module, requires, opts)
+			if to == "" || to == from || seen[to] {
+				continue
+			}
+			seen[to] = true
+			kinds[to] = kind
+			weights[graphEdge{From: from, To: to}]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &importGraph{Module: module}
+	for id, kind := range kinds {
+		graph.Nodes = append(graph.Nodes, graphNode{ID: id, Kind: kind})
+	}
+	for edge, weight := range weights {
+		edge.Weight = weight
+		graph.Edges = append(graph.Edges, edge)
+	}
+	graph.sort()
+	return graph, failures.err()
+}
+
+// importNode maps an import path to the graph node it belongs to, or to ""
+// when the options leave it out.
+func importNode(imp, module string, requires []dependency, opts importGraphOptions) (string, string) {
+	switch {
+	case imp == module || strings.HasPrefix(imp, module+"/"):
+		return imp, nodeInternal
+	case isStdImport(imp):
+		switch {
+		case !opts.Std:
+			return "", ""
+		case opts.External == "package":
+			return imp, nodeStd
+		}
+		return "std", nodeStd
+	case opts.External == "none":
+		return "", ""
+	case opts.External == "module":
+		return importModule(imp, requires), nodeExternal
+	}
+	return imp, nodeExternal
+}
+
+// isStdImport reports whether an import path belongs to the standard
+// library, whose paths have no dot in their first element.
+func isStdImport(imp string) bool {
+	first, _, _ := strings.Cut(imp, "/")
+	return !strings.Contains(first, ".")
+}
+
+// importModule returns the required module providing an import path: the
+// longest module path that is a prefix of it. Imports of modules missing from
+// go.mod stay as they are.
+func importModule(imp string, requires []dependency) string {
+	best := ""
+	for _, req := range requires {
+		if (imp == req.Name || strings.HasPrefix(imp, req.Name+"/")) && len(req.Name) > len(best) {
+			best = req.Name
+		}
+	}
+	if best == "" {
+		return imp
+	}
+	return best
+}
+
+func (g *importGraph) sort() {
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+}
+
+// resolve finds the node for a package given as an import path or as a
+// directory relative to the module root.
+func (g *importGraph) resolve(pkg string) (string, bool) {
+	candidates := []string{pkg}
+	rel := path.Clean(filepath.ToSlash(pkg))
+	if rel == "." {
+		candidates = append(candidates, g.Module)
+	} else {
+		candidates = append(candidates, g.Module+"/"+rel)
+	}
+	for _, candidate := range candidates {
+		for _, node := range g.Nodes {
+			if node.ID == candidate {
+				return candidate, true
+			}
+		}
+	}
+	return "", false
+}
+
+// focus keeps the nodes reachable from id along imports (up), against them
+// (down) or both, and the edges between them.
+func (g *importGraph) focus(id, direction string) {
+	keep := map[string]bool{id: true}
+	if direction == "up" || direction == "both" {
+		g.reach(id, keep, func(e graphEdge) (string, string) { return e.From, e.To })
+	}
+	if direction == "down" || direction == "both" {
+		g.reach(id, keep, func(e graphEdge) (string, string) { return e.To, e.From })
+	}
+
+	nodes := g.Nodes[:0]
+	for _, node := range g.Nodes {
+		if keep[node.ID] {
+			nodes = append(nodes, node)
+		}
+	}
+	g.Nodes = nodes
+
+	edges := g.Edges[:0]
+	for _, edge := range g.Edges {
+		if keep[edge.From] && keep[edge.To] {
+			edges = append(edges, edge)
+		}
+	}
+	g.Edges = edges
+}
+
+// reach adds to keep every node reachable from id following edges in the
+// orientation given by ends.
+func (g *importGraph) reach(id string, keep map[string]bool, ends func(graphEdge) (from, to string)) {
+	visited := map[string]bool{id: true}
+	queue := []string{id}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, edge := range g.Edges {
+			from, to := ends(edge)
+			if from != current || visited[to] {
+				continue
+			}
+			visited[to] = true
+			keep[to] = true
+			queue = append(queue, to)
+		}
+	}
+}
+
+// label is the display name of a node: internal packages are shown relative
+// to the module.
+func (g *importGraph) label(id string) string {
+	if id == g.Module {
+		return path.Base(g.Module)
+	}
+	return strings.TrimPrefix(id, g.Module+"/")
+}
+
+func (g *importGraph) writeDOT(w io.Writer, weights bool) {
+	fmt.Fprintln(w, "digraph imports {")
+	fmt.Fprintln(w, "\trankdir=LR;")
+	fmt.Fprintln(w, "\tnode [shape=box];")
+	for _, node := range g.Nodes {
+		attrs := fmt.Sprintf("label=%q", g.label(node.ID))
+		if node.Kind != nodeInternal {
+			attrs += ", style=dashed"
+		}
+		fmt.Fprintf(w, "\t%q [%s];\n", node.ID, attrs)
+	}
+	for _, edge := range g.Edges {
+		if weights {
+			fmt.Fprintf(w, "\t%q -> %q [label=\"%d\"];\n", edge.From, edge.To, edge.Weight)
+		} else {
+			fmt.Fprintf(w, "\t%q -> %q;\n", edge.From, edge.To)
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
+
+func (g *importGraph) writeMermaid(w io.Writer, weights bool) {
+	// Mermaid ids cannot hold slashes or dots, so nodes are numbered.
+	ids := make(map[string]string, len(g.Nodes))
+	fmt.Fprintln(w, "graph LR")
+	for i, node := range g.Nodes {
+		ids[node.ID] = fmt.Sprintf("n%d", i)
+		if node.Kind == nodeInternal {
+			fmt.Fprintf(w, "\t%s[\"%s\"]\n", ids[node.ID], g.label(node.ID))
+		} else {
+			fmt.Fprintf(w, "\t%s([\"%s\"])\n", ids[node.ID], g.label(node.ID))
+		}
+	}
+	for _, edge := range g.Edges {
+		if weights {
+			fmt.Fprintf(w, "\t%s -->|%d| %s\n", ids[edge.From], edge.Weight, ids[edge.To])
+		} else {
+			fmt.Fprintf(w, "\t%s --> %s\n", ids[edge.From], ids[edge.To])
+		}
+	}
+}
+
+func runGraphImportsCmd(cmd *cobra.Command, args []string) error {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+
+	var opts importGraphOptions
+	opts.External, _ = cmd.Flags().GetString("external")
+	opts.Std, _ = cmd.Flags().GetBool("std")
+	format, _ := cmd.Flags().GetString("format")
+	focus, _ := cmd.Flags().GetString("focus")
+	direction, _ := cmd.Flags().GetString("direction")
+	weights, _ := cmd.Flags().GetBool("weights")
+
+	switch {
+	case opts.External != "none" && opts.External != "module" && opts.External != "package":
+		return withExitCode(exitUsage, fmt.Errorf("invalid --external %q: must be none, module or package", opts.External))
+	case format != "dot" && format != "mermaid" && format != "json":
+		return withExitCode(exitUsage, fmt.Errorf("invalid --format %q: must be dot, mermaid or json", format))
+	case direction != "up" && direction != "down" && direction != "both":
+		return withExitCode(exitUsage, fmt.Errorf("invalid --direction %q: must be up, down or both", direction))
+	}
+
+	graph, err := buildImportGraph(dir, walkOptionsFromFlags(cmd), opts)
+	if graph == nil {
+		return err
+	}
+	if focus != "" {
+		id, ok := graph.resolve(focus)
+		if !ok {
+			return fmt.Errorf("package '%s' not found in the graph", focus)
+		}
+		graph.focus(id, direction)
+	}
+
+	switch format {
+	case "mermaid":
+		graph.writeMermaid(os.Stdout, weights)
+	case "json":
+		jsonGraph, _ := json.MarshalIndent(graph, "", "  ")
+		fmt.Println(string(jsonGraph))
+	default:
+		graph.writeDOT(os.Stdout, weights)
+	}
+	return err
+}
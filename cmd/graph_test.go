@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildImportGraph(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.21\n\nrequire github.com/x/y v1.0.0\n",
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/m/a"
+)
+`,
+		"a/a.go": `package a
+
+import (
+	"example.com/m/b"
+	"github.com/x/y/z"
+)
+`,
+		"a/a2.go": `package a
+
+import (
+	"example.com/m/b"
+	"github.com/x/y"
+	"strings"
+)
+`,
+		"b/b.go": "package b\n",
+	})
+
+	edges := func(g *importGraph) []string {
+		var out []string
+		for _, e := range g.Edges {
+			out = append(out, strings.TrimPrefix(e.From, "example.com/m/")+" -> "+strings.TrimPrefix(e.To, "example.com/m/")+" "+strings.Repeat("*", e.Weight))
+		}
+		return out
+	}
+
+	testCases := []struct {
+		name      string
+		opts      importGraphOptions
+		focus     string
+		direction string
+		want      []string
+	}{
+		{
+			name: "Test with internal packages only",
+			opts: importGraphOptions{External: "none"},
+			want: []string{"example.com/m -> a *", "a -> b **"},
+		},
+		{
+			name: "Test with external modules collapsed",
+			opts: importGraphOptions{External: "module"},
+			want: []string{"example.com/m -> a *", "a -> b **", "a -> github.com/x/y **"},
+		},
+		{
+			name: "Test with external packages and std",
+			opts: importGraphOptions{External: "package", Std: true},
+			want: []string{"example.com/m -> a *", "example.com/m -> fmt *", "a -> b **", "a -> github.com/x/y *", "a -> github.com/x/y/z *", "a -> strings *"},
+		},
+		{
+			name:      "Test with std collapsed",
+			opts:      importGraphOptions{External: "none", Std: true},
+			focus:     "a",
+			direction: "up",
+			want:      []string{"a -> b **", "a -> std *"},
+		},
+		{
+			name:      "Test with downstream focus",
+			opts:      importGraphOptions{External: "none"},
+			focus:     "./b",
+			direction: "down",
+			want:      []string{"example.com/m -> a *", "a -> b **"},
+		},
+		{
+			name:      "Test with upstream focus",
+			opts:      importGraphOptions{External: "none"},
+			focus:     "example.com/m/a",
+			direction: "up",
+			want:      []string{"a -> b **"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			graph, err := buildImportGraph(dir, walkOptions{}, tc.opts)
+			if err != nil {
+				t.Fatalf("buildImportGraph() error = %v", err)
+			}
+			if tc.focus != "" {
+				id, ok := graph.resolve(tc.focus)
+				if !ok {
+					t.Fatalf("Failed to resolve %s", tc.focus)
+				}
+				graph.focus(id, tc.direction)
+			}
+			if got := edges(graph); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected edges %v, but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestImportGraphRender(t *testing.T) {
+	graph := &importGraph{
+		Module: "example.com/m",
+		Nodes: []graphNode{
+			{ID: "example.com/m", Kind: nodeInternal},
+			{ID: "example.com/m/a", Kind: nodeInternal},
+			{ID: "github.com/x/y", Kind: nodeExternal},
+		},
+		Edges: []graphEdge{
+			{From: "example.com/m", To: "example.com/m/a", Weight: 1},
+			{From: "example.com/m/a", To: "github.com/x/y", Weight: 2},
+		},
+	}
+
+	var dot strings.Builder
+	graph.writeDOT(&dot, true)
+	for _, want := range []string{
+		`"example.com/m" [label="m"];`,
+		`"github.com/x/y" [label="github.com/x/y", style=dashed];`,
+		`"example.com/m/a" -> "github.com/x/y" [label="2"];`,
+	} {
+		if !strings.Contains(dot.String(), want) {
+			t.Errorf("Expected DOT output to contain %s:\n%s", want, dot.String())
+		}
+	}
+
+	var mermaid strings.Builder
+	graph.writeMermaid(&mermaid, false)
+	want := "graph LR\n\tn0[\"m\"]\n\tn1[\"a\"]\n\tn2([\"github.com/x/y\"])\n\tn0 --> n1\n\tn1 --> n2\n"
+	if mermaid.String() != want {
+		t.Errorf("Expected Mermaid output:\n%s\nbut got:\n%s", want, mermaid.String())
+	}
+}
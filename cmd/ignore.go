@@ -0,0 +1,390 @@
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Ignore files honoured while walking a tree, in order of precedence.
+const (
+	gitignoreFile     = ".gitignore"
+	gosymexignoreFile = ".gosymexignore"
+)
+
+// generatedHeader is the standard marker for generated Go files, see
+// https://golang.org/s/generatedcode.
+var generatedHeader = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// walkOptions selects which files a recursive walk visits.
+type walkOptions struct {
+	IncludeTests     bool
+	IncludeMocks     bool
+	IncludeVendor    bool // vendor/ and node_modules/
+	IncludeTestdata  bool
+	IncludeHidden    bool // directories starting with a dot, such as .git
+	IncludeGenerated bool
+	NoGitignore      bool
+	NoGosymexignore  bool
+	GOOS             string
+	GOARCH           string
+	Tags             []string
+	Include          []string // globs a file must match, relative to the walk root
+	Exclude          []string // globs of files and directories to leave out
+}
+
+// addWalkFlags registers the flags that populate walkOptions.
+func addWalkFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("include-tests", "t", false, "Include test files in the recursive walk")
+	addTreeWalkFlags(cmd)
+}
+
+// addTreeWalkFlags registers the walk flags other than --include-tests, for
+// commands that decide about test files themselves.
+func addTreeWalkFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("include-mocks", "m", false, "Include mock files in the recursive walk")
+	cmd.Flags().Bool("include-vendor", false, "Walk into vendor and node_modules directories")
+	cmd.Flags().Bool("include-testdata", false, "Walk into testdata directories")
+	cmd.Flags().Bool("include-hidden", false, "Walk into directories starting with a dot, such as .git")
+	cmd.Flags().Bool("include-generated", false, "Include files with a \"// Code generated ... DO NOT EDIT.\" header")
+	cmd.Flags().Bool("no-gitignore", false, "Do not honour .gitignore files")
+	cmd.Flags().Bool("no-gosymexignore", false, "Do not honour .gosymexignore files")
+	cmd.Flags().StringSlice("include", nil, "Only include files matching these globs, relative to the walked directory")
+	cmd.Flags().StringSlice("exclude", nil, "Leave out files and directories matching these globs, relative to the walked directory")
+	addConstraintFlags(cmd)
+}
+
+// walkOptionsFromFlags reads the flags registered by addWalkFlags.
+func walkOptionsFromFlags(cmd *cobra.Command) walkOptions {
+	var opts walkOptions
+	opts.IncludeTests, _ = cmd.Flags().GetBool("include-tests")
+	opts.IncludeMocks, _ = cmd.Flags().GetBool("include-mocks")
+	opts.IncludeVendor, _ = cmd.Flags().GetBool("include-vendor")
+	opts.IncludeTestdata, _ = cmd.Flags().GetBool("include-testdata")
+	opts.IncludeHidden, _ = cmd.Flags().GetBool("include-hidden")
+	opts.IncludeGenerated, _ = cmd.Flags().GetBool("include-generated")
+	opts.NoGitignore, _ = cmd.Flags().GetBool("no-gitignore")
+	opts.NoGosymexignore, _ = cmd.Flags().GetBool("no-gosymexignore")
+	opts.GOOS, _ = cmd.Flags().GetString("goos")
+	opts.GOARCH, _ = cmd.Flags().GetString("goarch")
+	opts.Tags, _ = cmd.Flags().GetStringSlice("tags")
+	opts.Include, _ = cmd.Flags().GetStringSlice("include")
+	opts.Exclude, _ = cmd.Flags().GetStringSlice("exclude")
+	return opts
+}
+
+// flags returns the walk flags that give opts, as they would be typed, or
+// "" for the defaults.
+func (opts walkOptions) flags() string {
+	var flags []string
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{
+		{"include-tests", opts.IncludeTests},
+		{"include-mocks", opts.IncludeMocks},
+		{"include-vendor", opts.IncludeVendor},
+		{"include-testdata", opts.IncludeTestdata},
+		{"include-hidden", opts.IncludeHidden},
+		{"include-generated", opts.IncludeGenerated},
+		{"no-gitignore", opts.NoGitignore},
+		{"no-gosymexignore", opts.NoGosymexignore},
+	} {
+		if flag.set {
+			flags = append(flags, "--"+flag.name)
+		}
+	}
+	for _, flag := range []struct {
+		name  string
+		value string
+	}{
+		{"goos", opts.GOOS},
+		{"goarch", opts.GOARCH},
+		{"tags", strings.Join(opts.Tags, ",")},
+		{"include", strings.Join(opts.Include, ",")},
+		{"exclude", strings.Join(opts.Exclude, ",")},
+	} {
+		if flag.value != "" {
+			flags = append(flags, "--"+flag.name+"="+flag.value)
+		}
+	}
+	return strings.Join(flags, " ")
+}
+
+// ignoreFiles returns the names of the ignore files the options honour.
+func (opts walkOptions) ignoreFiles() []string {
+	var names []string
+	if !opts.NoGitignore {
+		names = append(names, gitignoreFile)
+	}
+	if !opts.NoGosymexignore {
+		names = append(names, gosymexignoreFile)
+	}
+	return names
+}
+
+// skipDir reports whether a directory below the walk root is skipped by name.
+func (opts walkOptions) skipDir(name string) bool {
+	switch {
+	case name == "vendor" || name == "node_modules":
+		return !opts.IncludeVendor
+	case name == "testdata":
+		return !opts.IncludeTestdata
+	case strings.HasPrefix(name, ".") && name != "." && name != "..":
+		return !opts.IncludeHidden
+	}
+	return false
+}
+
+// walkGoFiles calls fn for every Go file under root selected by opts.
+func walkGoFiles(root string, opts walkOptions, fn func(filePath string, info os.FileInfo) error) error {
+	ignore := &ignoreMatcher{}
+	for _, dir := range ignoreAncestors(root) {
+		ignore.loadDir(dir, opts.ignoreFiles())
+	}
+	include, exclude := newGlobMatcher(root, opts.Include), newGlobMatcher(root, opts.Exclude)
+
+	return filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if filePath != root && (opts.skipDir(info.Name()) || ignore.match(filePath, true) || exclude.match(filePath, true)) {
+				return filepath.SkipDir
+			}
+			ignore.loadDir(filePath, opts.ignoreFiles())
+			return nil
+		}
+		if !isGoFile(filePath, info, opts.IncludeTests) || ignore.match(filePath, false) || !opts.matchesBuild(filePath) {
+			return nil
+		}
+		if exclude.match(filePath, false) || (len(opts.Include) > 0 && !include.match(filePath, false)) {
+			return nil
+		}
+		// The header is read once, and only when the name does not settle
+		// what is needed.
+		mock := isMockFileName(filePath)
+		if mock && !opts.IncludeMocks {
+			return nil
+		}
+		if !opts.IncludeMocks || !opts.IncludeGenerated {
+			header := readFileHeader(filePath)
+			mock = mock || header.mock()
+			if mock && !opts.IncludeMocks {
+				return nil
+			}
+			// Mocks are generated too, but --include-mocks asks for them
+			// explicitly.
+			if header.generated && !opts.IncludeGenerated && !(opts.IncludeMocks && mock) {
+				return nil
+			}
+		}
+		return fn(filePath, info)
+	})
+}
+
+// ignoreAncestors returns the directories above root, outermost first, whose
+// ignore files apply to it: those up to the enclosing git repository root.
+func ignoreAncestors(root string) []string {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil
+	}
+	if info, err := os.Stat(abs); err == nil && !info.IsDir() {
+		abs = filepath.Dir(abs)
+	}
+
+	var dirs []string
+	for dir := abs; ; {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			// Not inside a repository: only the root's own files apply,
+			// and those are loaded by the walk itself.
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		dir = parent
+		dirs = append([]string{dir}, dirs...)
+	}
+
+	// The walk loads root itself; convert the ancestors back to paths
+	// relative to how root was given so rules match walked paths.
+	rel := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		if r, err := filepath.Rel(abs, dir); err == nil {
+			rel = append(rel, filepath.Join(root, r))
+		}
+	}
+	return rel
+}
+
+// fileHeader is what the lines of a Go file up to its package clause say
+// about it.
+type fileHeader struct {
+	generated     bool   // the standard generated code header
+	mockGenerator bool   // the header of a mock generator
+	pkg           string // the package name, "" if there is no clause
+}
+
+// readFileHeader reads the lines of a Go file up to its package clause.
+func readFileHeader(filePath string) fileHeader {
+	var header fileHeader
+	file, err := os.Open(filePath)
+	if err != nil {
+		return header
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		header.generated = header.generated || generatedHeader.MatchString(line)
+		header.mockGenerator = header.mockGenerator || mockGeneratorHeader.MatchString(line)
+		if name, ok := strings.CutPrefix(line, "package "); ok {
+			header.pkg = strings.TrimSpace(name)
+			break
+		}
+	}
+	return header
+}
+
+// ignoreRule is one pattern of an ignore file.
+type ignoreRule struct {
+	base    string // directory holding the ignore file
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreMatcher evaluates gitignore-style rules collected from ignore files
+// throughout a tree. Later rules, and rules from deeper directories, take
+// precedence over earlier ones.
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+// loadDir reads the named ignore files in dir, skipping missing ones.
+func (m *ignoreMatcher) loadDir(dir string, names []string) {
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		m.add(dir, string(data))
+	}
+}
+
+// add parses the content of an ignore file located in base.
+func (m *ignoreMatcher) add(base, content string) {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		// A slash anywhere but the end anchors the pattern to base;
+		// otherwise it matches a name at any depth.
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		expr := globToRegexp(line)
+		if anchored {
+			expr = "^" + expr + "$"
+		} else {
+			expr = "^(?:.*/)?" + expr + "$"
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			continue
+		}
+		rule.pattern = re
+		m.rules = append(m.rules, rule)
+	}
+}
+
+// newGlobMatcher matches paths below root against globs given on the command
+// line or in the config file, with the same syntax as ignore files.
+func newGlobMatcher(root string, globs []string) *ignoreMatcher {
+	m := &ignoreMatcher{}
+	m.add(root, strings.Join(globs, "\n"))
+	return m
+}
+
+// match reports whether the path is ignored.
+func (m *ignoreMatcher) match(filePath string, isDir bool) bool {
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(rule.base, filePath)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if rule.pattern.MatchString(filepath.ToSlash(rel)) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// globToRegexp translates a gitignore glob to a regular expression.
+func globToRegexp(glob string) string {
+	var expr strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			expr.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return expr.String()
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	matcher := &ignoreMatcher{}
+	matcher.add("root", `# comment
+*.pb.go
+!keep.pb.go
+/build
+docs/
+internal/**/fixtures
+gen_?.go
+`)
+
+	// Define a table of test cases
+	testCases := []struct {
+		name  string
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{name: "Test with a basename glob", path: "root/api/service.pb.go", want: true},
+		{name: "Test with a negated pattern", path: "root/api/keep.pb.go", want: false},
+		{name: "Test with an anchored pattern at the base", path: "root/build", isDir: true, want: true},
+		{name: "Test with an anchored pattern below the base", path: "root/cmd/build", isDir: true, want: false},
+		{name: "Test with a directory-only pattern on a directory", path: "root/pkg/docs", isDir: true, want: true},
+		{name: "Test with a directory-only pattern on a file", path: "root/pkg/docs", isDir: false, want: false},
+		{name: "Test with a double star", path: "root/internal/a/b/fixtures", isDir: true, want: true},
+		{name: "Test with a single character wildcard", path: "root/gen_1.go", want: true},
+		{name: "Test with a path outside the base", path: "other/service.pb.go", want: false},
+		{name: "Test with an unmatched file", path: "root/main.go", want: false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if got := matcher.match(filepath.FromSlash(testCase.path), testCase.isDir); got != testCase.want {
+				t.Errorf("match(%q) = %v, want %v", testCase.path, got, testCase.want)
+			}
+		})
+	}
+}
+
+// writeTree creates the given files, relative to dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestWalkGoFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".gitignore":           "ignored/\n",
+		"pkg/.gosymexignore":   "skip_*.go\n",
+		"main.go":              "package main\n",
+		"main_test.go":         "package main\n",
+		"pkg/a.go":             "package pkg\n",
+		"pkg/skip_me.go":       "package pkg\n",
+		"pkg/gen.go":           "// Code generated by stringer. DO NOT EDIT.\n\npackage pkg\n",
+		"pkg/store_mock.go":    "package pkg\n",
+		"pkg/mock_gen.go":      "// Code generated by MockGen. DO NOT EDIT.\n\npackage pkg\n",
+		"pkg/fake.go":          "// Code generated by moq; DO NOT EDIT.\n\npackage pkg\n",
+		"ignored/b.go":         "package ignored\n",
+		"vendor/dep/dep.go":    "package dep\n",
+		"pkg/testdata/data.go": "package data\n",
+		".git/hooks/hook.go":   "package hooks\n",
+	})
+
+	// Define a table of test cases
+	testCases := []struct {
+		name string
+		opts walkOptions
+		want []string
+	}{
+		{
+			name: "Test with the default rules",
+			opts: walkOptions{},
+			want: []string{"main.go", "pkg/a.go"},
+		},
+		{
+			name: "Test with every rule switched off",
+			opts: walkOptions{
+				IncludeTests:     true,
+				IncludeVendor:    true,
+				IncludeTestdata:  true,
+				IncludeHidden:    true,
+				IncludeGenerated: true,
+				NoGitignore:      true,
+				NoGosymexignore:  true,
+			},
+			want: []string{
+				".git/hooks/hook.go", "ignored/b.go", "main.go", "main_test.go", "pkg/a.go",
+				"pkg/gen.go", "pkg/skip_me.go", "pkg/testdata/data.go", "vendor/dep/dep.go",
+			},
+		},
+		{
+			name: "Test with mocks included",
+			opts: walkOptions{IncludeMocks: true},
+			want: []string{"main.go", "pkg/a.go", "pkg/fake.go", "pkg/mock_gen.go", "pkg/store_mock.go"},
+		},
+		{
+			name: "Test with ignore files only switched off",
+			opts: walkOptions{NoGitignore: true, NoGosymexignore: true},
+			want: []string{"ignored/b.go", "main.go", "pkg/a.go", "pkg/skip_me.go"},
+		},
+		{
+			name: "Test with include and exclude globs",
+			opts: walkOptions{IncludeTests: true, NoGosymexignore: true, Include: []string{"pkg/**", "*_test.go"}, Exclude: []string{"skip_*.go"}},
+			want: []string{"main_test.go", "pkg/a.go"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var got []string
+			err := walkGoFiles(dir, testCase.opts, func(filePath string, info os.FileInfo) error {
+				rel, _ := filepath.Rel(dir, filePath)
+				got = append(got, filepath.ToSlash(rel))
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("walkGoFiles() error = %v", err)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, testCase.want) {
+				t.Errorf("walkGoFiles() = %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,356 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var mcpCmd = &cobra.Command{
+	Use:   "mcp [dir]",
+	Short: "Run a Model Context Protocol server on stdio",
+	Long: `Run a Model Context Protocol (MCP) server that reads JSON-RPC requests from
+stdin and writes responses to stdout, one message per line. Assistants that
+speak MCP can then describe files and packages, extract declarations, find
+references and inspect the module directly.
+
+Relative paths in tool arguments are resolved against dir, which defaults to
+the working directory. The walk flags apply to every tool.`,
+	Example: `  gosymex mcp
+  gosymex mcp --include-tests ./service`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runMCPCmd,
+}
+
+func init() {
+	addWalkFlags(mcpCmd)
+	rootCmd.AddCommand(mcpCmd)
+}
+
+func runMCPCmd(cmd *cobra.Command, args []string) error {
+	root := "."
+	if len(args) > 0 {
+		root = args[0]
+	}
+	if _, err := os.Stat(root); err != nil {
+		return fmt.Errorf("accessing path: %w", err)
+	}
+	server := newMCPServer(root, walkOptionsFromFlags(cmd))
+	return server.serve(os.Stdin, os.Stdout)
+}
+
+// mcpProtocolVersions are the MCP revisions the server speaks, newest first.
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// The wire format of JSON-RPC 2.0 fixes its key names, so these types carry
+// json tags unlike the rest of gosymex output.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mcpTool is a tool offered to clients. Call receives the arguments of a
+// tools/call request and returns the value reported back as JSON text.
+type mcpTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+	call        func(args toolArguments) (interface{}, error)
+}
+
+// toolArguments are the arguments of every tool; each tool reads the ones
+// its input schema declares.
+type toolArguments struct {
+	Path         string `json:"path"`
+	Name         string `json:"name"`
+	IncludeTests bool   `json:"include_tests"`
+}
+
+type mcpServer struct {
+	root  string
+	opts  walkOptions
+	tools []mcpTool
+}
+
+func newMCPServer(root string, opts walkOptions) *mcpServer {
+	s := &mcpServer{root: root, opts: opts}
+	pathArg := func(description string) map[string]interface{} {
+		return map[string]interface{}{"type": "string", "description": description}
+	}
+	nameArg := map[string]interface{}{"type": "string", "description": "Symbol name: Name, Type.Method or (*Type).Method"}
+	s.tools = []mcpTool{
+		{
+			Name:        "describe_file",
+			Description: "Describe a Go file: its imports, structs, interfaces and functions.",
+			InputSchema: toolSchema(map[string]interface{}{"path": pathArg("Path of the Go file")}, "path"),
+			call:        s.describeFile,
+		},
+		{
+			Name:        "describe_package",
+			Description: "Describe every Go file of the package in a directory.",
+			InputSchema: toolSchema(map[string]interface{}{
+				"path":          pathArg("Directory of the package (default is the server root)"),
+				"include_tests": map[string]interface{}{"type": "boolean", "description": "Also describe _test.go files"},
+			}),
+			call: s.describePackage,
+		},
+		{
+			Name:        "extract_symbol",
+			Description: "Return the source of a top-level declaration, with its doc comment.",
+			InputSchema: toolSchema(map[string]interface{}{
+				"name": nameArg,
+				"path": pathArg("File or directory to search (default is the server root)"),
+			}, "name"),
+			call: s.extractSymbol,
+		},
+		{
+			Name:        "find_references",
+			Description: "List the uses of a symbol, matched by name, with file, line and source text.",
+			InputSchema: toolSchema(map[string]interface{}{
+				"name": nameArg,
+				"path": pathArg("File or directory to search (default is the server root)"),
+			}, "name"),
+			call: s.findReferences,
+		},
+		{
+			Name:        "detect_project",
+			Description: "Report the Go module containing a path and its dependencies.",
+			InputSchema: toolSchema(map[string]interface{}{"path": pathArg("Path inside the project (default is the server root)")}),
+			call:        s.detectProject,
+		},
+	}
+	return s
+}
+
+func toolSchema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// serve answers requests read from r, one JSON message per line, until r
+// is exhausted.
+func (s *mcpServer) serve(r io.Reader, w io.Writer) error {
+	reader := bufio.NewReader(r)
+	encoder := json.NewEncoder(w)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if response := s.handle(line); response != nil {
+				if err := encoder.Encode(response); err != nil {
+					return fmt.Errorf("writing response: %w", err)
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading request: %w", err)
+		}
+	}
+}
+
+// handle answers one message. Notifications, which carry no id, get no
+// response.
+func (s *mcpServer) handle(message []byte) *rpcResponse {
+	if len(bytes.TrimSpace(message)) == 0 {
+		return nil
+	}
+	var request rpcRequest
+	if err := json.Unmarshal(message, &request); err != nil {
+		return &rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcParseError, Message: err.Error()}}
+	}
+	if request.ID == nil {
+		return nil
+	}
+
+	response := &rpcResponse{JSONRPC: "2.0", ID: request.ID}
+	result, rpcErr := s.dispatch(request)
+	if rpcErr != nil {
+		response.Error = rpcErr
+	} else {
+		response.Result = result
+	}
+	return response
+}
+
+func (s *mcpServer) dispatch(request rpcRequest) (interface{}, *rpcError) {
+	if request.JSONRPC != "2.0" {
+		return nil, &rpcError{Code: rpcInvalidRequest, Message: "jsonrpc must be \"2.0\""}
+	}
+	switch request.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(request.Params, &params)
+		protocol := mcpProtocolVersions[0]
+		for _, supported := range mcpProtocolVersions {
+			if params.ProtocolVersion == supported {
+				protocol = supported
+			}
+		}
+		return map[string]interface{}{
+			"protocolVersion": protocol,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]interface{}{"name": toolName, "version": version},
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": s.tools}, nil
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		return s.callTool(params.Name, params.Arguments)
+	}
+	return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("method '%s' not found", request.Method)}
+}
+
+// callTool runs a tool. Failures of the tool itself are reported in the
+// result with isError set, as MCP asks, so that the model can see them.
+func (s *mcpServer) callTool(name string, rawArgs json.RawMessage) (interface{}, *rpcError) {
+	for _, tool := range s.tools {
+		if tool.Name != name {
+			continue
+		}
+		var args toolArguments
+		if len(rawArgs) > 0 {
+			if err := json.Unmarshal(rawArgs, &args); err != nil {
+				return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+			}
+		}
+		if required, ok := tool.InputSchema["required"].([]string); ok {
+			for _, arg := range required {
+				if (arg == "path" && args.Path == "") || (arg == "name" && args.Name == "") {
+					return nil, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("missing argument '%s'", arg)}
+				}
+			}
+		}
+
+		value, err := tool.call(args)
+		if err != nil {
+			return toolResult(err.Error(), true), nil
+		}
+		text, _ := json.MarshalIndent(value, "", "  ")
+		return toolResult(string(text), false), nil
+	}
+	return nil, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("unknown tool '%s'", name)}
+}
+
+func toolResult(text string, isError bool) map[string]interface{} {
+	return map[string]interface{}{
+		"content": []map[string]interface{}{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
+
+// resolve makes a tool path relative to the server root.
+func (s *mcpServer) resolve(path string) string {
+	if path == "" {
+		return s.root
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(s.root, path)
+}
+
+func (s *mcpServer) describeFile(args toolArguments) (interface{}, error) {
+	return describeDetails(s.resolve(args.Path), describeOptions{})
+}
+
+func (s *mcpServer) describePackage(args toolArguments) (interface{}, error) {
+	opts := s.opts
+	opts.IncludeTests = opts.IncludeTests || args.IncludeTests
+	return describePackage(s.resolve(args.Path), opts)
+}
+
+func (s *mcpServer) extractSymbol(args toolArguments) (interface{}, error) {
+	found, err := findSymbol(s.resolve(args.Path), s.opts, args.Name)
+	if err == nil && len(found) == 0 {
+		err = fmt.Errorf("symbol '%s' not found", args.Name)
+	}
+	return found, err
+}
+
+func (s *mcpServer) findReferences(args toolArguments) (interface{}, error) {
+	refs, err := findReferences(s.resolve(args.Path), s.opts, args.Name)
+	if refs == nil {
+		refs = []symbolReference{}
+	}
+	return refs, err
+}
+
+func (s *mcpServer) detectProject(args toolArguments) (interface{}, error) {
+	return describeProject(s.resolve(args.Path))
+}
+
+// describePackage describes the Go files directly in dir, not those of
+// packages below it.
+func describePackage(dir string, opts walkOptions) (*describeOutput, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("accessing path: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("'%s' is not a directory", dir)
+	}
+
+	out := newDescribeOutput(opts, describeOptions{})
+	// Leave out every directory below dir.
+	opts.Exclude = append(append([]string{}, opts.Exclude...), "*/")
+	err = walkGoFiles(dir, opts, func(filePath string, info os.FileInfo) error {
+		details, err := describeDetails(filePath, describeOptions{})
+		if err != nil {
+			out.addError(filePath, err)
+			return nil
+		}
+		out.Files = append(out.Files, details)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Files) == 0 && len(out.Errors) == 0 {
+		return nil, fmt.Errorf("no Go files in '%s'", dir)
+	}
+	return out, nil
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+// stubClient drives an MCP server over a pipe, one request at a time.
+type stubClient struct {
+	t       *testing.T
+	send    io.Writer
+	receive *json.Decoder
+	nextID  int
+}
+
+func newStubClient(t *testing.T, server *mcpServer) *stubClient {
+	requests, requestWriter := io.Pipe()
+	responseReader, responses := io.Pipe()
+	go func() {
+		server.serve(requests, responses)
+		responses.Close()
+	}()
+	t.Cleanup(func() { requestWriter.Close() })
+	return &stubClient{t: t, send: requestWriter, receive: json.NewDecoder(responseReader)}
+}
+
+func (c *stubClient) notify(method string) {
+	c.t.Helper()
+	io.WriteString(c.send, `{"jsonrpc":"2.0","method":"`+method+`"}`+"\n")
+}
+
+// call sends a request and decodes the result of its response into result.
+func (c *stubClient) call(method string, params interface{}, result interface{}) *rpcError {
+	c.t.Helper()
+	c.nextID++
+	request, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": c.nextID, "method": method, "params": params})
+	if _, err := c.send.Write(append(request, '\n')); err != nil {
+		c.t.Fatalf("Failed to send %s: %v", method, err)
+	}
+
+	var response struct {
+		ID     int
+		Result json.RawMessage
+		Error  *rpcError
+	}
+	if err := c.receive.Decode(&response); err != nil {
+		c.t.Fatalf("Failed to read the response to %s: %v", method, err)
+	}
+	if response.ID != c.nextID {
+		c.t.Fatalf("Expected response id %d, but got %d", c.nextID, response.ID)
+	}
+	if response.Error == nil && result != nil {
+		if err := json.Unmarshal(response.Result, result); err != nil {
+			c.t.Fatalf("Failed to decode the result of %s: %v", method, err)
+		}
+	}
+	return response.Error
+}
+
+type toolCallResult struct {
+	Content []struct {
+		Type string
+		Text string
+	}
+	IsError bool
+}
+
+func TestMCPServer(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":            "module example.com/shapes\n\ngo 1.21\n\nrequire github.com/x/y v1.0.0\n",
+		"shapes.go":         symbolsFixture,
+		"shapes_test.go":    "package shapes\n\nfunc helper() {}\n",
+		"circle/circle.go":  "package circle\n\ntype Circle struct{}\n",
+		"broken/broken.go":  "package broken\n\nfunc {",
+		"broken/working.go": "package broken\n",
+	})
+	client := newStubClient(t, newMCPServer(dir, walkOptions{}))
+
+	var initialized struct {
+		ProtocolVersion string
+		ServerInfo      struct{ Name string }
+	}
+	if err := client.call("initialize", map[string]interface{}{"protocolVersion": "2024-11-05"}, &initialized); err != nil {
+		t.Fatalf("initialize failed: %v", err.Message)
+	}
+	if initialized.ProtocolVersion != "2024-11-05" || initialized.ServerInfo.Name != "gosymex" {
+		t.Errorf("Unexpected initialize result %+v", initialized)
+	}
+	client.notify("notifications/initialized")
+
+	var listed struct{ Tools []struct{ Name string } }
+	client.call("tools/list", nil, &listed)
+	var names []string
+	for _, tool := range listed.Tools {
+		names = append(names, tool.Name)
+	}
+	if got := strings.Join(names, " "); got != "describe_file describe_package extract_symbol find_references detect_project" {
+		t.Errorf("Unexpected tools: %s", got)
+	}
+
+	testCases := []struct {
+		name    string
+		tool    string
+		args    map[string]interface{}
+		isError bool
+		expect  []string
+	}{
+		{
+			name:   "Test with describe_file",
+			tool:   "describe_file",
+			args:   map[string]interface{}{"path": "shapes.go"},
+			expect: []string{`"Square": [`, `"NewSquare() returns (*Square)"`},
+		},
+		{
+			name:   "Test with describe_package",
+			tool:   "describe_package",
+			args:   map[string]interface{}{},
+			expect: []string{`"SchemaVersion"`, `shapes.go"`},
+		},
+		{
+			name:   "Test with describe_package and a broken file",
+			tool:   "describe_package",
+			args:   map[string]interface{}{"path": "broken"},
+			expect: []string{`working.go"`, `"Code": 4`},
+		},
+		{
+			name:   "Test with extract_symbol",
+			tool:   "extract_symbol",
+			args:   map[string]interface{}{"name": "Circle"},
+			expect: []string{`"Source": "type Circle struct{}"`},
+		},
+		{
+			name:   "Test with find_references",
+			tool:   "find_references",
+			args:   map[string]interface{}{"name": "Square.Area", "path": "shapes.go"},
+			expect: []string{`"Text": "_ = sq.Area()"`},
+		},
+		{
+			name:   "Test with detect_project",
+			tool:   "detect_project",
+			args:   map[string]interface{}{"path": "circle"},
+			expect: []string{`"Module": "example.com/shapes"`, `"Name": "github.com/x/y"`},
+		},
+		{
+			name:    "Test with a tool failure",
+			tool:    "describe_file",
+			args:    map[string]interface{}{"path": "missing.go"},
+			isError: true,
+			expect:  []string{"no such file"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var result toolCallResult
+			if err := client.call("tools/call", map[string]interface{}{"name": tc.tool, "arguments": tc.args}, &result); err != nil {
+				t.Fatalf("tools/call failed: %s", err.Message)
+			}
+			if result.IsError != tc.isError || len(result.Content) != 1 {
+				t.Fatalf("Unexpected result %+v", result)
+			}
+			for _, want := range tc.expect {
+				if !strings.Contains(result.Content[0].Text, want) {
+					t.Errorf("Expected the result to contain %s:\n%s", want, result.Content[0].Text)
+				}
+			}
+			if strings.Contains(result.Content[0].Text, "helper") {
+				t.Errorf("Expected test files to be left out:\n%s", result.Content[0].Text)
+			}
+		})
+	}
+
+	errorCases := []struct {
+		name   string
+		method string
+		params interface{}
+		code   int
+	}{
+		{"Test with an unknown method", "resources/list", nil, rpcMethodNotFound},
+		{"Test with an unknown tool", "tools/call", map[string]interface{}{"name": "rename"}, rpcInvalidParams},
+		{"Test with a missing argument", "tools/call", map[string]interface{}{"name": "extract_symbol", "arguments": map[string]interface{}{}}, rpcInvalidParams},
+	}
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := client.call(tc.method, tc.params, nil)
+			if err == nil || err.Code != tc.code {
+				t.Errorf("Expected error code %d, but got %+v", tc.code, err)
+			}
+		})
+	}
+}
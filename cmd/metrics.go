@@ -0,0 +1,454 @@
+package cmd
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+var metricsCmd = &cobra.Command{
+	Use:   "metrics [path]",
+	Short: "Report size and complexity metrics of functions",
+	Long: `Report size and complexity metrics for the functions and methods under a
+path, aggregated per package. With --threshold, list the functions whose
+--by metric exceeds the threshold instead, worst first, and exit with
+status 1 if there are any.`,
+	Example: `  gosymex metrics ./...
+  gosymex metrics --threshold 15 --by cognitive .`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runMetricsCmd,
+}
+
+func init() {
+	addWalkFlags(metricsCmd)
+	metricsCmd.Flags().Int("threshold", 0, "List the functions whose --by metric exceeds this value")
+	metricsCmd.Flags().String("by", "cyclomatic", "Metric compared against --threshold: "+strings.Join(metricNames, ", "))
+	rootCmd.AddCommand(metricsCmd)
+}
+
+// FuncMetrics are the size and complexity metrics of one function or method.
+type FuncMetrics struct {
+	Func       string // function name as reported by describe, without the signature
+	Line       int
+	Lines      int // lines spanned by the declaration
+	Statements int
+	Cyclomatic int
+	Cognitive  int
+	Nesting    int // deepest nesting of control structures and function literals
+	Params     int
+	Results    int
+	Returns    int // return points, including falling off the end of the body
+}
+
+// metricNames are the metrics --by accepts.
+var metricNames = []string{"lines", "statements", "cyclomatic", "cognitive", "nesting", "params", "results", "returns"}
+
+// metric returns the named metric.
+func (m FuncMetrics) metric(name string) (int, bool) {
+	switch name {
+	case "lines":
+		return m.Lines, true
+	case "statements":
+		return m.Statements, true
+	case "cyclomatic":
+		return m.Cyclomatic, true
+	case "cognitive":
+		return m.Cognitive, true
+	case "nesting":
+		return m.Nesting, true
+	case "params":
+		return m.Params, true
+	case "results":
+		return m.Results, true
+	case "returns":
+		return m.Returns, true
+	}
+	return 0, false
+}
+
+// metricsAnalysis returns a bodyAnalysis that appends the metrics of each
+// function to details.Metrics. Positions are resolved through fset.
+func metricsAnalysis(fset *token.FileSet) bodyAnalysis {
+	return func(fn *ast.FuncDecl, details *FileDetails) {
+		details.Metrics = append(details.Metrics, funcMetrics(fset, fn))
+	}
+}
+
+// funcMetrics computes the metrics of a function declaration with a body.
+func funcMetrics(fset *token.FileSet, fn *ast.FuncDecl) FuncMetrics {
+	sig := parseFuncSignature(fn)
+	start := fset.Position(fn.Pos())
+	m := FuncMetrics{
+		Func:       funcKey(sig.String()),
+		Line:       start.Line,
+		Lines:      fset.Position(fn.End()).Line - start.Line + 1,
+		Cyclomatic: 1,
+		Params:     len(sig.Params),
+		Results:    len(sig.Results),
+	}
+
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause, *ast.EmptyStmt:
+		case ast.Stmt:
+			m.Statements++
+		}
+		switch n := n.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			m.Cyclomatic++
+		case *ast.CaseClause:
+			if n.List != nil {
+				m.Cyclomatic++
+			}
+		case *ast.CommClause:
+			if n.Comm != nil {
+				m.Cyclomatic++
+			}
+		case *ast.BinaryExpr:
+			if n.Op == token.LAND || n.Op == token.LOR {
+				m.Cyclomatic++
+			}
+		}
+		return true
+	})
+
+	m.Returns = returnPoints(fn.Body)
+	if len(sig.Results) == 0 && !endsInReturn(fn.Body) {
+		m.Returns++
+	}
+
+	cognitive := &cognitiveVisitor{fn: fn}
+	ast.Walk(cognitive, fn.Body)
+	m.Cognitive = cognitive.complexity
+	m.Nesting = cognitive.maxNesting
+	return m
+}
+
+// returnPoints counts the return statements of a body, leaving out those of
+// function literals.
+func returnPoints(body *ast.BlockStmt) int {
+	returns := 0
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			returns++
+		}
+		return true
+	})
+	return returns
+}
+
+func endsInReturn(body *ast.BlockStmt) bool {
+	if len(body.List) == 0 {
+		return false
+	}
+	_, ok := body.List[len(body.List)-1].(*ast.ReturnStmt)
+	return ok
+}
+
+// cognitiveVisitor computes cognitive complexity as defined by SonarSource:
+// control structures cost one plus their nesting level, else branches,
+// labelled jumps, runs of logical operators and recursion cost one each.
+type cognitiveVisitor struct {
+	fn         *ast.FuncDecl
+	complexity int
+	nesting    int
+	maxNesting int
+	elseIfs    map[*ast.IfStmt]bool
+	counted    map[*ast.BinaryExpr]bool
+}
+
+func (v *cognitiveVisitor) Visit(n ast.Node) ast.Visitor {
+	switch n := n.(type) {
+	case *ast.IfStmt:
+		if v.elseIfs[n] {
+			v.complexity++
+		} else {
+			v.complexity += 1 + v.nesting
+		}
+		v.walk(n.Init)
+		v.walk(n.Cond)
+		v.nested(n.Body)
+		switch e := n.Else.(type) {
+		case *ast.BlockStmt:
+			v.complexity++
+			v.nested(e)
+		case *ast.IfStmt:
+			if v.elseIfs == nil {
+				v.elseIfs = make(map[*ast.IfStmt]bool)
+			}
+			v.elseIfs[e] = true
+			v.walk(e)
+		}
+		return nil
+	case *ast.SwitchStmt:
+		v.complexity += 1 + v.nesting
+		v.walk(n.Init)
+		v.walk(n.Tag)
+		v.nested(n.Body)
+		return nil
+	case *ast.TypeSwitchStmt:
+		v.complexity += 1 + v.nesting
+		v.walk(n.Init)
+		v.walk(n.Assign)
+		v.nested(n.Body)
+		return nil
+	case *ast.SelectStmt:
+		v.complexity += 1 + v.nesting
+		v.nested(n.Body)
+		return nil
+	case *ast.ForStmt:
+		v.complexity += 1 + v.nesting
+		v.walk(n.Init)
+		v.walk(n.Cond)
+		v.walk(n.Post)
+		v.nested(n.Body)
+		return nil
+	case *ast.RangeStmt:
+		v.complexity += 1 + v.nesting
+		v.walk(n.X)
+		v.nested(n.Body)
+		return nil
+	case *ast.FuncLit:
+		v.nested(n.Body)
+		return nil
+	case *ast.BranchStmt:
+		if n.Label != nil {
+			v.complexity++
+		}
+	case *ast.BinaryExpr:
+		v.logicalRuns(n)
+	case *ast.CallExpr:
+		if v.isRecursive(n) {
+			v.complexity++
+		}
+	}
+	return v
+}
+
+// walk visits an optional child node.
+func (v *cognitiveVisitor) walk(n ast.Node) {
+	if n != nil {
+		ast.Walk(v, n)
+	}
+}
+
+// nested walks n one nesting level deeper.
+func (v *cognitiveVisitor) nested(n ast.Node) {
+	v.nesting++
+	if v.nesting > v.maxNesting {
+		v.maxNesting = v.nesting
+	}
+	ast.Walk(v, n)
+	v.nesting--
+}
+
+// logicalRuns charges one for each run of identical logical operators in
+// the expression tree rooted at n, so "a && b && c" costs one and
+// "a && b || c" costs two.
+func (v *cognitiveVisitor) logicalRuns(n *ast.BinaryExpr) {
+	if v.counted[n] || (n.Op != token.LAND && n.Op != token.LOR) {
+		return
+	}
+	if v.counted == nil {
+		v.counted = make(map[*ast.BinaryExpr]bool)
+	}
+
+	var ops []token.Token
+	var flatten func(e ast.Expr)
+	flatten = func(e ast.Expr) {
+		switch e := e.(type) {
+		case *ast.ParenExpr:
+			flatten(e.X)
+		case *ast.BinaryExpr:
+			if e.Op == token.LAND || e.Op == token.LOR {
+				v.counted[e] = true
+				flatten(e.X)
+				ops = append(ops, e.Op)
+				flatten(e.Y)
+			}
+		}
+	}
+	flatten(n)
+
+	for i, op := range ops {
+		if i == 0 || ops[i-1] != op {
+			v.complexity++
+		}
+	}
+}
+
+// isRecursive reports whether the call invokes the function being measured.
+func (v *cognitiveVisitor) isRecursive(call *ast.CallExpr) bool {
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		return v.fn.Recv == nil && fun.Name == v.fn.Name.Name
+	case *ast.SelectorExpr:
+		if v.fn.Recv == nil || len(v.fn.Recv.List) == 0 || len(v.fn.Recv.List[0].Names) == 0 {
+			return false
+		}
+		recv, ok := fun.X.(*ast.Ident)
+		return ok && recv.Name == v.fn.Recv.List[0].Names[0].Name && fun.Sel.Name == v.fn.Name.Name
+	}
+	return false
+}
+
+// packageMetrics aggregates the function metrics of one package.
+type packageMetrics struct {
+	Package       string
+	Funcs         int
+	Lines         int
+	Statements    int
+	AvgCyclomatic float64
+	MaxCyclomatic int
+	AvgCognitive  float64
+	MaxCognitive  int
+	MaxNesting    int
+}
+
+// fileFuncMetrics ties function metrics to the file they were measured in.
+type fileFuncMetrics struct {
+	File string
+	FuncMetrics
+}
+
+// collectMetrics measures every function of the Go files under root.
+func collectMetrics(root string, opts walkOptions) ([]fileFuncMetrics, error) {
+	var all []fileFuncMetrics
+	var failures fileFailures
+	err := walkGoFiles(root, opts, func(filePath string, info os.FileInfo) error {
+		details, err := extractFile(filePath, describeOptions{Metrics: true})
+		if err != nil {
+			reportFileError(filePath, err)
+			failures.add(err)
+			return nil
+		}
+		failures.add(nil)
+		for _, m := range details.Metrics {
+			all = append(all, fileFuncMetrics{File: filePath, FuncMetrics: m})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return all, failures.err()
+}
+
+// aggregateMetrics groups function metrics by package, sorted by package.
+func aggregateMetrics(funcs []fileFuncMetrics) []packageMetrics {
+	byPackage := make(map[string]*packageMetrics)
+	var cyclomatic, cognitive = make(map[string]int), make(map[string]int)
+	for _, f := range funcs {
+		pkg := packageOf(f.File)
+		agg, ok := byPackage[pkg]
+		if !ok {
+			agg = &packageMetrics{Package: pkg}
+			byPackage[pkg] = agg
+		}
+		agg.Funcs++
+		agg.Lines += f.Lines
+		agg.Statements += f.Statements
+		agg.MaxCyclomatic = max(agg.MaxCyclomatic, f.Cyclomatic)
+		agg.MaxCognitive = max(agg.MaxCognitive, f.Cognitive)
+		agg.MaxNesting = max(agg.MaxNesting, f.Nesting)
+		cyclomatic[pkg] += f.Cyclomatic
+		cognitive[pkg] += f.Cognitive
+	}
+
+	packages := make([]packageMetrics, 0, len(byPackage))
+	for pkg, agg := range byPackage {
+		agg.AvgCyclomatic = float64(cyclomatic[pkg]) / float64(agg.Funcs)
+		agg.AvgCognitive = float64(cognitive[pkg]) / float64(agg.Funcs)
+		packages = append(packages, *agg)
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Package < packages[j].Package })
+	return packages
+}
+
+// worstOffenders returns the functions whose named metric exceeds threshold,
+// highest first.
+func worstOffenders(funcs []fileFuncMetrics, by string, threshold int) []fileFuncMetrics {
+	var offenders []fileFuncMetrics
+	for _, f := range funcs {
+		if value, _ := f.metric(by); value > threshold {
+			offenders = append(offenders, f)
+		}
+	}
+	sort.SliceStable(offenders, func(i, j int) bool {
+		a, _ := offenders[i].metric(by)
+		b, _ := offenders[j].metric(by)
+		return a > b
+	})
+	return offenders
+}
+
+func printPackageMetrics(packages []packageMetrics) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleLight)
+
+	t.AppendHeader(table.Row{"Package", "Funcs", "Lines", "Statements", "Avg cyclomatic", "Max cyclomatic", "Avg cognitive", "Max cognitive", "Max nesting"})
+	for _, p := range packages {
+		t.AppendRow(table.Row{p.Package, p.Funcs, p.Lines, p.Statements,
+			fmt.Sprintf("%.1f", p.AvgCyclomatic), p.MaxCyclomatic,
+			fmt.Sprintf("%.1f", p.AvgCognitive), p.MaxCognitive, p.MaxNesting})
+	}
+
+	t.Render()
+}
+
+func printFuncMetrics(funcs []fileFuncMetrics) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleLight)
+
+	t.AppendHeader(table.Row{"Function", "Location", "Lines", "Statements", "Cyclomatic", "Cognitive", "Nesting", "Params", "Results", "Returns"})
+	for _, f := range funcs {
+		t.AppendRow(table.Row{f.Func, fmt.Sprintf("%s:%d", f.File, f.Line), f.Lines, f.Statements,
+			f.Cyclomatic, f.Cognitive, f.Nesting, f.Params, f.Results, f.Returns})
+	}
+
+	t.Render()
+}
+
+func runMetricsCmd(cmd *cobra.Command, args []string) error {
+	path := "."
+	if len(args) > 0 {
+		path = strings.TrimSuffix(args[0], "/...")
+	}
+	threshold, _ := cmd.Flags().GetInt("threshold")
+	by, _ := cmd.Flags().GetString("by")
+	if _, ok := (FuncMetrics{}).metric(by); !ok {
+		return withExitCode(exitUsage, fmt.Errorf("unknown metric '%s': must be one of %s", by, strings.Join(metricNames, ", ")))
+	}
+
+	funcs, err := collectMetrics(path, walkOptionsFromFlags(cmd))
+	if funcs == nil && err != nil {
+		return err
+	}
+
+	if !cmd.Flags().Changed("threshold") {
+		printPackageMetrics(aggregateMetrics(funcs))
+		return err
+	}
+
+	offenders := worstOffenders(funcs, by, threshold)
+	if len(offenders) == 0 {
+		fmt.Printf("No function has %s above %d\n", by, threshold)
+		return err
+	}
+	printFuncMetrics(offenders)
+	if err != nil {
+		return err
+	}
+	return withExitCode(exitFailure, fmt.Errorf("%d functions have %s above %d", len(offenders), by, threshold))
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFuncMetrics(t *testing.T) {
+	src := `package a
+
+func Simple(a, b int) int {
+	return a + b
+}
+
+func Noop() {}
+
+func Branchy(xs []int, ok bool) (n int) {
+	for _, x := range xs {
+		if x > 0 && ok {
+			n++
+		} else if x < 0 {
+			continue
+		} else {
+			break
+		}
+	}
+	switch {
+	case n > 10:
+		return 10
+	default:
+	}
+	return n
+}
+
+func Fact(n int) int {
+	f := func() bool { return n <= 1 }
+	if f() {
+		return 1
+	}
+	return n * Fact(n-1)
+}
+`
+	details, err := extractSource("a.go", src, describeOptions{Metrics: true})
+	if err != nil {
+		t.Fatalf("extractSource() error = %v", err)
+	}
+
+	testCases := []struct {
+		name string
+		want FuncMetrics
+	}{
+		{
+			name: "Test with a single statement",
+			want: FuncMetrics{Func: "Simple", Line: 3, Lines: 3, Statements: 1, Cyclomatic: 1, Params: 2, Results: 1, Returns: 1},
+		},
+		{
+			name: "Test with an empty body",
+			want: FuncMetrics{Func: "Noop", Line: 7, Lines: 1, Cyclomatic: 1, Returns: 1},
+		},
+		{
+			name: "Test with loops, branches and a switch",
+			want: FuncMetrics{Func: "Branchy", Line: 9, Lines: 17, Statements: 9, Cyclomatic: 6, Cognitive: 7, Nesting: 2, Params: 2, Results: 1, Returns: 2},
+		},
+		{
+			name: "Test with recursion and a closure",
+			want: FuncMetrics{Func: "Fact", Line: 27, Lines: 7, Statements: 5, Cyclomatic: 2, Cognitive: 2, Nesting: 1, Params: 1, Results: 1, Returns: 2},
+		},
+	}
+
+	byName := make(map[string]FuncMetrics)
+	for _, m := range details.Metrics {
+		byName[m.Func] = m
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := byName[tc.want.Func]; !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %+v, but got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestWorstOffenders(t *testing.T) {
+	funcs := []fileFuncMetrics{
+		{File: "a/a.go", FuncMetrics: FuncMetrics{Func: "A", Cyclomatic: 3, Cognitive: 9}},
+		{File: "a/a.go", FuncMetrics: FuncMetrics{Func: "B", Cyclomatic: 12, Cognitive: 2}},
+		{File: "b/b.go", FuncMetrics: FuncMetrics{Func: "C", Cyclomatic: 8, Cognitive: 15}},
+	}
+
+	testCases := []struct {
+		name      string
+		by        string
+		threshold int
+		want      []string
+	}{
+		{"Test with cyclomatic", "cyclomatic", 5, []string{"B", "C"}},
+		{"Test with cognitive", "cognitive", 5, []string{"C", "A"}},
+		{"Test with a high threshold", "cyclomatic", 20, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, f := range worstOffenders(funcs, tc.by, tc.threshold) {
+				got = append(got, f.Func)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %v, but got %v", tc.want, got)
+			}
+		})
+	}
+
+	packages := aggregateMetrics(funcs)
+	if len(packages) != 2 || packages[0].Package != "a" || packages[0].Funcs != 2 || packages[0].MaxCyclomatic != 12 || packages[0].AvgCognitive != 5.5 {
+		t.Errorf("Unexpected package aggregates: %+v", packages)
+	}
+}
@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"go/ast"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// mockGeneratorHeader matches the generated code headers of mockgen,
+// mockery and moq.
+var mockGeneratorHeader = regexp.MustCompile(`^// Code generated by (MockGen|mockery|moq)\b`)
+
+// Doc comment patterns that name the interface a generated mock implements.
+var (
+	mockgenDoc  = regexp.MustCompile(`is a mock of (\S+) interface`)
+	mockeryDoc  = regexp.MustCompile(`is an autogenerated mock type for the (\S+) type`)
+	moqDoc      = regexp.MustCompile(`is a mock implementation of (\S+?)\.?$`)
+	recorderDoc = regexp.MustCompile(`is the mock recorder for (\S+?)\.?$`)
+)
+
+// isMockFileName reports whether the path follows a common mock file naming
+// pattern, or lives in a mocks package directory.
+func isMockFileName(filePath string) bool {
+	name := strings.TrimSuffix(filepath.Base(filePath), ".go")
+	name = strings.TrimSuffix(name, "_test")
+	if strings.HasSuffix(name, "_mock") || strings.HasSuffix(name, "_mocks") ||
+		strings.HasPrefix(name, "mock_") || strings.HasPrefix(name, "mocks_") {
+		return true
+	}
+	return isMockPackage(filepath.Base(filepath.Dir(filePath)))
+}
+
+// isMockPackage reports whether a package name is one mock generators use:
+// mock, mocks, or mockgen's mock_<pkg>.
+func isMockPackage(name string) bool {
+	return name == "mock" || name == "mocks" || strings.HasPrefix(name, "mock_")
+}
+
+// isMockFile reports whether the file holds generated or hand-written mocks,
+// judging by its name, directory, generator header and package clause.
+func isMockFile(filePath string) bool {
+	return isMockFileName(filePath) || readFileHeader(filePath).mock()
+}
+
+// mock reports whether the header is that of a mock file.
+func (h fileHeader) mock() bool {
+	return h.mockGenerator || isMockPackage(h.pkg)
+}
+
+// isMockAST is isMockFile for an already parsed file.
+func isMockAST(filePath string, node *ast.File) bool {
+	if isMockFileName(filePath) || isMockPackage(node.Name.Name) {
+		return true
+	}
+	for _, group := range node.Comments {
+		if group.Pos() > node.Package {
+			break
+		}
+		for _, comment := range group.List {
+			if mockGeneratorHeader.MatchString(comment.Text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mockTargets maps the mock types declared in a mock file to the interface
+// each one implements. Helper types such as mockgen recorders map to the
+// empty string: they belong to a mock but are not mocks themselves.
+func mockTargets(node *ast.File) map[string]string {
+	targets := make(map[string]string)
+
+	for _, decl := range node.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			// moq asserts the implementation: var _ pkg.Foo = &FooMock{}
+			if value, ok := spec.(*ast.ValueSpec); ok {
+				if iface, mock := mockAssertion(value); mock != "" {
+					targets[mock] = iface
+				}
+				continue
+			}
+
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+			structType, ok := typeSpec.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			name := typeSpec.Name.Name
+			if _, found := targets[name]; found {
+				continue
+			}
+
+			doc := typeSpec.Doc
+			if doc == nil {
+				doc = gen.Doc
+			}
+			if iface, ok := mockDocTarget(doc); ok {
+				targets[name] = iface
+				continue
+			}
+			if recorderDoc.MatchString(doc.Text()) || strings.HasSuffix(name, "MockRecorder") {
+				targets[name] = ""
+				continue
+			}
+			if embedsTestifyMock(structType) {
+				targets[name] = mockNameTarget(name)
+			}
+		}
+	}
+	return targets
+}
+
+// mockDocTarget reads the implemented interface from a generator doc comment.
+func mockDocTarget(doc *ast.CommentGroup) (string, bool) {
+	text := strings.TrimSpace(doc.Text())
+	for _, line := range strings.Split(text, "\n") {
+		for _, pattern := range []*regexp.Regexp{mockgenDoc, mockeryDoc, moqDoc} {
+			if m := pattern.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+				return m[1], true
+			}
+		}
+	}
+	return "", false
+}
+
+// mockAssertion recognises "var _ Iface = &Mock{}" and "var _ Iface = (*Mock)(nil)".
+func mockAssertion(value *ast.ValueSpec) (iface, mock string) {
+	if value.Type == nil || len(value.Names) != 1 || value.Names[0].Name != "_" || len(value.Values) != 1 {
+		return "", ""
+	}
+
+	var expr ast.Expr = value.Values[0]
+	if unary, ok := expr.(*ast.UnaryExpr); ok {
+		expr = unary.X
+	}
+	switch v := expr.(type) {
+	case *ast.CompositeLit:
+		expr = v.Type
+	case *ast.CallExpr:
+		if paren, ok := v.Fun.(*ast.ParenExpr); ok {
+			expr = paren.X
+		}
+	}
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return "", ""
+	}
+	return receiverTypeNameQualified(value.Type), ident.Name
+}
+
+// receiverTypeNameQualified renders a type name keeping its package qualifier.
+func receiverTypeNameQualified(expr ast.Expr) string {
+	if sel, ok := expr.(*ast.SelectorExpr); ok {
+		if pkg, ok := sel.X.(*ast.Ident); ok {
+			return pkg.Name + "." + sel.Sel.Name
+		}
+	}
+	return receiverTypeName(expr)
+}
+
+// embedsTestifyMock reports whether the struct embeds mock.Mock.
+func embedsTestifyMock(structType *ast.StructType) bool {
+	for _, field := range structType.Fields.List {
+		if len(field.Names) > 0 {
+			continue
+		}
+		if sel, ok := field.Type.(*ast.SelectorExpr); ok && sel.Sel.Name == "Mock" {
+			return true
+		}
+	}
+	return false
+}
+
+// mockNameTarget guesses the mocked interface from a naming convention:
+// MockFoo, FooMock or, as mockery names them, Foo.
+func mockNameTarget(name string) string {
+	if trimmed := strings.TrimPrefix(name, "Mock"); trimmed != name && trimmed != "" {
+		return trimmed
+	}
+	if trimmed := strings.TrimSuffix(name, "Mock"); trimmed != name && trimmed != "" {
+		return trimmed
+	}
+	return name
+}
+
+// collapseMocks replaces the generated methods of mock types with a single
+// "mock of X" entry per mock in details.Mocks.
+func collapseMocks(node *ast.File, details *FileDetails) {
+	targets := mockTargets(node)
+	if len(targets) == 0 {
+		return
+	}
+
+	details.Mocks = make(map[string]string)
+	for name, iface := range targets {
+		delete(details.Structs, name)
+		delete(details.Embeds, name)
+		if iface != "" {
+			details.Mocks[name] = iface
+		}
+	}
+
+	funcs := details.Funcs[:0]
+	for _, sig := range details.Funcs {
+		if recv, isMethod := funcReceiverType(sig); isMethod {
+			if _, isMock := targets[recv]; isMock {
+				continue
+			}
+		}
+		funcs = append(funcs, sig)
+	}
+	details.Funcs = funcs
+}
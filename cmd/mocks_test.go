@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIsMockFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"store_mock.go":        "package store\n",
+		"mock_store.go":        "package store\n",
+		"mocks/store.go":       "package mocks\n",
+		"gen/store.go":         "// Code generated by MockGen. DO NOT EDIT.\n// Source: store.go\n\npackage gen\n",
+		"moq/store.go":         "// Code generated by moq; DO NOT EDIT.\n\npackage moq\n",
+		"fakes/store.go":       "package mock_store\n",
+		"store/store.go":       "package store\n",
+		"store/generated.go":   "// Code generated by stringer. DO NOT EDIT.\n\npackage store\n",
+		"store/mockingbird.go": "package store\n",
+	})
+
+	// Define a table of test cases
+	testCases := []struct {
+		name string
+		file string
+		want bool
+	}{
+		{name: "Test with a _mock suffix", file: "store_mock.go", want: true},
+		{name: "Test with a mock_ prefix", file: "mock_store.go", want: true},
+		{name: "Test with a mocks directory", file: "mocks/store.go", want: true},
+		{name: "Test with a mockgen header", file: "gen/store.go", want: true},
+		{name: "Test with a moq header", file: "moq/store.go", want: true},
+		{name: "Test with a mockgen package name", file: "fakes/store.go", want: true},
+		{name: "Test with a production file", file: "store/store.go", want: false},
+		{name: "Test with another generator", file: "store/generated.go", want: false},
+		{name: "Test with a name that only starts with mock", file: "store/mockingbird.go", want: false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if got := isMockFile(filepath.Join(dir, testCase.file)); got != testCase.want {
+				t.Errorf("isMockFile(%q) = %v, want %v", testCase.file, got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestCollapseMocks(t *testing.T) {
+	// Define a table of test cases
+	testCases := []struct {
+		name      string
+		src       string
+		wantMocks map[string]string
+		wantFuncs []string
+	}{
+		{
+			name: "Test with a mockgen mock",
+			src: `// Code generated by MockGen. DO NOT EDIT.
+package mocks
+
+// MockStore is a mock of Store interface.
+type MockStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockStoreMockRecorder
+}
+
+// MockStoreMockRecorder is the mock recorder for MockStore.
+type MockStoreMockRecorder struct {
+	mock *MockStore
+}
+
+func NewMockStore(ctrl *gomock.Controller) *MockStore { return nil }
+func (m *MockStore) EXPECT() *MockStoreMockRecorder { return m.recorder }
+func (m *MockStore) Get(key string) (string, error) { return "", nil }
+func (mr *MockStoreMockRecorder) Get(key interface{}) *gomock.Call { return nil }
+`,
+			wantMocks: map[string]string{"MockStore": "Store"},
+			wantFuncs: []string{"NewMockStore(ctrl *gomock.Controller) returns (*MockStore)"},
+		},
+		{
+			name: "Test with a mockery mock",
+			src: `// Code generated by mockery v2.20.0. DO NOT EDIT.
+package mocks
+
+// Store is an autogenerated mock type for the Store type
+type Store struct {
+	mock.Mock
+}
+
+func (_m *Store) Get(key string) (string, error) { return "", nil }
+`,
+			wantMocks: map[string]string{"Store": "Store"},
+			wantFuncs: []string{},
+		},
+		{
+			name: "Test with a moq mock",
+			src: `// Code generated by moq; DO NOT EDIT.
+package store
+
+var _ storage.Store = &StoreMock{}
+
+type StoreMock struct {
+	GetFunc func(key string) (string, error)
+}
+
+func (mock *StoreMock) Get(key string) (string, error) { return mock.GetFunc(key) }
+`,
+			wantMocks: map[string]string{"StoreMock": "storage.Store"},
+			wantFuncs: []string{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			node, err := parser.ParseFile(token.NewFileSet(), "store.go", testCase.src, parser.ParseComments)
+			if err != nil {
+				t.Fatalf("Failed to parse source: %v", err)
+			}
+
+			details := inspectFile("store.go", node)
+			if !reflect.DeepEqual(details.Mocks, testCase.wantMocks) {
+				t.Errorf("Mocks = %v, want %v", details.Mocks, testCase.wantMocks)
+			}
+			if !reflect.DeepEqual(details.Funcs, testCase.wantFuncs) {
+				t.Errorf("Funcs = %v, want %v", details.Funcs, testCase.wantFuncs)
+			}
+			if len(details.Structs) != 0 {
+				t.Errorf("Structs = %v, want mock types removed", details.Structs)
+			}
+		})
+	}
+}
@@ -0,0 +1,621 @@
+package cmd
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var packCmd = &cobra.Command{
+	Use:   "pack [path | glob | symbol]...",
+	Short: "Build a paste-ready markdown context pack of the module for a chat",
+	Long: `Build a single markdown document to paste into a chat: an overview of the
+module, an outline of every file, and the full source of the selected files
+and declarations, with a table of contents and an approximate token count.
+
+Each argument selects either a file or directory, a glob matched against
+paths relative to the module root (same syntax as .gosymexignore), or a
+symbol (Name, Type.Method or (*Type).Method). --since adds the Go files
+changed since a git revision, including untracked ones.
+
+With --token-budget, the outline is shortened or left out first, then
+selected sources are dropped from the end; what was left out is listed.
+
+Every pack has an id, printed in its header, under which the hashes of all
+declarations of the module are recorded in the cache directory. --since-pack
+with that id makes a delta pack instead: only the declarations added or
+modified since, the ones removed, and a summary of the changes.`,
+	Example: `  gosymex pack cmd/root.go 'internal/**/*_handler.go'
+  gosymex pack Server.Start --since main --token-budget 8000
+  gosymex pack --since-pack 3f9c2a71d04e`,
+	RunE: runPackCmd,
+}
+
+func init() {
+	addWalkFlags(packCmd)
+	packCmd.Flags().String("since", "", "Also select the Go files changed since this git revision")
+	packCmd.Flags().String("since-pack", "", "Only show the declarations changed since the pack with this id")
+	packCmd.Flags().Int("token-budget", 0, "Keep the pack within about this many tokens (0 means no limit)")
+	rootCmd.AddCommand(packCmd)
+}
+
+// packFile is a Go file of the module as the pack sees it.
+type packFile struct {
+	Path    string // relative to the module root, with slashes
+	src     []byte
+	details *FileDetails
+	symbols []symbolSource
+}
+
+// packItem is one selected source: a whole file, or one declaration.
+type packItem struct {
+	Title  string
+	File   string
+	Source string
+	Change string // added or modified in delta packs
+	key    string // the symbolKey of a changed declaration
+}
+
+// contextPack is the content of a pack before rendering.
+type contextPack struct {
+	Module       string
+	Dependencies []dependency
+	Files        []*packFile
+	Items        []packItem
+	Outline      string // full, compact or none
+	Omitted      []string
+	Budget       int
+
+	ID      string
+	Since   *packState // the pack a delta pack is relative to
+	Summary string     // the changes since then
+	Removed []string   // declarations removed since then
+	changed map[string]bool
+	walk    walkOptions // the walk that selected Files
+}
+
+// Outline levels, from most to least detailed.
+const (
+	outlineFull    = "full"
+	outlineCompact = "compact"
+	outlineNone    = "none"
+)
+
+func runPackCmd(cmd *cobra.Command, args []string) error {
+	since, _ := cmd.Flags().GetString("since")
+	sincePack, _ := cmd.Flags().GetString("since-pack")
+	budget, _ := cmd.Flags().GetInt("token-budget")
+	if sincePack != "" && (len(args) > 0 || since != "") {
+		return withExitCode(exitUsage, fmt.Errorf("--since-pack cannot be combined with selectors or --since"))
+	}
+	cache, err := newExtractCache(cacheDir)
+	if err != nil {
+		return fmt.Errorf("opening cache: %w", err)
+	}
+
+	goModPath, err := findGoMod(".")
+	if err != nil {
+		return err
+	}
+	pack, err := loadContextPack(filepath.Dir(goModPath), walkOptionsFromFlags(cmd))
+	if err != nil {
+		return err
+	}
+	pack.ID = newPackID()
+	pack.Budget = budget
+
+	if sincePack != "" {
+		previous, err := cache.loadPackState(sincePack)
+		if err != nil {
+			return err
+		}
+		if err := pack.checkSince(previous); err != nil {
+			return err
+		}
+		pack.diffSince(previous)
+	}
+	if err := pack.selectAll(filepath.Dir(goModPath), args, true); err != nil {
+		return err
+	}
+	if since != "" {
+		changed, err := gitChangedFiles(filepath.Dir(goModPath), since)
+		if err != nil {
+			return err
+		}
+		// Changed files the walk leaves out, such as tests, are skipped.
+		if err := pack.selectAll(filepath.Dir(goModPath), changed, false); err != nil {
+			return err
+		}
+	}
+
+	pack.fit()
+	if err := cache.storePackState(pack.state()); err != nil {
+		return fmt.Errorf("recording pack: %w", err)
+	}
+	fmt.Print(pack.render())
+	return nil
+}
+
+// loadContextPack parses every Go file of the module rooted at moduleRoot.
+func loadContextPack(moduleRoot string, opts walkOptions) (*contextPack, error) {
+	module, dependencies, err := readGoModFile(filepath.Join(moduleRoot, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+	pack := &contextPack{Module: module, Dependencies: dependencies, Outline: outlineFull, walk: opts}
+
+	var failures fileFailures
+	err = walkGoFiles(moduleRoot, opts, func(filePath string, info os.FileInfo) error {
+		file, err := loadPackFile(moduleRoot, filePath)
+		failures.add(err)
+		if err != nil {
+			reportFileError(filePath, err)
+			return nil
+		}
+		pack.Files = append(pack.Files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking the module: %w", err)
+	}
+	if len(pack.Files) == 0 {
+		if err := failures.err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no Go files in %s", moduleRoot)
+	}
+	sort.Slice(pack.Files, func(i, j int) bool { return pack.Files[i].Path < pack.Files[j].Path })
+	return pack, nil
+}
+
+func loadPackFile(moduleRoot, filePath string) (*packFile, error) {
+	src, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(moduleRoot, filePath)
+	if err != nil {
+		return nil, err
+	}
+	details, err := extractSource(filePath, src, describeOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("parsing file: %w", err)
+	}
+	file := &packFile{Path: filepath.ToSlash(rel), src: src, details: details}
+	err = fileSymbols(filePath, src, func(name, kind string, node ast.Node, doc *ast.CommentGroup, fset *token.FileSet) {
+		symbol := declSource(fset, src, name, kind, node, doc)
+		symbol.File = file.Path
+		file.symbols = append(file.symbols, symbol)
+	})
+	return file, err
+}
+
+// gitChangedFiles lists the files under dir changed since rev, committed or
+// not, and the untracked ones, relative to dir.
+func gitChangedFiles(dir, rev string) ([]string, error) {
+	changed, err := exec.Command("git", "-C", dir, "diff", "--name-only", "--relative", rev, "--").Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing files changed since '%s': %v", rev, err)
+	}
+	untracked, err := exec.Command("git", "-C", dir, "ls-files", "--others", "--exclude-standard").Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing untracked files: %v", err)
+	}
+
+	var files []string
+	for _, line := range strings.Split(string(changed)+string(untracked), "\n") {
+		filePath := filepath.Join(dir, line)
+		if !strings.HasSuffix(line, ".go") {
+			continue
+		}
+		// Deleted files have nothing to show.
+		if _, err := os.Stat(filePath); err == nil {
+			files = append(files, filePath)
+		}
+	}
+	return files, nil
+}
+
+// selectAll adds the sources picked by each selector, in order. Paths are
+// relative to the working directory, globs to the module root. When required
+// is set, a selector matching nothing is an error.
+func (p *contextPack) selectAll(moduleRoot string, selectors []string, required bool) error {
+	selected := make(map[string]bool)
+	for _, item := range p.Items {
+		selected[item.Title] = true
+	}
+	add := func(item packItem) {
+		// A declaration is already there when its whole file is.
+		if selected[item.Title] || selected[item.File] {
+			return
+		}
+		selected[item.Title] = true
+		p.Items = append(p.Items, item)
+	}
+
+	for _, selector := range selectors {
+		matches, err := p.match(moduleRoot, selector)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 && required {
+			return withExitCode(exitUsage, fmt.Errorf("no files or symbols match '%s'", selector))
+		}
+		for _, item := range matches {
+			add(item)
+		}
+	}
+	return nil
+}
+
+// match resolves one selector to the sources it selects.
+func (p *contextPack) match(moduleRoot, selector string) ([]packItem, error) {
+	var items []packItem
+	fileItem := func(file *packFile) packItem {
+		return packItem{Title: file.Path, File: file.Path, Source: string(file.src)}
+	}
+
+	if _, err := os.Stat(selector); err == nil {
+		abs, err := filepath.Abs(selector)
+		if err != nil {
+			return nil, err
+		}
+		absRoot, _ := filepath.Abs(moduleRoot)
+		rel, err := filepath.Rel(absRoot, abs)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("'%s' is outside the module", selector)
+		}
+		rel = filepath.ToSlash(rel)
+		for _, file := range p.Files {
+			if rel == "." || file.Path == rel || strings.HasPrefix(file.Path, rel+"/") {
+				items = append(items, fileItem(file))
+			}
+		}
+		return items, nil
+	}
+
+	if strings.ContainsAny(selector, "*?[") && !strings.HasPrefix(selector, "(") {
+		matcher := newGlobMatcher(moduleRoot, []string{selector})
+		for _, file := range p.Files {
+			if matcher.match(filepath.Join(moduleRoot, filepath.FromSlash(file.Path)), false) {
+				items = append(items, fileItem(file))
+			}
+		}
+		return items, nil
+	}
+
+	name := normalizeSymbolName(selector)
+	for _, file := range p.Files {
+		for _, symbol := range file.symbols {
+			if symbol.Name == name {
+				items = append(items, packItem{Title: symbolTitle(symbol), File: symbol.File, Source: symbol.Source})
+			}
+		}
+	}
+	return items, nil
+}
+
+// estimateTokens approximates the token count of text at four bytes per
+// token, which is close for source code with most tokenizers.
+func estimateTokens(text string) int {
+	return tokensForSize(len(text))
+}
+
+// tokensForSize is estimateTokens for text of size bytes.
+func tokensForSize(size int) int {
+	return (size + 3) / 4
+}
+
+// tokensToSize is the largest size estimated at no more than tokens.
+func tokensToSize(tokens int) int {
+	return 4 * tokens
+}
+
+// fit shortens the pack until it is within the budget: the outline is made
+// compact, then left out, then selected sources are dropped from the end.
+// The parts are measured once and their sizes subtracted as they go, so the
+// pack is rendered only to start and to confirm the result.
+func (p *contextPack) fit() {
+	if p.Budget <= 0 {
+		return
+	}
+	sizes := p.measure()
+	header, doc := p.renderParts()
+	size := len(header) + len(doc)
+	// The summary line holds the token count, so its length follows the size.
+	for size+len(p.summary(tokensForSize(size))) > tokensToSize(p.Budget) {
+		delta, ok := p.shorten(sizes)
+		if !ok {
+			return
+		}
+		size += delta
+	}
+	// Repeated headings get numbered anchors the sizes do not allow for.
+	for estimateTokens(p.render()) > p.Budget {
+		if _, ok := p.shorten(sizes); !ok {
+			return
+		}
+	}
+}
+
+// packSizes are the bytes each part of a pack adds to its rendering.
+type packSizes struct {
+	outline map[string]int // by outline level
+	items   []int          // by index in Items
+	groups  map[string]int // the section of each kind of change
+	counts  map[string]int // the items left in each section
+	omitted int            // the omitted section, without its entries
+}
+
+// measure returns the sizes of the parts of the pack as render writes them.
+func (p *contextPack) measure() *packSizes {
+	sizes := &packSizes{
+		outline: map[string]int{outlineNone: 0},
+		groups:  make(map[string]int),
+		counts:  make(map[string]int),
+		omitted: sectionSize("Omitted", "Left out to stay within the token budget:\n\n"),
+	}
+	level := p.Outline
+	for _, l := range []string{outlineFull, outlineCompact} {
+		p.Outline = l
+		sizes.outline[l] = sectionSize("Outline", p.outline())
+	}
+	p.Outline = level
+	for change, title := range changeSections {
+		sizes.groups[change] = sectionSize(title, "")
+	}
+	for _, item := range p.Items {
+		slug := headingSlug(item.Title, make(map[string]int))
+		sizes.items = append(sizes.items, len(fmt.Sprintf("  - [%s](#%s)\n\n### %s\n\n%s", item.Title, slug, item.Title, codeFence(item.Source))))
+		sizes.counts[item.Change]++
+	}
+	return sizes
+}
+
+// sectionSize is the size of a top-level section and its contents entry.
+func sectionSize(title, body string) int {
+	slug := headingSlug(title, make(map[string]int))
+	size := len(fmt.Sprintf("- [%s](#%s)\n\n## %s\n", title, slug, title))
+	if body != "" {
+		size += len("\n" + body)
+	}
+	return size
+}
+
+// shorten takes one step of fit and returns the change in the size of the
+// pack, or false when there is nothing left to leave out.
+func (p *contextPack) shorten(sizes *packSizes) (int, bool) {
+	switch {
+	case p.Outline == outlineFull:
+		p.Outline = outlineCompact
+		return sizes.outline[outlineCompact] - sizes.outline[outlineFull], true
+	case p.Outline == outlineCompact:
+		p.Outline = outlineNone
+		delta := sizes.omission("Outline", len(p.Omitted)) - sizes.outline[outlineCompact]
+		p.Omitted = append(p.Omitted, "Outline")
+		return delta, true
+	case len(p.Items) > 0:
+		i := len(p.Items) - 1
+		last := p.Items[i]
+		p.Items = p.Items[:i]
+		delta := -sizes.items[i]
+		if sizes.counts[last.Change]--; sizes.counts[last.Change] == 0 {
+			delta -= sizes.groups[last.Change]
+		}
+		delta += sizes.omission(last.Title, len(p.Omitted))
+		p.Omitted = append([]string{last.Title}, p.Omitted...)
+		return delta, true
+	}
+	return 0, false
+}
+
+// omission returns the size listing title under Omitted adds to a pack
+// that lists the given number of titles there already.
+func (sizes *packSizes) omission(title string, listed int) int {
+	size := len("- " + title + "\n")
+	if listed == 0 {
+		size += sizes.omitted
+	}
+	return size
+}
+
+// render writes the pack as markdown.
+func (p *contextPack) render() string {
+	header, doc := p.renderParts()
+	return header + p.summary(estimateTokens(header+doc)) + doc
+}
+
+// renderParts writes the pack without its summary line: the title, and the
+// contents with the sections.
+func (p *contextPack) renderParts() (string, string) {
+	var sections []packSection
+	if p.Since != nil {
+		sections = append(sections, packSection{Title: "Changes", Body: p.changes()})
+	} else {
+		sections = append(sections, packSection{Title: "Overview", Body: p.overview()})
+	}
+	if p.Outline != outlineNone {
+		sections = append(sections, packSection{Title: "Outline", Body: p.outline()})
+	}
+	// Sources are grouped by change, which keeps the order of the items.
+	groups := make(map[string]int)
+	for _, item := range p.Items {
+		title := changeSections[item.Change]
+		i, ok := groups[title]
+		if !ok {
+			i = len(sections)
+			groups[title] = i
+			sections = append(sections, packSection{Title: title})
+		}
+		sections[i].Children = append(sections[i].Children, packSection{Title: item.Title, Body: codeFence(item.Source)})
+	}
+	if len(p.Omitted) > 0 {
+		var body strings.Builder
+		body.WriteString("Left out to stay within the token budget:\n\n")
+		for _, title := range p.Omitted {
+			fmt.Fprintf(&body, "- %s\n", title)
+		}
+		sections = append(sections, packSection{Title: "Omitted", Body: body.String()})
+	}
+
+	var doc strings.Builder
+	slugs := make(map[string]int)
+	doc.WriteString("## Contents\n\n")
+	for _, section := range sections {
+		fmt.Fprintf(&doc, "- [%s](#%s)\n", section.Title, headingSlug(section.Title, slugs))
+		for _, child := range section.Children {
+			fmt.Fprintf(&doc, "  - [%s](#%s)\n", child.Title, headingSlug(child.Title, slugs))
+		}
+	}
+	for _, section := range sections {
+		fmt.Fprintf(&doc, "\n## %s\n", section.Title)
+		if section.Body != "" {
+			fmt.Fprintf(&doc, "\n%s", section.Body)
+		}
+		for _, child := range section.Children {
+			fmt.Fprintf(&doc, "\n### %s\n\n%s", child.Title, child.Body)
+		}
+	}
+
+	header := fmt.Sprintf("# Context pack: %s\n\n", p.Module)
+	if p.Since != nil {
+		header = fmt.Sprintf("# Context pack: %s, changes since %s\n\n", p.Module, p.Since.ID)
+	}
+	return header, doc.String()
+}
+
+// summary is the line under the title, for a pack of about tokens tokens.
+func (p *contextPack) summary(tokens int) string {
+	summary := fmt.Sprintf("About %d tokens", tokens)
+	if p.Budget > 0 {
+		summary += fmt.Sprintf(" (budget %d)", p.Budget)
+	}
+	if p.ID != "" {
+		summary += fmt.Sprintf(". Pack id `%s`", p.ID)
+	}
+	return summary + ".\n\n"
+}
+
+// changeSections are the sections sources are listed under, by change.
+var changeSections = map[string]string{
+	"":             "Sources",
+	changeAdded:    "Added",
+	changeModified: "Modified",
+}
+
+// changes is the summary of a delta pack, with the removed declarations.
+func (p *contextPack) changes() string {
+	if len(p.Removed) == 0 {
+		return p.Summary
+	}
+	var b strings.Builder
+	b.WriteString(p.Summary)
+	b.WriteString("\nRemoved:\n\n")
+	for _, removed := range p.Removed {
+		fmt.Fprintf(&b, "- %s\n", removed)
+	}
+	return b.String()
+}
+
+// packSection is a heading of the pack with its content.
+type packSection struct {
+	Title    string
+	Body     string
+	Children []packSection
+}
+
+func (p *contextPack) overview() string {
+	packages := make(map[string]bool)
+	for _, file := range p.Files {
+		packages[path.Dir(file.Path)] = true
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Module `%s`: %d packages, %d files.\n", p.Module, len(packages), len(p.Files))
+	if len(p.Dependencies) > 0 {
+		b.WriteString("\nDependencies:\n\n")
+		for _, dep := range p.Dependencies {
+			indirect := ""
+			if dep.Indirect {
+				indirect = " (indirect)"
+			}
+			fmt.Fprintf(&b, "- `%s` %s%s\n", dep.Name, dep.Version, indirect)
+		}
+	}
+	return b.String()
+}
+
+// outline lists the declarations of every file: with signatures when full,
+// by name only when compact.
+func (p *contextPack) outline() string {
+	var b strings.Builder
+	for _, file := range p.Files {
+		if p.Outline == outlineCompact {
+			var names []string
+			for _, symbol := range file.symbols {
+				names = append(names, symbol.Name)
+			}
+			fmt.Fprintf(&b, "- `%s`: %s\n", file.Path, strings.Join(names, ", "))
+			continue
+		}
+
+		fmt.Fprintf(&b, "- `%s`\n", file.Path)
+		for _, name := range sortedNames(file.details.Structs) {
+			fmt.Fprintf(&b, "  - struct `%s`\n", name)
+		}
+		for _, name := range sortedNames(file.details.Interfaces) {
+			fmt.Fprintf(&b, "  - interface `%s`\n", name)
+		}
+		for _, sig := range file.details.Funcs {
+			fmt.Fprintf(&b, "  - func `%s`\n", sig)
+		}
+	}
+	return b.String()
+}
+
+func sortedNames(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// codeFence wraps Go source in a fence longer than any backtick run in it.
+func codeFence(src string) string {
+	fence := "```"
+	for strings.Contains(src, fence) {
+		fence += "`"
+	}
+	return fence + "go\n" + strings.TrimRight(src, "\n") + "\n" + fence + "\n"
+}
+
+// headingSlug returns the anchor GitHub generates for a heading, numbering
+// repeated headings as it does.
+func headingSlug(title string, seen map[string]int) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case r == ' ':
+			b.WriteRune('-')
+		case r == '-' || r == '_' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 127:
+			b.WriteRune(r)
+		}
+	}
+	slug := b.String()
+	if n := seen[slug]; n > 0 {
+		seen[slug]++
+		return fmt.Sprintf("%s-%d", slug, n)
+	}
+	seen[slug]++
+	return slug
+}
@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContextPack(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":             "module example.com/shapes\n\ngo 1.21\n\nrequire github.com/x/y v1.0.0 // indirect\n",
+		"shapes.go":          symbolsFixture,
+		"circle/circle.go":   "package circle\n\n// Circle is round.\ntype Circle struct{}\n\nfunc (c Circle) Area() float64 { return 0 }\n",
+		"circle/handler.go":  "package circle\n\nfunc Handle() {}\n",
+		"circle/doc_test.go": "package circle\n",
+	})
+
+	testCases := []struct {
+		name      string
+		selectors []string
+		want      []string
+	}{
+		{
+			name:      "Test with a directory",
+			selectors: []string{filepath.Join(dir, "circle")},
+			want:      []string{"circle/circle.go", "circle/handler.go"},
+		},
+		{
+			name:      "Test with a glob",
+			selectors: []string{"*_handler.go", "**/handler.go"},
+			want:      []string{"circle/handler.go"},
+		},
+		{
+			name:      "Test with symbols",
+			selectors: []string{"Circle", "(*Square).Area"},
+			want:      []string{"Circle (circle/circle.go:3-4)", "Square.Area (shapes.go:17-20)"},
+		},
+		{
+			name:      "Test with a symbol in a selected file",
+			selectors: []string{filepath.Join(dir, "shapes.go"), "NewSquare", "shapes.go"},
+			want:      []string{"shapes.go"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pack, err := loadContextPack(dir, walkOptions{})
+			if err != nil {
+				t.Fatalf("loadContextPack() error = %v", err)
+			}
+			// Globs are relative to the module root and paths must exist,
+			// so the unmatched *_handler.go and bare shapes.go are not required.
+			if err := pack.selectAll(dir, tc.selectors, false); err != nil {
+				t.Fatalf("selectAll() error = %v", err)
+			}
+			var got []string
+			for _, item := range pack.Items {
+				got = append(got, item.Title)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %v, but got %v", tc.want, got)
+			}
+		})
+	}
+
+	pack, err := loadContextPack(dir, walkOptions{})
+	if err != nil {
+		t.Fatalf("loadContextPack() error = %v", err)
+	}
+	if err := pack.selectAll(dir, []string{"Unknown"}, true); exitCode(err) != exitUsage {
+		t.Errorf("Expected a usage error for an unmatched selector, but got %v", err)
+	}
+	if err := pack.selectAll(dir, []string{"Circle", "Square"}, true); err != nil {
+		t.Fatalf("selectAll() error = %v", err)
+	}
+
+	doc := pack.render()
+	for _, want := range []string{
+		"# Context pack: example.com/shapes\n\nAbout ",
+		"- [Circle (circle/circle.go:3-4)](#circle-circlecirclego3-4)\n",
+		"Module `example.com/shapes`: 2 packages, 3 files.\n",
+		"- `github.com/x/y` v1.0.0 (indirect)\n",
+		"- `circle/circle.go`\n  - struct `Circle`\n  - func `(Circle).Area() returns (float64)`\n",
+		"### Square (shapes.go:6-9)\n\n```go\n// Square is a square.\ntype Square struct {\n\tSide float64\n}\n```\n",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("Expected the pack to contain %q:\n%s", want, doc)
+		}
+	}
+
+	budgets := []struct {
+		name    string
+		budget  int
+		outline string
+		items   int
+	}{
+		{"Test with room for everything", 10000, outlineFull, 2},
+		{"Test with a compact outline", estimateTokens(doc) - 20, outlineCompact, 2},
+		{"Test with a dropped source", 140, outlineNone, 1},
+	}
+	for _, tc := range budgets {
+		t.Run(tc.name, func(t *testing.T) {
+			fitted := *pack
+			fitted.Outline, fitted.Budget, fitted.Omitted = outlineFull, tc.budget, nil
+			fitted.fit()
+			if fitted.Outline != tc.outline || len(fitted.Items) != tc.items {
+				t.Errorf("Expected outline %s and %d items, but got %s and %d", tc.outline, tc.items, fitted.Outline, len(fitted.Items))
+			}
+			if tokens := estimateTokens(fitted.render()); tokens > tc.budget {
+				t.Errorf("Expected at most %d tokens, but got %d", tc.budget, tokens)
+			}
+		})
+	}
+
+	// Every step of fit changes the size by what was measured up front.
+	stepped := *pack
+	stepped.Outline, stepped.Budget, stepped.Omitted = outlineFull, 1, nil
+	sizes := stepped.measure()
+	header, body := stepped.renderParts()
+	size := len(header) + len(body)
+	for {
+		delta, ok := stepped.shorten(sizes)
+		if !ok {
+			break
+		}
+		header, body = stepped.renderParts()
+		if size += delta; size != len(header)+len(body) {
+			t.Errorf("Expected a size of %d after omitting %v, but got %d", size, stepped.Omitted, len(header)+len(body))
+			size = len(header) + len(body)
+		}
+	}
+}
+
+func TestCodeFence(t *testing.T) {
+	got := codeFence("var s = `a`\nvar t = \"```\"\n")
+	want := "````go\nvar s = `a`\nvar t = \"```\"\n````\n"
+	if got != want {
+		t.Errorf("Expected %q, but got %q", want, got)
+	}
+}
+
+func TestDeltaPack(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":            "module example.com/shapes\n\ngo 1.21\n",
+		"shapes.go":         symbolsFixture,
+		"circle/circle.go":  "package circle\n\n// Circle is round.\ntype Circle struct{}\n\nfunc (c Circle) Area() float64 { return 0 }\n",
+		"circle/handler.go": "package circle\n\nfunc init() {}\n\nfunc init() {}\n\nfunc Handle() {}\n",
+	})
+	cache := &extractCache{dir: t.TempDir()}
+
+	first, err := loadContextPack(dir, walkOptions{})
+	if err != nil {
+		t.Fatalf("loadContextPack() error = %v", err)
+	}
+	first.ID = newPackID()
+	if err := cache.storePackState(first.state()); err != nil {
+		t.Fatalf("storePackState() error = %v", err)
+	}
+	previous, err := cache.loadPackState(first.ID)
+	if err != nil {
+		t.Fatalf("loadPackState() error = %v", err)
+	}
+	if len(previous.Symbols) != 11 {
+		t.Errorf("Expected 11 recorded declarations, but got %d", len(previous.Symbols))
+	}
+
+	writeTree(t, dir, map[string]string{
+		"circle/circle.go":  "package circle\n\n// Circle is round.\ntype Circle struct{ R float64 }\n\nfunc (c Circle) Area() float64 { return 0 }\n\nfunc Unit() Circle { return Circle{1} }\n",
+		"circle/handler.go": "package circle\n\nfunc init() {}\n\nfunc init() { println() }\n",
+	})
+	delta, err := loadContextPack(dir, walkOptions{})
+	if err != nil {
+		t.Fatalf("loadContextPack() error = %v", err)
+	}
+	delta.diffSince(previous)
+
+	var got []string
+	for _, item := range delta.Items {
+		got = append(got, item.Change+" "+item.Title)
+	}
+	want := []string{
+		"added Unit (circle/circle.go:8-8)",
+		"modified Circle (circle/circle.go:3-4)",
+		"modified init (circle/handler.go:5-5)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, but got %v", want, got)
+	}
+	if want := []string{"func `Handle` (circle/handler.go)"}; !reflect.DeepEqual(delta.Removed, want) {
+		t.Errorf("Expected removed %v, but got %v", want, delta.Removed)
+	}
+
+	doc := delta.render()
+	for _, want := range []string{
+		"# Context pack: example.com/shapes, changes since " + first.ID + "\n",
+		": 1 added, 2 modified and 1 removed declarations.\n\nRemoved:\n\n- func `Handle` (circle/handler.go)\n",
+		"## Added\n\n### Unit (circle/circle.go:8-8)\n",
+		"## Modified\n\n### Circle (circle/circle.go:3-4)\n",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("Expected the pack to contain %q:\n%s", want, doc)
+		}
+	}
+	if strings.Contains(doc, "## Outline") || strings.Contains(doc, "## Overview") {
+		t.Errorf("Expected a delta pack without overview and outline:\n%s", doc)
+	}
+
+	// A change left out for the budget is not recorded as seen.
+	delta.Items = delta.Items[:1]
+	state := delta.state()
+	if state.Symbols["circle/circle.go#Unit"].Hash == "" {
+		t.Errorf("Expected the shown addition to be recorded")
+	}
+	if state.Symbols["circle/circle.go#Circle"] != previous.Symbols["circle/circle.go#Circle"] {
+		t.Errorf("Expected the omitted modification to keep its previous record")
+	}
+	if _, ok := state.Symbols["circle/handler.go#Handle"]; ok {
+		t.Errorf("Expected the removed declaration to be dropped")
+	}
+
+	if _, err := cache.loadPackState("../secrets"); exitCode(err) != exitUsage {
+		t.Errorf("Expected a usage error for an invalid id, but got %v", err)
+	}
+	if _, err := cache.loadPackState("0123456789ab"); exitCode(err) != exitPathNotFound {
+		t.Errorf("Expected a not found error for an unknown id, but got %v", err)
+	}
+
+	if err := delta.checkSince(previous); err != nil {
+		t.Errorf("checkSince() error = %v", err)
+	}
+	otherModule := *delta
+	otherModule.Module = "example.com/circles"
+	if err := otherModule.checkSince(previous); exitCode(err) != exitUsage {
+		t.Errorf("Expected a usage error for a pack of another module, but got %v", err)
+	}
+	otherWalk := *delta
+	otherWalk.walk = walkOptions{IncludeTests: true, Tags: []string{"integration"}}
+	err = otherWalk.checkSince(previous)
+	if exitCode(err) != exitUsage || !strings.HasSuffix(err.Error(), "walk flags none, not --include-tests --tags=integration") {
+		t.Errorf("Expected a usage error naming the walk flags, but got %v", err)
+	}
+}
+
+func TestPrunePackStates(t *testing.T) {
+	cache := &extractCache{dir: t.TempDir()}
+	for id, created := range map[string]time.Time{
+		"000000000001": time.Now(),
+		"000000000002": time.Now().Add(-48 * time.Hour),
+	} {
+		if err := cache.storePackState(&packState{ID: id, Created: created}); err != nil {
+			t.Fatalf("storePackState() error = %v", err)
+		}
+	}
+	if err := os.WriteFile(cache.packStatePath("000000000003"), []byte("{"), 0o644); err != nil {
+		t.Fatalf("Failed to write pack: %v", err)
+	}
+
+	removed, err := cache.prunePackStates(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("prunePackStates() error = %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Expected 2 removed packs, but got %d", removed)
+	}
+	if _, err := cache.loadPackState("000000000001"); err != nil {
+		t.Errorf("Expected the recent pack to be kept, but got %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Change kinds of the declarations in a delta pack.
+const (
+	changeAdded    = "added"
+	changeModified = "modified"
+)
+
+// packState records the declarations of the module as a pack presented them,
+// so that a later pack can show only what changed since.
+type packState struct {
+	ID      string
+	Module  string
+	Walk    walkOptions // the walk that selected the module's files
+	Created time.Time
+	Symbols map[string]packSymbol // keyed by symbolKey
+}
+
+// packSymbol is the recorded form of one declaration.
+type packSymbol struct {
+	Name string
+	Kind string
+	File string
+	Hash string // of the source, including the doc comment
+}
+
+var packIDPattern = regexp.MustCompile(`^[0-9a-f]{12}$`)
+
+// newPackID returns a random id for a pack.
+func newPackID() string {
+	id := make([]byte, 6)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// symbolKeys keys the declarations of a file by file and name. Names declared
+// more than once in a file, such as init, are numbered in order.
+func symbolKeys(symbols []symbolSource) ([]string, map[string]symbolSource) {
+	var keys []string
+	byKey := make(map[string]symbolSource, len(symbols))
+	seen := make(map[string]int)
+	for _, symbol := range symbols {
+		key := symbol.File + "#" + symbol.Name
+		if n := seen[key]; n > 0 {
+			key = fmt.Sprintf("%s#%d", key, n+1)
+		}
+		seen[symbol.File+"#"+symbol.Name]++
+		keys = append(keys, key)
+		byKey[key] = symbol
+	}
+	return keys, byKey
+}
+
+func symbolHash(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+func symbolTitle(symbol symbolSource) string {
+	return fmt.Sprintf("%s (%s:%d-%d)", symbol.Name, symbol.File, symbol.Line, symbol.EndLine)
+}
+
+// checkSince reports whether a delta pack can follow on from previous: it
+// must be of the same module, and its files chosen by the same walk flags, or
+// declarations would show up as added or removed that were only walked
+// differently.
+func (p *contextPack) checkSince(previous *packState) error {
+	if previous.Module != p.Module {
+		return withExitCode(exitUsage, fmt.Errorf("pack '%s' is of module %s, not %s", previous.ID, previous.Module, p.Module))
+	}
+	if was, is := previous.Walk.flags(), p.walk.flags(); was != is {
+		if was == "" {
+			was = "none"
+		}
+		if is == "" {
+			is = "none"
+		}
+		return withExitCode(exitUsage, fmt.Errorf("pack '%s' was made with walk flags %s, not %s", previous.ID, was, is))
+	}
+	return nil
+}
+
+// diffSince turns the pack into a delta pack: its sources become the
+// declarations added or modified since the previous pack, and the ones
+// removed since are listed. The overview and outline are left out.
+func (p *contextPack) diffSince(previous *packState) {
+	p.Since = previous
+	p.Outline = outlineNone
+	p.Items = nil
+	p.Removed = nil
+	p.changed = make(map[string]bool)
+
+	current := make(map[string]bool)
+	var modified []packItem
+	for _, file := range p.Files {
+		keys, byKey := symbolKeys(file.symbols)
+		for _, key := range keys {
+			current[key] = true
+			symbol := byKey[key]
+			item := packItem{Title: symbolTitle(symbol), File: symbol.File, Source: symbol.Source, key: key}
+			recorded, ok := previous.Symbols[key]
+			switch {
+			case !ok:
+				item.Change = changeAdded
+				p.Items = append(p.Items, item)
+			case recorded.Hash != symbolHash(symbol.Source):
+				item.Change = changeModified
+				modified = append(modified, item)
+			default:
+				continue
+			}
+			p.changed[key] = true
+		}
+	}
+	added := len(p.Items)
+	p.Items = append(p.Items, modified...)
+
+	var removed []string
+	for key := range previous.Symbols {
+		if !current[key] {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	for _, key := range removed {
+		symbol := previous.Symbols[key]
+		p.Removed = append(p.Removed, fmt.Sprintf("%s `%s` (%s)", symbol.Kind, symbol.Name, symbol.File))
+	}
+
+	when := previous.Created.Local().Format("2006-01-02 15:04")
+	if len(p.Items) == 0 && len(p.Removed) == 0 {
+		p.Summary = fmt.Sprintf("No declarations changed since pack `%s` of %s.\n", previous.ID, when)
+		return
+	}
+	p.Summary = fmt.Sprintf("Since pack `%s` of %s: %d added, %d modified and %d removed declarations.\n",
+		previous.ID, when, added, len(modified), len(p.Removed))
+}
+
+// state records the declarations of the pack's files under the pack's id.
+// Changes a delta pack had to leave out for the budget keep their previous
+// record, so that the next delta pack shows them again.
+func (p *contextPack) state() *packState {
+	state := &packState{ID: p.ID, Module: p.Module, Walk: p.walk, Created: time.Now(), Symbols: make(map[string]packSymbol)}
+	for _, file := range p.Files {
+		keys, byKey := symbolKeys(file.symbols)
+		for _, key := range keys {
+			symbol := byKey[key]
+			state.Symbols[key] = packSymbol{Name: symbol.Name, Kind: symbol.Kind, File: symbol.File, Hash: symbolHash(symbol.Source)}
+		}
+	}
+
+	shown := make(map[string]bool)
+	for _, item := range p.Items {
+		shown[item.key] = true
+	}
+	for key := range p.changed {
+		if shown[key] {
+			continue
+		}
+		if recorded, ok := p.Since.Symbols[key]; ok {
+			state.Symbols[key] = recorded
+		} else {
+			delete(state.Symbols, key)
+		}
+	}
+	return state
+}
+
+// packStatePath returns where the state of the pack with the given id is kept.
+func (c *extractCache) packStatePath(id string) string {
+	return filepath.Join(c.dir, "packs", id+".json")
+}
+
+func (c *extractCache) storePackState(state *packState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.packStatePath(state.ID), data)
+}
+
+func (c *extractCache) loadPackState(id string) (*packState, error) {
+	id = strings.TrimSpace(id)
+	if !packIDPattern.MatchString(id) {
+		return nil, withExitCode(exitUsage, fmt.Errorf("invalid pack id '%s'", id))
+	}
+	data, err := os.ReadFile(c.packStatePath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, withExitCode(exitPathNotFound, fmt.Errorf("no pack '%s' recorded in %s", id, c.dir))
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state packState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("reading pack '%s': %w", id, err)
+	}
+	return &state, nil
+}
+
+// walkPackStates calls fn for every recorded pack. Unreadable ones are passed
+// with a nil state.
+func (c *extractCache) walkPackStates(fn func(path string, info fs.FileInfo, state *packState) error) error {
+	entries, err := os.ReadDir(filepath.Join(c.dir, "packs"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(c.dir, "packs", entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		var state *packState
+		if data, err := os.ReadFile(path); err == nil {
+			state = &packState{}
+			if json.Unmarshal(data, state) != nil {
+				state = nil
+			}
+		}
+		if err := fn(path, info, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prunePackStates removes the packs recorded more than maxAge ago, and
+// unreadable ones, and returns how many were removed.
+func (c *extractCache) prunePackStates(maxAge time.Duration) (int, error) {
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	err := c.walkPackStates(func(path string, info fs.FileInfo, state *packState) error {
+		if state != nil && state.Created.After(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
@@ -4,43 +4,76 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
 )
 
+// version is the release of gosymex, set at build time with
+// -ldflags "-X github.com/jonesrussell/gosymex/cmd.version=v1.2.3".
+var version = "dev"
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-	Use:   "gosymex",
-	Short: "A brief description of your application",
+	Use:     "gosymex",
+	Version: version,
+	Short:   "A brief description of your application",
 	Long: `A longer description that spans multiple lines and likely contains
 examples and usage of using your application. For example:
 
 Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+to quickly create a Cobra application.
+
+Diagnostics are written to stderr. Exit codes:
+  0  success
+  1  failure
+  2  invalid arguments or flags
+  3  path not found
+  4  parse error
+  5  partial failure: some files could not be processed`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	SilenceErrors: true,
+	SilenceUsage:  true,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	err := rootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
+	cmd, err := rootCmd.ExecuteC()
+	if err == nil {
+		return
+	}
+
+	code := exitCode(err)
+	if !commandStarted {
+		code = exitUsage
+	}
+	reportError(err, code)
+	if code == exitUsage {
+		fmt.Fprint(os.Stderr, "\n"+cmd.UsageString())
 	}
+	os.Exit(code)
 }
 
 func init() {
-	// Here you will define your flags and configuration settings.
-	// Cobra supports persistent flags, which, if defined here,
-	// will be global for your application.
-
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.gosymex.yaml)")
+	// Set here rather than in the literal: applying the config file looks
+	// commands up from rootCmd.
+	rootCmd.PersistentPreRunE = prepareCommand
+}
 
-	// Cobra also supports local flags, which will only run
-	// when this action is called directly.
-	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+// prepareCommand runs once flags are parsed: it fills in defaults from the
+// config file and validates the global flags.
+func prepareCommand(cmd *cobra.Command, args []string) error {
+	commandStarted = true
+	if err := applyProjectConfig(cmd); err != nil {
+		return err
+	}
+	if errorFormat != errorsText && errorFormat != errorsJSON {
+		return withExitCode(exitUsage, fmt.Errorf("invalid --errors %q: must be %s or %s", errorFormat, errorsText, errorsJSON))
+	}
+	return nil
 }
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// schemaVersion identifies the shape of describe output: the envelope and the
+// FileDetails it holds. Bump it whenever that shape changes, including purely
+// additive changes, or the way a field is rendered changes, so that consumers
+// can tell what to expect and cached results written by older releases are
+// never served. Version 9 lists unnamed parameters and every name of grouped
+// results in Funcs; version 10 records only the options that shape the
+// described files.
+const schemaVersion = 10
+
+// toolName is reported in the envelope of machine-readable output.
+const toolName = "gosymex"
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of describe output",
+	Long: `Print the JSON Schema (draft 2020-12) of the document written by describe.
+The schema is generated from the types the output is built from, so it
+always matches the running version; its SchemaVersion is fixed to the
+version this build writes.`,
+	Args: cobra.NoArgs,
+	RunE: runSchemaCmd,
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+}
+
+func runSchemaCmd(cmd *cobra.Command, args []string) error {
+	jsonSchema, err := json.MarshalIndent(describeSchema(), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(jsonSchema))
+	return nil
+}
+
+// describeOutput is the envelope written by describe. It records which
+// schema, tool version and options produced the files it holds.
+type describeOutput struct {
+	SchemaVersion int
+	Tool          toolInfo
+	Options       outputOptions
+	Files         []*FileDetails
+	Errors        []errorRecord `json:",omitempty"` // files that could not be described
+}
+
+type toolInfo struct {
+	Name    string
+	Version string
+}
+
+// outputOptions are the generation options recorded in the envelope: those
+// that decide what the described files contain, not how they were found.
+// Fields are copied rather than embedded so that new flags do not change the
+// schema.
+type outputOptions struct {
+	Constraints      bool
+	Tolerant         bool
+	Metrics          bool
+	IncludeTests     bool
+	IncludeMocks     bool
+	IncludeGenerated bool
+	GOOS             string
+	GOARCH           string
+	Tags             []string
+}
+
+func newDescribeOutput(walkOpts walkOptions, describeOpts describeOptions) *describeOutput {
+	return &describeOutput{
+		SchemaVersion: schemaVersion,
+		Tool:          toolInfo{Name: toolName, Version: version},
+		Options: outputOptions{
+			Constraints:      describeOpts.Constraints,
+			Tolerant:         describeOpts.Tolerant,
+			Metrics:          describeOpts.Metrics,
+			IncludeTests:     walkOpts.IncludeTests,
+			IncludeMocks:     walkOpts.IncludeMocks,
+			IncludeGenerated: walkOpts.IncludeGenerated,
+			GOOS:             walkOpts.GOOS,
+			GOARCH:           walkOpts.GOARCH,
+			Tags:             walkOpts.Tags,
+		},
+		Files: []*FileDetails{},
+	}
+}
+
+// addError records a file that could not be described.
+func (o *describeOutput) addError(filePath string, err error) {
+	o.Errors = append(o.Errors, errorRecord{File: filePath, Error: err.Error(), Code: exitCode(err)})
+}
+
+// describeSchema returns the JSON Schema of describeOutput.
+func describeSchema() map[string]interface{} {
+	defs := make(map[string]interface{})
+	root := typeSchema(reflect.TypeOf(describeOutput{}), defs)
+
+	// The version is pinned so that a document validates only against the
+	// schema of the version that wrote it.
+	envelope := defs[schemaName(reflect.TypeOf(describeOutput{}))].(map[string]interface{})
+	envelope["properties"].(map[string]interface{})["SchemaVersion"] = map[string]interface{}{
+		"type":  "integer",
+		"const": schemaVersion,
+	}
+
+	return map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "gosymex describe output",
+		"description": fmt.Sprintf("Output of gosymex describe, schema version %d.", schemaVersion),
+		"$ref":        root["$ref"],
+		"$defs":       defs,
+	}
+}
+
+// typeSchema describes how encoding/json encodes values of type t. Struct
+// types are added to defs and referenced by name.
+func typeSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem(), defs)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), defs)}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := defs[name]; !ok {
+			defs[name] = nil // reserve the name while the fields are described
+			properties := make(map[string]interface{})
+			required := []string{}
+			structSchema(t, defs, properties, &required)
+			defs[name] = map[string]interface{}{
+				"type":       "object",
+				"properties": properties,
+				"required":   required,
+			}
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema adds the encoded fields of t to properties. Fields of embedded
+// structs are promoted, as encoding/json does; fields without omitempty are
+// always present, and their nil slices and maps are encoded as null.
+func structSchema(t reflect.Type, defs map[string]interface{}, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			structSchema(field.Type, defs, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := typeSchema(field.Type, defs)
+		omitEmpty := strings.Contains(options, "omitempty")
+		if kind := field.Type.Kind(); !omitEmpty && (kind == reflect.Slice || kind == reflect.Map) {
+			schema["type"] = []string{schema["type"].(string), "null"}
+		}
+		properties[name] = schema
+		if !omitEmpty {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// schemaName is the $defs name of a struct type. Unexported model types are
+// capitalized so that the schema reads like the documented output.
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	return strings.ToUpper(name[:1]) + name[1:]
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// TestDescribeSchema pins the schema of the current schema version only; the
+// golden files of earlier versions are not kept. A change to the output shape
+// fails it until schemaVersion is bumped and the golden file of the new
+// version is written with go test ./cmd -update; the previous one is then
+// deleted.
+func TestDescribeSchema(t *testing.T) {
+	got, err := json.MarshalIndent(describeSchema(), "", "  ")
+	if err != nil {
+		t.Fatalf("json.MarshalIndent() error = %v", err)
+	}
+	got = append(got, '\n')
+
+	golden := filepath.Join("testdata", fmt.Sprintf("describe.schema.v%d.json", schemaVersion))
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("No golden schema for version %d (run go test ./cmd -update): %v", schemaVersion, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("The schema of version %d changed: bump schemaVersion and run go test ./cmd -update\n%s", schemaVersion, got)
+	}
+}
+
+func TestLoadDescribeSnapshot(t *testing.T) {
+	details := `{"FilePath": "pkg/a.go", "Funcs": ["Run() error"]}`
+	testCases := []struct {
+		name string
+		data string
+	}{
+		{"Test with an envelope", `{"SchemaVersion": 7, "Files": [` + details + `]}`},
+		{"Test with bare documents", details + "\n" + `{"FilePath": "pkg/a_test.go", "Funcs": ["TestRun(t *testing.T)"]}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			surface, err := loadDescribeSnapshot("snapshot.json", []byte(tc.data))
+			if err != nil {
+				t.Fatalf("loadDescribeSnapshot() error = %v", err)
+			}
+			var names []string
+			for _, symbol := range surface.Symbols {
+				names = append(names, symbol.Name)
+			}
+			if !reflect.DeepEqual(names, []string{"Run"}) {
+				t.Errorf("Expected the Run function only, but got %v", names)
+			}
+		})
+	}
+}
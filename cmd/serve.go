@@ -0,0 +1,369 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve [dir]",
+	Short: "Serve describe, detect and symbol lookups over a local HTTP JSON API",
+	Long: `Serve describe, detect and symbol lookups over a local HTTP JSON API. The
+Go files under dir are parsed once into an in-memory index, which is kept up
+to date by polling for changes, so queries are answered without parsing.
+
+Endpoints, all GET, with paths relative to dir:
+  /describe?path=P      describe output of a file, or the envelope of the
+                        files under a directory (default is dir)
+  /symbols?name=N       source of the declarations named N, Type.Method or
+                        (*Type).Method
+  /references?name=N    uses of N, matched by name
+  /detect?path=P        the module containing P and its dependencies
+  /health               index size and last refresh
+
+Errors are returned as {"Error", "Code"} with a 4xx or 5xx status.`,
+	Example: `  gosymex serve --addr localhost:7878
+  curl 'localhost:7878/symbols?name=Server.Start'`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runServeCmd,
+}
+
+func init() {
+	addWalkFlags(serveCmd)
+	serveCmd.Flags().String("addr", "localhost:7878", "Address to listen on")
+	serveCmd.Flags().Duration("interval", time.Second, "How often to poll for changed files")
+	rootCmd.AddCommand(serveCmd)
+}
+
+func runServeCmd(cmd *cobra.Command, args []string) error {
+	root := "."
+	if len(args) > 0 {
+		root = args[0]
+	}
+	addr, _ := cmd.Flags().GetString("addr")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	if info, err := os.Stat(root); err != nil {
+		return fmt.Errorf("accessing path: %w", err)
+	} else if !info.IsDir() {
+		return withExitCode(exitUsage, fmt.Errorf("'%s' is not a directory", root))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	index := newModuleIndex(root, walkOptionsFromFlags(cmd))
+	stamps, err := index.build()
+	if err != nil {
+		return fmt.Errorf("indexing %s: %w", root, err)
+	}
+	go pollTree(ctx, root, interval, index.opts, stamps, index.update)
+
+	server := &http.Server{Addr: addr, Handler: index.handler()}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving %d files from %s on http://%s\n", index.size(), root, addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving: %w", err)
+	}
+	return nil
+}
+
+// indexedFile is the parsed state of one file in the index.
+type indexedFile struct {
+	details *FileDetails
+	symbols []symbolSource
+	idents  *fileIdents
+}
+
+// moduleIndex holds the described files under a root, keyed by the paths
+// walkGoFiles reports. Files that fail to parse are kept as errors until
+// they are fixed.
+type moduleIndex struct {
+	root string
+	opts walkOptions
+
+	mu      sync.RWMutex
+	files   map[string]*indexedFile
+	errors  map[string]errorRecord
+	updated time.Time
+}
+
+func newModuleIndex(root string, opts walkOptions) *moduleIndex {
+	return &moduleIndex{
+		root:   root,
+		opts:   opts,
+		files:  make(map[string]*indexedFile),
+		errors: make(map[string]errorRecord),
+	}
+}
+
+// build indexes every file under the root and returns the scan the index
+// reflects, for polling to continue from.
+func (x *moduleIndex) build() (map[string]fileStamp, error) {
+	stamps, err := scanTree(x.root, x.opts)
+	if err != nil {
+		return nil, err
+	}
+	x.update(changedFiles(nil, stamps))
+	return stamps, nil
+}
+
+// update re-reads changed files and drops removed ones. Files are parsed
+// before the lock is taken so that queries are not held up.
+func (x *moduleIndex) update(changes []fileChange) {
+	parsed := make(map[string]*indexedFile, len(changes))
+	failed := make(map[string]errorRecord)
+	for _, change := range changes {
+		if change.Removed {
+			continue
+		}
+		file, err := indexFile(change.Path)
+		if err != nil {
+			failed[change.Path] = errorRecord{File: change.Path, Error: err.Error(), Code: exitCode(err)}
+			continue
+		}
+		parsed[change.Path] = file
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, change := range changes {
+		delete(x.files, change.Path)
+		delete(x.errors, change.Path)
+		if file, ok := parsed[change.Path]; ok {
+			x.files[change.Path] = file
+		} else if record, ok := failed[change.Path]; ok {
+			x.errors[change.Path] = record
+		}
+	}
+	x.updated = time.Now()
+}
+
+func indexFile(filePath string) (*indexedFile, error) {
+	src, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	details, err := extractSource(filePath, src, describeOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("parsing file: %w", err)
+	}
+	file := &indexedFile{details: details}
+	err = fileSymbols(filePath, src, func(name, kind string, node ast.Node, doc *ast.CommentGroup, fset *token.FileSet) {
+		file.symbols = append(file.symbols, declSource(fset, src, name, kind, node, doc))
+	})
+	if err != nil {
+		return nil, err
+	}
+	file.idents, err = indexIdents(filePath, src)
+	return file, err
+}
+
+func (x *moduleIndex) size() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.files)
+}
+
+// resolve maps a request path to the form index keys take.
+func (x *moduleIndex) resolve(path string) string {
+	if path == "" {
+		return filepath.Clean(x.root)
+	}
+	if filepath.IsAbs(path) {
+		if rel, err := filepath.Rel(x.root, path); err == nil && !strings.HasPrefix(rel, "..") {
+			path = rel
+		} else {
+			return filepath.Clean(path)
+		}
+	}
+	return filepath.Join(x.root, path)
+}
+
+// sortedPaths returns the indexed paths at or below path, sorted.
+func (x *moduleIndex) sortedPaths(path string) []string {
+	var paths []string
+	for filePath := range x.files {
+		if within(filePath, path) {
+			paths = append(paths, filePath)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// within reports whether filePath is path or lies below it.
+func within(filePath, path string) bool {
+	if path == "." {
+		return !filepath.IsAbs(filePath) && !strings.HasPrefix(filePath, "..")
+	}
+	return filePath == path || strings.HasPrefix(filePath, path+string(filepath.Separator))
+}
+
+// describe returns a file's details, or the envelope of the files below a
+// directory.
+func (x *moduleIndex) describe(path string) (interface{}, error) {
+	path = x.resolve(path)
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if file, ok := x.files[path]; ok {
+		return file.details, nil
+	}
+	if record, ok := x.errors[path]; ok {
+		return nil, withExitCode(record.Code, errors.New(record.Error))
+	}
+
+	out := newDescribeOutput(x.opts, describeOptions{})
+	for _, filePath := range x.sortedPaths(path) {
+		out.Files = append(out.Files, x.files[filePath].details)
+	}
+	var failed []string
+	for filePath := range x.errors {
+		if within(filePath, path) {
+			failed = append(failed, filePath)
+		}
+	}
+	sort.Strings(failed)
+	for _, filePath := range failed {
+		out.Errors = append(out.Errors, x.errors[filePath])
+	}
+	if len(out.Files) == 0 && len(out.Errors) == 0 {
+		return nil, withExitCode(exitPathNotFound, fmt.Errorf("no indexed Go files at '%s'", path))
+	}
+	return out, nil
+}
+
+// symbols returns the declarations named name.
+func (x *moduleIndex) symbols(name string) []symbolSource {
+	name = normalizeSymbolName(name)
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	found := []symbolSource{}
+	for _, filePath := range x.sortedPaths(x.resolve("")) {
+		for _, symbol := range x.files[filePath].symbols {
+			if symbol.Name == name {
+				found = append(found, symbol)
+			}
+		}
+	}
+	return found
+}
+
+// references returns the uses of name across the index.
+func (x *moduleIndex) references(name string) []symbolReference {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	refs := []symbolReference{}
+	for _, filePath := range x.sortedPaths(x.resolve("")) {
+		refs = append(refs, x.files[filePath].idents.references(name)...)
+	}
+	return refs
+}
+
+// indexHealth is the response of /health.
+type indexHealth struct {
+	Root    string
+	Files   int
+	Errors  int
+	Updated time.Time
+}
+
+func (x *moduleIndex) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/describe", func(w http.ResponseWriter, r *http.Request) {
+		result, err := x.describe(r.URL.Query().Get("path"))
+		writeJSONResponse(w, result, err)
+	})
+	mux.HandleFunc("/symbols", func(w http.ResponseWriter, r *http.Request) {
+		name, err := requiredParam(r, "name")
+		if err != nil {
+			writeJSONResponse(w, nil, err)
+			return
+		}
+		writeJSONResponse(w, x.symbols(name), nil)
+	})
+	mux.HandleFunc("/references", func(w http.ResponseWriter, r *http.Request) {
+		name, err := requiredParam(r, "name")
+		if err != nil {
+			writeJSONResponse(w, nil, err)
+			return
+		}
+		writeJSONResponse(w, x.references(name), nil)
+	})
+	mux.HandleFunc("/detect", func(w http.ResponseWriter, r *http.Request) {
+		project, err := describeProject(x.resolve(r.URL.Query().Get("path")))
+		writeJSONResponse(w, project, err)
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		x.mu.RLock()
+		health := indexHealth{Root: x.root, Files: len(x.files), Errors: len(x.errors), Updated: x.updated}
+		x.mu.RUnlock()
+		writeJSONResponse(w, health, nil)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSONError(w, http.StatusMethodNotAllowed, errorRecord{Error: "only GET is supported", Code: exitUsage})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func requiredParam(r *http.Request, name string) (string, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return "", withExitCode(exitUsage, fmt.Errorf("missing query parameter '%s'", name))
+	}
+	return value, nil
+}
+
+// writeJSONResponse writes a result, or an error record with the HTTP status
+// matching its exit code.
+func writeJSONResponse(w http.ResponseWriter, result interface{}, err error) {
+	if err != nil {
+		code := exitCode(err)
+		status := http.StatusInternalServerError
+		switch code {
+		case exitUsage:
+			status = http.StatusBadRequest
+		case exitPathNotFound:
+			status = http.StatusNotFound
+		case exitParseError:
+			status = http.StatusUnprocessableEntity
+		}
+		writeJSONError(w, status, errorRecord{Error: err.Error(), Code: code})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, record errorRecord) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(record)
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServeIndex(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":           "module example.com/shapes\n\ngo 1.21\n",
+		"shapes.go":        symbolsFixture,
+		"circle/circle.go": "package circle\n\ntype Circle struct{}\n",
+		"broken/broken.go": "package broken\n\nfunc {",
+	})
+
+	index := newModuleIndex(dir, walkOptions{})
+	if _, err := index.build(); err != nil {
+		t.Fatalf("build() error = %v", err)
+	}
+	server := httptest.NewServer(index.handler())
+	defer server.Close()
+
+	get := func(t *testing.T, path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	testCases := []struct {
+		name   string
+		path   string
+		status int
+		expect []string
+	}{
+		{
+			name:   "Test with a described file",
+			path:   "/describe?path=circle/circle.go",
+			status: http.StatusOK,
+			expect: []string{`"Structs":{"Circle":[]}`},
+		},
+		{
+			name:   "Test with a described directory",
+			path:   "/describe",
+			status: http.StatusOK,
+			expect: []string{`"SchemaVersion":`, `circle.go"`, `shapes.go"`, `"Code":4`},
+		},
+		{
+			name:   "Test with a file that does not parse",
+			path:   "/describe?path=broken/broken.go",
+			status: http.StatusUnprocessableEntity,
+			expect: []string{`"Code":4`},
+		},
+		{
+			name:   "Test with an unknown path",
+			path:   "/describe?path=missing",
+			status: http.StatusNotFound,
+			expect: []string{`"Code":3`},
+		},
+		{
+			name:   "Test with a symbol",
+			path:   "/symbols?name=(*Square).Area",
+			status: http.StatusOK,
+			expect: []string{`"Kind":"method"`, `"Line":17`},
+		},
+		{
+			name:   "Test with references",
+			path:   "/references?name=Square.Area",
+			status: http.StatusOK,
+			expect: []string{`"Text":"_ = sq.Area()"`},
+		},
+		{
+			name:   "Test with a missing parameter",
+			path:   "/symbols",
+			status: http.StatusBadRequest,
+			expect: []string{`"Code":2`},
+		},
+		{
+			name:   "Test with detect",
+			path:   "/detect?path=circle",
+			status: http.StatusOK,
+			expect: []string{`"Module":"example.com/shapes"`},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := get(t, tc.path)
+			if status != tc.status {
+				t.Errorf("Expected status %d, but got %d: %s", tc.status, status, body)
+			}
+			for _, want := range tc.expect {
+				if !strings.Contains(body, want) {
+					t.Errorf("Expected the response to contain %s:\n%s", want, body)
+				}
+			}
+		})
+	}
+
+	t.Run("Test with a refreshed index", func(t *testing.T) {
+		broken := filepath.Join(dir, "broken", "broken.go")
+		if err := os.WriteFile(broken, []byte("package broken\n\nfunc Fixed() {}\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		circle := filepath.Join(dir, "circle", "circle.go")
+		index.update([]fileChange{{Path: broken}, {Path: circle, Removed: true}})
+
+		if status, body := get(t, "/symbols?name=Fixed"); status != http.StatusOK || !strings.Contains(body, `"Source":"func Fixed() {}"`) {
+			t.Errorf("Expected the fixed file to be indexed, but got %d: %s", status, body)
+		}
+		if status, _ := get(t, "/describe?path=circle/circle.go"); status != http.StatusNotFound {
+			t.Errorf("Expected the removed file to be gone, but got %d", status)
+		}
+		var health indexHealth
+		_, body := get(t, "/health")
+		if err := json.Unmarshal([]byte(body), &health); err != nil || health.Files != 2 || health.Errors != 0 {
+			t.Errorf("Unexpected health %s", body)
+		}
+	})
+}
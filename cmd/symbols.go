@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+)
+
+// symbolSource is the source of one top-level declaration.
+type symbolSource struct {
+	Name    string // Name, or Type.Method for methods
+	Kind    string // func, method, type, const or var
+	File    string
+	Line    int
+	EndLine int
+	Source  string // including the doc comment
+}
+
+// symbolReference is one use of an identifier.
+type symbolReference struct {
+	File   string
+	Line   int
+	Column int
+	Text   string // the source line, trimmed
+}
+
+// normalizeSymbolName accepts Name, Type.Method and (*Type).Method and returns
+// the Name or Type.Method form symbols are matched by.
+func normalizeSymbolName(name string) string {
+	return strings.NewReplacer("(", "", ")", "", "*", "").Replace(strings.TrimSpace(name))
+}
+
+// declName returns the Name or Type.Method form of a function declaration.
+func declName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	typ := fn.Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	switch t := typ.(type) {
+	case *ast.IndexExpr:
+		typ = t.X
+	case *ast.IndexListExpr:
+		typ = t.X
+	}
+	if ident, ok := typ.(*ast.Ident); ok {
+		return ident.Name + "." + fn.Name.Name
+	}
+	return fn.Name.Name
+}
+
+// fileSymbols parses a Go file and calls fn for every top-level declaration
+// with its name, kind and the node spanning its source.
+func fileSymbols(filePath string, src []byte, fn func(name, kind string, node ast.Node, doc *ast.CommentGroup, fset *token.FileSet)) error {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filePath, src, parseMode)
+	if err != nil {
+		return err
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			kind := "func"
+			if d.Recv != nil {
+				kind = "method"
+			}
+			fn(declName(d), kind, d, d.Doc, fset)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				// Ungrouped declarations keep their keyword and doc comment.
+				var node ast.Node = spec
+				doc := d.Doc
+				if d.Lparen.IsValid() {
+					doc = specDoc(spec)
+				} else {
+					node = d
+				}
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					fn(s.Name.Name, "type", node, doc, fset)
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						fn(name.Name, d.Tok.String(), node, doc, fset)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func specDoc(spec ast.Spec) *ast.CommentGroup {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return s.Doc
+	case *ast.ValueSpec:
+		return s.Doc
+	}
+	return nil
+}
+
+// findSymbol returns the declarations named name in the Go files under root.
+func findSymbol(root string, opts walkOptions, name string) ([]symbolSource, error) {
+	name = normalizeSymbolName(name)
+	var found []symbolSource
+	var failures fileFailures
+	err := walkGoFiles(root, opts, func(filePath string, info os.FileInfo) error {
+		src, err := os.ReadFile(filePath)
+		if err == nil {
+			err = fileSymbols(filePath, src, func(declared, kind string, node ast.Node, doc *ast.CommentGroup, fset *token.FileSet) {
+				if declared == name {
+					found = append(found, declSource(fset, src, declared, kind, node, doc))
+				}
+			})
+		}
+		failures.add(err)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, failures.err()
+	}
+	return found, nil
+}
+
+// declSource cuts the source of a declaration, with its doc comment, out of
+// the file content.
+func declSource(fset *token.FileSet, src []byte, name, kind string, node ast.Node, doc *ast.CommentGroup) symbolSource {
+	start := node.Pos()
+	if doc != nil {
+		start = doc.Pos()
+	}
+	from, to := fset.Position(start), fset.Position(node.End())
+	return symbolSource{
+		Name:    name,
+		Kind:    kind,
+		File:    from.Filename,
+		Line:    from.Line,
+		EndLine: to.Line,
+		Source:  string(src[from.Offset:to.Offset]),
+	}
+}
+
+// findReferences returns the identifiers named like the symbol in the Go
+// files under root, leaving out the declaration itself. For Type.Method only
+// selectors of Method are reported. Matching is by name, not by type, so a
+// local variable named like the symbol is reported too.
+func findReferences(root string, opts walkOptions, name string) ([]symbolReference, error) {
+	var refs []symbolReference
+	var failures fileFailures
+	err := walkGoFiles(root, opts, func(filePath string, info os.FileInfo) error {
+		src, err := os.ReadFile(filePath)
+		if err == nil {
+			var found []symbolReference
+			found, err = fileReferences(filePath, src, name)
+			refs = append(refs, found...)
+		}
+		failures.add(err)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, failures.err()
+	}
+	return refs, nil
+}
+
+// fileReferences returns the references to a symbol in one file.
+func fileReferences(filePath string, src []byte, name string) ([]symbolReference, error) {
+	idents, err := indexIdents(filePath, src)
+	if err != nil {
+		return nil, err
+	}
+	return idents.references(name), nil
+}
+
+// identUse is one identifier of a file.
+type identUse struct {
+	Line     int
+	Column   int
+	Selector bool   // the selected name of a selector expression
+	Declares string // the Name or Type.Method it declares, for declarations
+}
+
+// fileIdents indexes the identifiers of a file by name, so that references
+// can be looked up without parsing the file again.
+type fileIdents struct {
+	path  string
+	lines [][]byte
+	uses  map[string][]identUse
+}
+
+// indexIdents parses a file and indexes its identifiers.
+func indexIdents(filePath string, src []byte) (*fileIdents, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filePath, src, parseMode)
+	if err != nil {
+		return nil, err
+	}
+
+	declares := make(map[*ast.Ident]string)
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			declares[fn.Name] = declName(fn)
+		}
+	}
+	selected := make(map[*ast.Ident]bool)
+	idents := &fileIdents{path: filePath, lines: bytes.Split(src, []byte("\n")), uses: make(map[string][]identUse)}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			selected[n.Sel] = true
+		case *ast.TypeSpec:
+			declares[n.Name] = n.Name.Name
+		case *ast.ValueSpec:
+			if isTopLevel(file, n) {
+				for _, id := range n.Names {
+					declares[id] = id.Name
+				}
+			}
+		case *ast.Ident:
+			pos := fset.Position(n.Pos())
+			idents.uses[n.Name] = append(idents.uses[n.Name], identUse{
+				Line:     pos.Line,
+				Column:   pos.Column,
+				Selector: selected[n],
+				Declares: declares[n],
+			})
+		}
+		return true
+	})
+	return idents, nil
+}
+
+// references returns the uses of a symbol, leaving out its declaration. For
+// Type.Method only selectors of Method are reported.
+func (f *fileIdents) references(name string) []symbolReference {
+	name = normalizeSymbolName(name)
+	ident := name
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		ident = name[i+1:]
+	}
+	method := ident != name
+
+	var refs []symbolReference
+	for _, use := range f.uses[ident] {
+		if (method && !use.Selector) || use.Declares == name {
+			continue
+		}
+		refs = append(refs, symbolReference{
+			File:   f.path,
+			Line:   use.Line,
+			Column: use.Column,
+			Text:   strings.TrimSpace(string(f.lines[use.Line-1])),
+		})
+	}
+	return refs
+}
+
+func isTopLevel(file *ast.File, spec *ast.ValueSpec) bool {
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok {
+			for _, s := range gen.Specs {
+				if s == spec {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
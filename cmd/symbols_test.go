@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+const symbolsFixture = `package shapes
+
+// Area values are in square units.
+type Area float64
+
+// Square is a square.
+type Square struct {
+	Side float64
+}
+
+const (
+	// Unit is the default side.
+	Unit = 1.0
+	Zero = 0.0
+)
+
+// Area returns the area of s.
+func (s *Square) Area() Area {
+	return Area(s.Side * s.Side)
+}
+
+func NewSquare() *Square {
+	sq := &Square{Side: Unit}
+	_ = sq.Area()
+	return sq
+}
+`
+
+func TestFindSymbol(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"shapes.go": symbolsFixture})
+
+	testCases := []struct {
+		name   string
+		symbol string
+		want   []string // Kind, lines and source of each match
+	}{
+		{
+			name:   "Test with a type",
+			symbol: "Square",
+			want:   []string{"type 6-9 // Square is a square.\ntype Square struct {\n\tSide float64\n}"},
+		},
+		{
+			name:   "Test with a pointer receiver method",
+			symbol: "(*Square).Area",
+			want:   []string{"method 17-20 // Area returns the area of s.\nfunc (s *Square) Area() Area {\n\treturn Area(s.Side * s.Side)\n}"},
+		},
+		{
+			name:   "Test with a grouped constant",
+			symbol: "Unit",
+			want:   []string{"const 12-13 // Unit is the default side.\n\tUnit = 1.0"},
+		},
+		{
+			name:   "Test with an unknown symbol",
+			symbol: "Circle",
+			want:   nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			found, err := findSymbol(dir, walkOptions{}, tc.symbol)
+			if err != nil {
+				t.Fatalf("findSymbol() error = %v", err)
+			}
+			var got []string
+			for _, symbol := range found {
+				got = append(got, fmt.Sprintf("%s %d-%d %s", symbol.Kind, symbol.Line, symbol.EndLine, symbol.Source))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %q, but got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFindReferences(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"shapes.go": symbolsFixture})
+
+	testCases := []struct {
+		name   string
+		symbol string
+		want   []int // lines
+	}{
+		{name: "Test with a type", symbol: "Square", want: []int{18, 22, 23}},
+		{name: "Test with a method", symbol: "Square.Area", want: []int{24}},
+		{name: "Test with a type named like a method", symbol: "Area", want: []int{18, 18, 19, 24}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			refs, err := findReferences(dir, walkOptions{}, tc.symbol)
+			if err != nil {
+				t.Fatalf("findReferences() error = %v", err)
+			}
+			var got []int
+			for _, ref := range refs {
+				got = append(got, ref.Line)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected lines %v, but got %v", tc.want, got)
+			}
+		})
+	}
+}
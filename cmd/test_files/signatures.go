@@ -0,0 +1,13 @@
+package cmd
+
+type Shape struct{}
+
+func (Shape) Scale(float64) {}
+
+func Split(string, int) (head, tail string, err error) {
+	return "", "", nil
+}
+
+func Bounds(x, y int) (min, max int) {
+	return x, y
+}
@@ -0,0 +1,555 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+var testContextCmd = &cobra.Command{
+	Use:   "test-context [gotest.log | -]",
+	Short: "Turn failing tests from go test -json output into source context as markdown",
+	Long: `Read the output of go test -json, from the file given (by default
+/tmp/gotest.log, where the taskfile's test task writes it) or from stdin, and
+write one markdown document for the failing tests of the module in --dir.
+
+For every failing test it shows the test function, the entry of the test table
+each failing subtest runs, the output of each failure, and the production
+functions of the package that the test calls. Packages that failed without a
+failing test, such as those that did not build, are listed with their output.`,
+	Example: `  task test; gosymex test-context > failures.md
+  go test -json ./... | gosymex test-context -`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runTestContextCmd,
+}
+
+func init() {
+	testContextCmd.Flags().String("dir", ".", "Directory inside the module the tests ran in")
+	rootCmd.AddCommand(testContextCmd)
+}
+
+// defaultTestLog is where the taskfile's test task keeps the go test -json
+// output.
+const defaultTestLog = "/tmp/gotest.log"
+
+// testEvent is one line of go test -json output.
+type testEvent struct {
+	Action      string
+	Package     string
+	Test        string
+	Output      string
+	ImportPath  string // of build-output events
+	FailedBuild string // of package fail events
+}
+
+// testFailure is a failed test or subtest, or a package that failed outside
+// its tests when Test is "".
+type testFailure struct {
+	Package string
+	Test    string
+	Output  string
+}
+
+// testRun holds the failures of a go test -json run.
+type testRun struct {
+	Failures []testFailure
+}
+
+// testFraming matches the lines go test adds around test output.
+var testFraming = regexp.MustCompile(`^\s*(=== (RUN|PAUSE|CONT|NAME)|--- (FAIL|PASS|SKIP):)`)
+
+func runTestContextCmd(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("dir")
+	name := defaultTestLog
+	var in io.Reader = os.Stdin
+	if len(args) > 0 {
+		name = args[0]
+	}
+	if name != "-" {
+		file, err := os.Open(name)
+		if errors.Is(err, os.ErrNotExist) {
+			return withExitCode(exitPathNotFound, fmt.Errorf("reading test output: %w", err))
+		}
+		if err != nil {
+			return fmt.Errorf("reading test output: %w", err)
+		}
+		defer file.Close()
+		in = file
+	}
+
+	run, err := parseTestRun(in)
+	if err != nil {
+		return err
+	}
+	if len(run.Failures) == 0 {
+		fmt.Println("No failing tests")
+		return nil
+	}
+	goModPath, err := findGoMod(dir)
+	if err != nil {
+		return err
+	}
+	module, _, err := readGoModFile(goModPath)
+	if err != nil {
+		return err
+	}
+	source := newTestSource(filepath.Dir(goModPath), module)
+	fmt.Print(source.render(run))
+	return nil
+}
+
+// parseTestRun reads go test -json events and returns the failures in the
+// order they were reported. Lines that are not events, such as those of
+// tools the output was piped through, are skipped.
+func parseTestRun(r io.Reader) (*testRun, error) {
+	type key struct{ pkg, test string }
+	output := make(map[key]*strings.Builder)
+	buildOutput := make(map[string]*strings.Builder)
+	failedTests := make(map[string]bool)
+	var failed []key
+	var failedBuilds []string
+	events := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var event testEvent
+		if err := json.Unmarshal(line, &event); err != nil || event.Action == "" {
+			continue
+		}
+		events++
+		switch event.Action {
+		case "output":
+			k := key{event.Package, event.Test}
+			if output[k] == nil {
+				output[k] = &strings.Builder{}
+			}
+			output[k].WriteString(event.Output)
+		case "build-output":
+			if buildOutput[event.ImportPath] == nil {
+				buildOutput[event.ImportPath] = &strings.Builder{}
+			}
+			buildOutput[event.ImportPath].WriteString(event.Output)
+		case "fail":
+			failed = append(failed, key{event.Package, event.Test})
+			failedBuilds = append(failedBuilds, event.FailedBuild)
+			if event.Test != "" {
+				failedTests[event.Package] = true
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading test output: %w", err)
+	}
+	if events == 0 {
+		return nil, withExitCode(exitParseError, errors.New("no go test -json events found in the input"))
+	}
+
+	run := &testRun{}
+	for i, k := range failed {
+		var text string
+		if b := output[k]; b != nil {
+			text = b.String()
+		}
+		if k.test == "" {
+			// The package fails along with any of its tests.
+			if failedTests[k.pkg] {
+				continue
+			}
+			if b := buildOutput[failedBuilds[i]]; b != nil {
+				text = b.String() + text
+			}
+		} else {
+			text = failureOutput(text)
+		}
+		run.Failures = append(run.Failures, testFailure{Package: k.pkg, Test: k.test, Output: strings.TrimRight(text, "\n")})
+	}
+	return run, nil
+}
+
+// failureOutput drops the lines go test adds around the output of a test.
+func failureOutput(text string) string {
+	var kept []string
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if !testFraming.MatchString(line) {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "")
+}
+
+// subtestName returns the name go test gives a subtest: spaces become
+// underscores and unprintable characters are quoted.
+func subtestName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsSpace(r):
+			b.WriteByte('_')
+		case !strconv.IsPrint(r):
+			quoted := strconv.QuoteRune(r)
+			b.WriteString(quoted[1 : len(quoted)-1])
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// duplicateSuffix is what go test appends to repeated subtest names.
+var duplicateSuffix = regexp.MustCompile(`#\d+$`)
+
+// testDecl is a test function and the file it is in.
+type testDecl struct {
+	Path   string // relative to the module root, with slashes
+	Source symbolSource
+	fn     *ast.FuncDecl
+	file   *ast.File
+	fset   *token.FileSet
+	src    []byte
+}
+
+// testPackage is the source of one package of the module.
+type testPackage struct {
+	ImportPath string
+	Dir        string
+	tests      map[string]*testDecl
+	funcs      map[string]symbolSource // by Name or Type.Method
+	methods    map[string][]string     // Type.Method names by method name
+}
+
+// testSource maps failing tests to the source of one module.
+type testSource struct {
+	root     string
+	module   string
+	packages map[string]*testPackage
+}
+
+func newTestSource(root, module string) *testSource {
+	return &testSource{root: root, module: module, packages: make(map[string]*testPackage)}
+}
+
+// load parses the package with an import path once. It returns nil for
+// packages outside the module.
+func (s *testSource) load(importPath string) *testPackage {
+	if pkg, ok := s.packages[importPath]; ok {
+		return pkg
+	}
+	var pkg *testPackage
+	if rel, ok := strings.CutPrefix(importPath, s.module); ok && (rel == "" || strings.HasPrefix(rel, "/")) {
+		dir := filepath.Join(s.root, filepath.FromSlash(strings.TrimPrefix(rel, "/")))
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			pkg = s.parsePackage(importPath, dir)
+		}
+	}
+	s.packages[importPath] = pkg
+	return pkg
+}
+
+// parsePackage reads the test functions and the production declarations of
+// a package directory. Files that do not parse are left out.
+func (s *testSource) parsePackage(importPath, dir string) *testPackage {
+	pkg := &testPackage{
+		ImportPath: importPath,
+		Dir:        dir,
+		tests:      make(map[string]*testDecl),
+		funcs:      make(map[string]symbolSource),
+		methods:    make(map[string][]string),
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return pkg
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+		filePath := filepath.Join(dir, entry.Name())
+		src, err := os.ReadFile(filePath)
+		if err != nil {
+			continue
+		}
+		rel, _ := filepath.Rel(s.root, filePath)
+		if strings.HasSuffix(entry.Name(), "_test.go") {
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, filePath, src, parser.ParseComments|parser.SkipObjectResolution)
+			if err != nil {
+				continue
+			}
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Body == nil || testKind(fn) == "" {
+					continue
+				}
+				pkg.tests[fn.Name.Name] = &testDecl{
+					Path:   filepath.ToSlash(rel),
+					Source: declSource(fset, src, fn.Name.Name, "func", fn, fn.Doc),
+					fn:     fn,
+					file:   file,
+					fset:   fset,
+					src:    src,
+				}
+			}
+			continue
+		}
+		_ = fileSymbols(filePath, src, func(name, kind string, node ast.Node, doc *ast.CommentGroup, fset *token.FileSet) {
+			if kind != "func" && kind != "method" {
+				return
+			}
+			symbol := declSource(fset, src, name, kind, node, doc)
+			symbol.File = filepath.ToSlash(rel)
+			pkg.funcs[name] = symbol
+			if kind == "method" {
+				method := name[strings.LastIndex(name, ".")+1:]
+				pkg.methods[method] = append(pkg.methods[method], name)
+			}
+		})
+	}
+	return pkg
+}
+
+// caseSource returns the table entry a subtest runs, with the line it
+// starts on, or false when no entry of the test's tables is named like it.
+// Each level of a nested subtest name is tried.
+func (t *testDecl) caseSource(subtest string) (string, int, bool) {
+	cases := tableCases(t.fn.Body)
+	for _, level := range strings.Split(subtest, "/") {
+		bare := duplicateSuffix.ReplaceAllString(level, "")
+		for _, c := range cases {
+			if name := subtestName(c.Name); name != level && name != bare {
+				continue
+			}
+			from, to := t.fset.Position(c.Expr.Pos()), t.fset.Position(c.Expr.End())
+			// Start at the beginning of the line to keep the indentation.
+			start := from.Offset
+			for start > 0 && (t.src[start-1] == '\t' || t.src[start-1] == ' ') {
+				start--
+			}
+			return string(t.src[start:to.Offset]) + ",", from.Line, true
+		}
+	}
+	return "", 0, false
+}
+
+// calledFuncs returns the production functions and methods of the package
+// that a test calls, in the order the calls are found. Methods are matched
+// by name, so every method of that name in the package is included.
+func (pkg *testPackage) calledFuncs(test *testDecl) []symbolSource {
+	// Import names of the package under test, for external test packages.
+	self := make(map[string]bool)
+	imported := make(map[string]bool)
+	for _, spec := range test.file.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		name := path.Base(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imported[name] = true
+		if importPath == pkg.ImportPath {
+			self[name] = true
+		}
+	}
+
+	// Methods called on the *testing.T of the test and its subtests are not
+	// the package's.
+	testingVars := make(map[string]bool)
+	ast.Inspect(test.fn, func(n ast.Node) bool {
+		if field, ok := n.(*ast.Field); ok && strings.HasPrefix(types.ExprString(field.Type), "*testing.") {
+			for _, name := range field.Names {
+				testingVars[name.Name] = true
+			}
+		}
+		return true
+	})
+
+	var called []symbolSource
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if symbol, ok := pkg.funcs[name]; ok && !seen[name] {
+			seen[name] = true
+			called = append(called, symbol)
+		}
+	}
+	ast.Inspect(test.fn.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		fun := call.Fun
+		switch f := fun.(type) {
+		case *ast.IndexExpr:
+			fun = f.X
+		case *ast.IndexListExpr:
+			fun = f.X
+		}
+		switch f := fun.(type) {
+		case *ast.Ident:
+			if symbol, ok := pkg.funcs[f.Name]; ok && symbol.Kind == "func" {
+				add(f.Name)
+			}
+		case *ast.SelectorExpr:
+			if x, ok := f.X.(*ast.Ident); ok && (imported[x.Name] || testingVars[x.Name]) {
+				if self[x.Name] {
+					add(f.Sel.Name)
+				}
+				return true
+			}
+			methods := append([]string(nil), pkg.methods[f.Sel.Name]...)
+			sort.Strings(methods)
+			for _, name := range methods {
+				add(name)
+			}
+		}
+		return true
+	})
+	return called
+}
+
+// failedTest groups the failures of one top-level test.
+type failedTest struct {
+	Package  string
+	Name     string
+	Output   string        // of the test itself
+	Subtests []testFailure // that failed with no failing subtest of their own
+}
+
+// groupFailures groups failed subtests under their top-level test, keeping
+// only the innermost failures, and returns the packages that failed on
+// their own separately.
+func groupFailures(failures []testFailure) ([]*failedTest, []testFailure) {
+	var tests []*failedTest
+	var packages []testFailure
+	byName := make(map[[2]string]*failedTest)
+	for _, failure := range failures {
+		if failure.Test == "" {
+			packages = append(packages, failure)
+			continue
+		}
+		top, _, _ := strings.Cut(failure.Test, "/")
+		test := byName[[2]string{failure.Package, top}]
+		if test == nil {
+			test = &failedTest{Package: failure.Package, Name: top}
+			byName[[2]string{failure.Package, top}] = test
+			tests = append(tests, test)
+		}
+		if failure.Test == top {
+			test.Output = failure.Output
+			continue
+		}
+		inner := false
+		for _, other := range failures {
+			if other.Package == failure.Package && strings.HasPrefix(other.Test, failure.Test+"/") {
+				inner = true
+				break
+			}
+		}
+		if !inner || strings.TrimSpace(failure.Output) != "" {
+			test.Subtests = append(test.Subtests, failure)
+		}
+	}
+	return tests, packages
+}
+
+// render writes the failures of a run as markdown.
+func (s *testSource) render(run *testRun) string {
+	tests, packages := groupFailures(run.Failures)
+	subtests := 0
+	for _, test := range tests {
+		subtests += len(test.Subtests)
+	}
+
+	var b strings.Builder
+	b.WriteString("# Failing tests\n\n")
+	summary := []string{plural(len(tests), "failing test")}
+	if subtests > 0 {
+		summary = append(summary, plural(subtests, "failing subtest"))
+	}
+	if len(packages) > 0 {
+		summary = append(summary, plural(len(packages), "failing package")+" without failing tests")
+	}
+	fmt.Fprintf(&b, "%s in module `%s`.\n", strings.Join(summary, ", "), s.module)
+
+	for _, test := range tests {
+		fmt.Fprintf(&b, "\n## %s (%s)\n", test.Name, test.Package)
+		pkg := s.load(test.Package)
+		var decl *testDecl
+		if pkg != nil {
+			decl = pkg.tests[test.Name]
+		}
+		if decl == nil {
+			fmt.Fprintf(&b, "\nThe source of %s was not found in the module.\n", test.Name)
+		} else {
+			fmt.Fprintf(&b, "\n%s:%d-%d\n\n", decl.Path, decl.Source.Line, decl.Source.EndLine)
+			b.WriteString(codeFence(decl.Source.Source))
+		}
+		if strings.TrimSpace(test.Output) != "" {
+			b.WriteString("\nOutput:\n\n")
+			b.WriteString(outputFence(test.Output))
+		}
+
+		for _, subtest := range test.Subtests {
+			name := strings.TrimPrefix(subtest.Test, test.Name+"/")
+			fmt.Fprintf(&b, "\n### %s\n", name)
+			if decl != nil {
+				if entry, line, ok := decl.caseSource(name); ok {
+					fmt.Fprintf(&b, "\nTable entry at %s:%d:\n\n", decl.Path, line)
+					b.WriteString(codeFence(entry))
+				}
+			}
+			if strings.TrimSpace(subtest.Output) != "" {
+				b.WriteString("\nOutput:\n\n")
+				b.WriteString(outputFence(subtest.Output))
+			}
+		}
+
+		if decl == nil {
+			continue
+		}
+		if called := pkg.calledFuncs(decl); len(called) > 0 {
+			b.WriteString("\n### Functions under test\n")
+			for _, symbol := range called {
+				fmt.Fprintf(&b, "\n#### %s (%s:%d-%d)\n\n", symbol.Name, symbol.File, symbol.Line, symbol.EndLine)
+				b.WriteString(codeFence(symbol.Source))
+			}
+		}
+	}
+
+	for _, pkg := range packages {
+		fmt.Fprintf(&b, "\n## Package %s\n\nThe package failed without a failing test.\n", pkg.Package)
+		if strings.TrimSpace(pkg.Output) != "" {
+			b.WriteString("\nOutput:\n\n")
+			b.WriteString(outputFence(pkg.Output))
+		}
+	}
+	return b.String()
+}
+
+// outputFence wraps test output in a fence longer than any backtick run in
+// it.
+func outputFence(text string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence + "\n" + strings.TrimRight(text, "\n") + "\n" + fence + "\n"
+}
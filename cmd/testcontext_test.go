@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testLog is go test -json output piped through gotestfmt, which adds lines
+// of its own.
+const testLog = `{"Action":"start","Package":"example.com/shapes"}
+{"Action":"run","Package":"example.com/shapes","Test":"TestSquare"}
+{"Action":"output","Package":"example.com/shapes","Test":"TestSquare","Output":"=== RUN   TestSquare\n"}
+{"Action":"run","Package":"example.com/shapes","Test":"TestSquare/Test_with_a_unit_side"}
+{"Action":"output","Package":"example.com/shapes","Test":"TestSquare/Test_with_a_unit_side","Output":"=== RUN   TestSquare/Test_with_a_unit_side\n"}
+{"Action":"output","Package":"example.com/shapes","Test":"TestSquare/Test_with_a_unit_side","Output":"    shapes_test.go:20: Expected 1, but got 2\n"}
+{"Action":"output","Package":"example.com/shapes","Test":"TestSquare/Test_with_a_unit_side","Output":"--- FAIL: TestSquare/Test_with_a_unit_side (0.00s)\n"}
+{"Action":"fail","Package":"example.com/shapes","Test":"TestSquare/Test_with_a_unit_side"}
+{"Action":"pass","Package":"example.com/shapes","Test":"TestSquare/Test_with_side_two"}
+{"Action":"output","Package":"example.com/shapes","Test":"TestSquare","Output":"--- FAIL: TestSquare (0.00s)\n"}
+{"Action":"fail","Package":"example.com/shapes","Test":"TestSquare"}
+{"Action":"output","Package":"example.com/shapes","Output":"FAIL\n"}
+{"Action":"fail","Package":"example.com/shapes"}
+📦 example.com/shapes
+{"ImportPath":"example.com/shapes/broken [example.com/shapes/broken.test]","Action":"build-output","Output":"# example.com/shapes/broken\n"}
+{"ImportPath":"example.com/shapes/broken [example.com/shapes/broken.test]","Action":"build-output","Output":"broken/broken.go:2:12: undefined: y\n"}
+{"Action":"output","Package":"example.com/shapes/broken","Output":"FAIL\texample.com/shapes/broken [build failed]\n"}
+{"Action":"fail","Package":"example.com/shapes/broken","FailedBuild":"example.com/shapes/broken [example.com/shapes/broken.test]"}
+`
+
+const shapesTestFixture = `package shapes
+
+import "testing"
+
+func TestSquare(t *testing.T) {
+	testCases := []struct {
+		name string
+		side float64
+		want Area
+	}{
+		{
+			name: "Test with a unit side",
+			side: 1,
+			want: 1,
+		},
+		{name: "Test with side two", side: 2, want: 4},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sq := NewSquare()
+			sq.Side = tc.side
+			if got := sq.Area(); got != tc.want {
+				t.Errorf("Expected %v, but got %v", tc.want, got)
+			}
+		})
+	}
+}
+`
+
+func TestParseTestRun(t *testing.T) {
+	run, err := parseTestRun(strings.NewReader(testLog))
+	if err != nil {
+		t.Fatalf("parseTestRun() error = %v", err)
+	}
+	want := []testFailure{
+		{Package: "example.com/shapes", Test: "TestSquare/Test_with_a_unit_side", Output: "    shapes_test.go:20: Expected 1, but got 2"},
+		{Package: "example.com/shapes", Test: "TestSquare"},
+		{Package: "example.com/shapes/broken", Output: "# example.com/shapes/broken\nbroken/broken.go:2:12: undefined: y\nFAIL\texample.com/shapes/broken [build failed]"},
+	}
+	if !reflect.DeepEqual(run.Failures, want) {
+		t.Errorf("Expected %+v, but got %+v", want, run.Failures)
+	}
+
+	if _, err := parseTestRun(strings.NewReader("ok  \texample.com/shapes\n")); exitCode(err) != exitParseError {
+		t.Errorf("Expected a parse error without events, but got %v", err)
+	}
+}
+
+func TestSubtestName(t *testing.T) {
+	testCases := map[string]string{
+		"Test with a glob": "Test_with_a_glob",
+		"tab\there":        "tab_here",
+		"bell\a":           `bell\a`,
+		"(*Square).Area":   "(*Square).Area",
+	}
+	for name, want := range testCases {
+		if got := subtestName(name); got != want {
+			t.Errorf("subtestName(%q): expected %s, but got %s", name, want, got)
+		}
+	}
+}
+
+func TestTestContextRender(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":           "module example.com/shapes\n\ngo 1.21\n",
+		"shapes.go":        symbolsFixture,
+		"shapes_test.go":   shapesTestFixture,
+		"broken/broken.go": "package broken\n\nfunc X() { y }\n",
+	})
+	run, err := parseTestRun(strings.NewReader(testLog))
+	if err != nil {
+		t.Fatalf("parseTestRun() error = %v", err)
+	}
+
+	doc := newTestSource(dir, "example.com/shapes").render(run)
+	for _, want := range []string{
+		"# Failing tests\n\n1 failing test, 1 failing subtest, 1 failing package without failing tests in module `example.com/shapes`.\n",
+		"## TestSquare (example.com/shapes)\n\nshapes_test.go:5-27\n\n```go\nfunc TestSquare(t *testing.T) {\n",
+		"### Test_with_a_unit_side\n\nTable entry at shapes_test.go:11:\n\n```go\n\t\t{\n\t\t\tname: \"Test with a unit side\",\n\t\t\tside: 1,\n\t\t\twant: 1,\n\t\t},\n```\n",
+		"\nOutput:\n\n```\n    shapes_test.go:20: Expected 1, but got 2\n```\n",
+		"### Functions under test\n\n#### NewSquare (shapes.go:22-26)\n\n```go\nfunc NewSquare() *Square {\n",
+		"#### Square.Area (shapes.go:17-20)\n\n```go\n// Area returns the area of s.\n",
+		"## Package example.com/shapes/broken\n\nThe package failed without a failing test.\n",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("Expected the document to contain %q:\n%s", want, doc)
+		}
+	}
+	if strings.Contains(doc, "Errorf (") || strings.Contains(doc, "=== RUN") {
+		t.Errorf("Expected no testing methods or framing lines:\n%s", doc)
+	}
+}
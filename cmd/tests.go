@@ -0,0 +1,428 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+var testsCmd = &cobra.Command{
+	Use:   "tests [path]",
+	Short: "Inventory the tests, benchmarks, examples and fuzz targets of each package",
+	Long: `List the Test, Benchmark, Example and Fuzz functions of every package,
+with the case names of table-driven tests, t.Run subtests, example output and
+a guess at the production function each one exercises.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runTestsCmd,
+}
+
+func init() {
+	// Test files are always walked, so --include-tests has no say.
+	addTreeWalkFlags(testsCmd)
+	rootCmd.AddCommand(testsCmd)
+}
+
+// packageTests is the test inventory of one package directory.
+type packageTests struct {
+	Package    string
+	Tests      []testFunc
+	Benchmarks []testFunc
+	Examples   []testFunc
+	Fuzz       []testFunc
+	Errors     []errorRecord `json:",omitempty"` // files that could not be parsed
+}
+
+// testFunc describes one test, benchmark, example or fuzz target.
+type testFunc struct {
+	Name      string
+	File      string
+	Line      int
+	Cases     []string `json:",omitempty"` // names from table-driven test tables
+	Subtests  []string `json:",omitempty"` // literal t.Run names
+	Output    *string  `json:",omitempty"` // expected output of an example
+	Unordered bool     `json:",omitempty"` // example output may be in any order
+	Target    string   `json:",omitempty"` // guessed production function under test
+}
+
+// tableCase is one entry of a table-driven test.
+type tableCase struct {
+	Name string
+	Expr ast.Expr
+}
+
+// testKinds maps the function name prefixes recognised by go test to the
+// parameter type each kind takes. Examples take none.
+var testKinds = []struct {
+	prefix string
+	param  string
+}{
+	{"Test", "*testing.T"},
+	{"Benchmark", "*testing.B"},
+	{"Fuzz", "*testing.F"},
+	{"Example", ""},
+}
+
+// testKind returns the kind prefix of a test function, or "" if go test
+// would not run it.
+func testKind(fn *ast.FuncDecl) string {
+	if fn.Recv != nil {
+		return ""
+	}
+	for _, kind := range testKinds {
+		if !isTestName(fn.Name.Name, kind.prefix) {
+			continue
+		}
+		params := fn.Type.Params.List
+		if kind.param == "" {
+			if len(params) == 0 && fn.Type.Results == nil {
+				return kind.prefix
+			}
+			return ""
+		}
+		if len(params) == 1 && len(params[0].Names) <= 1 && types.ExprString(params[0].Type) == kind.param {
+			return kind.prefix
+		}
+		return ""
+	}
+	return ""
+}
+
+// isTestName follows go test: the prefix must not be followed by a
+// lower-case letter, so TestMain and Test_x count but Testify does not.
+func isTestName(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	if len(name) == len(prefix) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(name[len(prefix):])
+	return !unicode.IsLower(r)
+}
+
+// inventoryTests walks root and returns the test inventory of every package
+// that has test functions or files that failed to parse, sorted by package.
+// A file that fails does not stop the walk; the returned error tells whether
+// some or all files failed.
+func inventoryTests(root string, opts walkOptions) ([]*packageTests, error) {
+	opts.IncludeTests = true
+
+	type packageFiles struct {
+		tests      []string
+		production map[string]bool
+		errors     []errorRecord
+	}
+	packages := make(map[string]*packageFiles)
+
+	fset := token.NewFileSet()
+	parsed := make(map[string]*ast.File)
+	var failures fileFailures
+	err := walkGoFiles(root, opts, func(filePath string, info os.FileInfo) error {
+		dir := filepath.Dir(filePath)
+		pkg := packages[dir]
+		if pkg == nil {
+			pkg = &packageFiles{production: make(map[string]bool)}
+			packages[dir] = pkg
+		}
+
+		node, err := parser.ParseFile(fset, filePath, nil, parser.ParseComments|parser.SkipObjectResolution)
+		failures.add(err)
+		if err != nil {
+			reportFileError(filePath, err)
+			pkg.errors = append(pkg.errors, errorRecord{File: filePath, Error: err.Error(), Code: exitCode(err)})
+			return nil
+		}
+		if strings.HasSuffix(filePath, "_test.go") {
+			pkg.tests = append(pkg.tests, filePath)
+			parsed[filePath] = node
+			return nil
+		}
+		for _, name := range declaredFuncs(node) {
+			pkg.production[name] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking the directory: %w", err)
+	}
+
+	var inventory []*packageTests
+	for dir, files := range packages {
+		if len(files.tests) == 0 && len(files.errors) == 0 {
+			continue
+		}
+		pkg := &packageTests{Package: dir, Errors: files.errors}
+		for _, filePath := range files.tests {
+			addFileTests(pkg, fset, filePath, parsed[filePath], files.production)
+		}
+		if len(pkg.Tests)+len(pkg.Benchmarks)+len(pkg.Examples)+len(pkg.Fuzz)+len(pkg.Errors) > 0 {
+			inventory = append(inventory, pkg)
+		}
+	}
+	sort.Slice(inventory, func(i, j int) bool { return inventory[i].Package < inventory[j].Package })
+	return inventory, failures.err()
+}
+
+// declaredFuncs returns the functions of a file as F or T.M names.
+func declaredFuncs(node *ast.File) []string {
+	var names []string
+	for _, decl := range node.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if fn.Recv != nil {
+			names = append(names, receiverTypeName(fn.Recv.List[0].Type)+"."+fn.Name.Name)
+		} else {
+			names = append(names, fn.Name.Name)
+		}
+	}
+	return names
+}
+
+// addFileTests adds the test functions of one test file to the inventory.
+func addFileTests(pkg *packageTests, fset *token.FileSet, filePath string, node *ast.File, production map[string]bool) {
+	for _, decl := range node.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		kind := testKind(fn)
+		if kind == "" {
+			continue
+		}
+
+		test := testFunc{
+			Name:     fn.Name.Name,
+			File:     filePath,
+			Line:     fset.Position(fn.Pos()).Line,
+			Subtests: subtestNames(fn.Body),
+			Target:   guessTarget(fn, kind, production),
+		}
+		for _, c := range tableCases(fn.Body) {
+			test.Cases = append(test.Cases, c.Name)
+		}
+
+		switch kind {
+		case "Test":
+			pkg.Tests = append(pkg.Tests, test)
+		case "Benchmark":
+			pkg.Benchmarks = append(pkg.Benchmarks, test)
+		case "Fuzz":
+			pkg.Fuzz = append(pkg.Fuzz, test)
+		case "Example":
+			test.Output, test.Unordered = exampleOutput(node, fn)
+			pkg.Examples = append(pkg.Examples, test)
+		}
+	}
+}
+
+// exampleOutput returns the text of the "// Output:" or "// Unordered
+// output:" comment that ends an example, as go test reads it.
+func exampleOutput(node *ast.File, fn *ast.FuncDecl) (*string, bool) {
+	var last *ast.CommentGroup
+	for _, group := range node.Comments {
+		if group.Pos() > fn.Body.Lbrace && group.End() < fn.Body.Rbrace {
+			last = group
+		}
+	}
+	if last == nil {
+		return nil, false
+	}
+
+	text := last.Text()
+	for _, marker := range []struct {
+		prefix    string
+		unordered bool
+	}{
+		{"unordered output:", true},
+		{"output:", false},
+	} {
+		if len(text) >= len(marker.prefix) && strings.EqualFold(text[:len(marker.prefix)], marker.prefix) {
+			output := strings.TrimSpace(text[len(marker.prefix):])
+			return &output, marker.unordered
+		}
+	}
+	return nil, false
+}
+
+// subtestNames returns the literal names passed to t.Run or b.Run.
+func subtestNames(body *ast.BlockStmt) []string {
+	var names []string
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 2 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "Run" {
+			return true
+		}
+		if name, ok := stringLiteral(call.Args[0]); ok {
+			names = append(names, name)
+		}
+		return true
+	})
+	return names
+}
+
+// caseNameFields are the struct fields that conventionally name a table case.
+var caseNameFields = map[string]bool{"name": true, "Name": true, "desc": true, "description": true, "title": true}
+
+// tableCases returns the entries of table-driven test tables in body: slice
+// literals of anonymous structs with a name field, such as
+// "tests := []struct{name string ...}{...}", and map literals keyed by name.
+func tableCases(body *ast.BlockStmt) []tableCase {
+	var cases []tableCase
+	ast.Inspect(body, func(n ast.Node) bool {
+		lit, ok := n.(*ast.CompositeLit)
+		if !ok {
+			return true
+		}
+		switch t := lit.Type.(type) {
+		case *ast.ArrayType:
+			structType, ok := t.Elt.(*ast.StructType)
+			if !ok {
+				return true
+			}
+			first := firstFieldName(structType)
+			for _, elt := range lit.Elts {
+				if name, ok := caseName(elt, first); ok {
+					cases = append(cases, tableCase{Name: name, Expr: elt})
+				}
+			}
+			return false
+		case *ast.MapType:
+			if _, ok := t.Value.(*ast.StructType); !ok {
+				return true
+			}
+			for _, elt := range lit.Elts {
+				kv, ok := elt.(*ast.KeyValueExpr)
+				if !ok {
+					continue
+				}
+				if name, ok := stringLiteral(kv.Key); ok {
+					cases = append(cases, tableCase{Name: name, Expr: kv})
+				}
+			}
+			return false
+		}
+		return true
+	})
+	return cases
+}
+
+// firstFieldName returns the name of the first struct field if it is one of
+// caseNameFields, for tables written with positional elements.
+func firstFieldName(structType *ast.StructType) string {
+	if len(structType.Fields.List) == 0 || len(structType.Fields.List[0].Names) == 0 {
+		return ""
+	}
+	if name := structType.Fields.List[0].Names[0].Name; caseNameFields[name] {
+		return name
+	}
+	return ""
+}
+
+// caseName reads the name of one table element.
+func caseName(elt ast.Expr, positionalName string) (string, bool) {
+	lit, ok := elt.(*ast.CompositeLit)
+	if !ok || len(lit.Elts) == 0 {
+		return "", false
+	}
+	for _, field := range lit.Elts {
+		kv, ok := field.(*ast.KeyValueExpr)
+		if !ok {
+			break
+		}
+		if key, ok := kv.Key.(*ast.Ident); ok && caseNameFields[key.Name] {
+			return stringLiteral(kv.Value)
+		}
+	}
+	if _, keyed := lit.Elts[0].(*ast.KeyValueExpr); !keyed && positionalName != "" {
+		return stringLiteral(lit.Elts[0])
+	}
+	return "", false
+}
+
+func stringLiteral(expr ast.Expr) (string, bool) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	value, err := strconv.Unquote(lit.Value)
+	return value, err == nil
+}
+
+// guessTarget guesses the production function a test exercises, first from
+// its name (TestFoo, Test_foo, TestType_Method, TestFoo_edgeCase) and then
+// from the package function it calls most.
+func guessTarget(fn *ast.FuncDecl, kind string, production map[string]bool) string {
+	rest := strings.TrimPrefix(strings.TrimPrefix(fn.Name.Name, kind), "_")
+	var candidates []string
+	if rest != "" {
+		candidates = append(candidates, rest, lowerFirst(rest))
+		if typ, method, ok := strings.Cut(rest, "_"); ok {
+			candidates = append(candidates, typ+"."+method, lowerFirst(typ)+"."+method, typ, lowerFirst(typ))
+		}
+	}
+	for _, candidate := range candidates {
+		if production[candidate] {
+			return candidate
+		}
+	}
+
+	calls := make(map[string]int)
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if ident, ok := call.Fun.(*ast.Ident); ok && production[ident.Name] {
+			calls[ident.Name]++
+		}
+		return true
+	})
+	best := ""
+	for name, count := range calls {
+		if count > calls[best] || (count == calls[best] && name < best) {
+			best = name
+		}
+	}
+	return best
+}
+
+func lowerFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[size:]
+}
+
+func runTestsCmd(cmd *cobra.Command, args []string) error {
+	path := "."
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	// Files that fail to parse are listed with their package and do not
+	// stop the inventory; only a failed walk leaves nothing to print.
+	inventory, err := inventoryTests(path, walkOptionsFromFlags(cmd))
+	if err != nil && inventory == nil {
+		return fmt.Errorf("inventorying tests: %w", err)
+	}
+
+	jsonInventory, _ := json.MarshalIndent(inventory, "", "  ")
+	fmt.Println(string(jsonInventory))
+	return err
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInventoryTests(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"calc.go": `package calc
+
+type Calculator struct{}
+
+func (c *Calculator) Add(a, b int) int { return a + b }
+func parse(s string) int { return 0 }
+func Sum(xs ...int) int { return 0 }
+`,
+		"calc_test.go": `package calc
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCalculator_Add(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b int
+		want int
+	}{
+		{name: "zero", want: 0},
+		{name: "positive", a: 1, b: 2, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {})
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := map[string]struct{ in string }{
+		"empty": {in: ""},
+	}
+	_ = cases
+	t.Run("literal subtest", func(t *testing.T) {})
+}
+
+func TestHelpers(t *testing.T) {
+	Sum(1)
+	Sum(2)
+	parse("")
+}
+
+func Testify(t *testing.T) {}
+
+func BenchmarkSum(b *testing.B) {}
+
+func FuzzParse(f *testing.F) {}
+
+func ExampleSum() {
+	fmt.Println(Sum(1, 2))
+	// Output: 3
+}
+
+func ExampleCalculator_Add() {
+	// Unordered output:
+	// a
+	// b
+}
+
+func Example_noOutput() {}
+`,
+	})
+
+	inventory, err := inventoryTests(dir, walkOptions{})
+	if err != nil {
+		t.Fatalf("inventoryTests() error = %v", err)
+	}
+	if len(inventory) != 1 {
+		t.Fatalf("inventoryTests() returned %d packages, want 1", len(inventory))
+	}
+	pkg := inventory[0]
+
+	output, unordered := "3", "a\nb"
+	testFile := filepath.Join(dir, "calc_test.go")
+	want := &packageTests{
+		Package: dir,
+		Tests: []testFunc{
+			{Name: "TestCalculator_Add", File: testFile, Line: 8, Cases: []string{"zero", "positive"}, Target: "Calculator.Add"},
+			{Name: "TestParse", File: testFile, Line: 22, Cases: []string{"empty"}, Subtests: []string{"literal subtest"}, Target: "parse"},
+			{Name: "TestHelpers", File: testFile, Line: 30, Target: "Sum"},
+		},
+		Benchmarks: []testFunc{
+			{Name: "BenchmarkSum", File: testFile, Line: 38, Target: "Sum"},
+		},
+		Examples: []testFunc{
+			{Name: "ExampleSum", File: testFile, Line: 42, Output: &output, Target: "Sum"},
+			{Name: "ExampleCalculator_Add", File: testFile, Line: 47, Output: &unordered, Unordered: true, Target: "Calculator.Add"},
+			{Name: "Example_noOutput", File: testFile, Line: 53},
+		},
+		Fuzz: []testFunc{
+			{Name: "FuzzParse", File: testFile, Line: 40, Target: "parse"},
+		},
+	}
+	if !reflect.DeepEqual(pkg, want) {
+		t.Errorf("inventoryTests() = %+v, want %+v", pkg, want)
+	}
+
+	// A file that does not parse is listed with its package, and the other
+	// packages are still inventoried.
+	writeTree(t, dir, map[string]string{"store/broken_test.go": "package store\n\nfunc TestBroken(t *testing.T) {\n"})
+	inventory, err = inventoryTests(dir, walkOptions{})
+	if exitCode(err) != exitPartial {
+		t.Errorf("Expected a partial failure, but got %v", err)
+	}
+	if len(inventory) != 2 || !reflect.DeepEqual(inventory[0], want) {
+		t.Fatalf("Expected the package inventory and the broken package, but got %+v", inventory)
+	}
+	broken := inventory[1]
+	if broken.Package != filepath.Join(dir, "store") || len(broken.Errors) != 1 || broken.Errors[0].File != filepath.Join(dir, "store", "broken_test.go") || broken.Errors[0].Code != exitParseError {
+		t.Errorf("Expected the broken file with a parse error, but got %+v", broken)
+	}
+}
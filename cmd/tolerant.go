@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"go/ast"
+	"go/scanner"
+	"go/token"
+)
+
+// SyntaxError is a syntax error reported by a tolerant parse.
+type SyntaxError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+// markIncomplete records the syntax errors of a file and the symbols whose
+// declarations they damaged.
+func markIncomplete(fset *token.FileSet, node *ast.File, errs scanner.ErrorList, details *FileDetails) {
+	// Recovery cascades into repeated errors at the same spot; keep the
+	// first per line.
+	errs.RemoveMultiples()
+	for _, e := range errs {
+		details.SyntaxErrors = append(details.SyntaxErrors, SyntaxError{Line: e.Pos.Line, Column: e.Pos.Column, Msg: e.Msg})
+	}
+
+	for _, decl := range node.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if damaged(fset, d, errs) {
+				details.Incomplete = append(details.Incomplete, funcKey(parseFuncSignature(d).String()))
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if s, ok := spec.(*ast.TypeSpec); ok && damaged(fset, s, errs) {
+					details.Incomplete = append(details.Incomplete, s.Name.Name)
+				}
+			}
+		}
+	}
+}
+
+// damaged reports whether a declaration was only partially recovered: an
+// error lies within it, it has no valid end, the parser replaced part of it
+// with a placeholder node, or a brace it opened was never closed.
+func damaged(fset *token.FileSet, n ast.Node, errs scanner.ErrorList) bool {
+	if !n.End().IsValid() {
+		return true
+	}
+	// Positions are compared as token.Pos: a declaration left open at the
+	// end of the file ends past it, where an offset cannot be had.
+	file := fset.File(n.Pos())
+	for _, e := range errs {
+		if file == nil || e.Pos.Offset > file.Size() {
+			continue
+		}
+		if pos := file.Pos(e.Pos.Offset); pos >= n.Pos() && pos <= n.End() {
+			return true
+		}
+	}
+
+	bad := false
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BadExpr, *ast.BadStmt, *ast.BadDecl:
+			bad = true
+		case *ast.BlockStmt:
+			bad = !n.Rbrace.IsValid()
+		case *ast.FieldList:
+			bad = n.Opening.IsValid() && !n.Closing.IsValid()
+		}
+		return !bad
+	})
+	return bad
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExtractSourceTolerant(t *testing.T) {
+	testCases := []struct {
+		name           string
+		src            string
+		wantErr        bool
+		wantFuncs      []string
+		wantStructs    []string
+		wantErrorLines []int
+		wantIncomplete []string
+	}{
+		{
+			name:      "Test with a valid file",
+			src:       "package a\n\nfunc A() {}\n",
+			wantFuncs: []string{"A()"},
+		},
+		{
+			name: "Test with a broken method body",
+			src: `package a
+
+type T struct {
+	A int
+}
+
+func Good() int { return 1 }
+
+func (t *T) Broken(x int) {
+	if x > {
+	}
+}
+`,
+			wantFuncs:      []string{"Good() returns (int)", "(*T).Broken(x int)"},
+			wantStructs:    []string{"T"},
+			wantErrorLines: []int{10, 12},
+			wantIncomplete: []string{"(*T).Broken"},
+		},
+		{
+			name: "Test with a broken struct",
+			src: `package a
+
+type S struct {
+	A int
+	B map[string]
+}
+
+func After() {}
+`,
+			wantFuncs:      []string{"After()"},
+			wantStructs:    []string{"S"},
+			wantErrorLines: []int{5},
+			wantIncomplete: []string{"S"},
+		},
+		{
+			name:           "Test with a body left open at the end of the file",
+			src:            "package gt\n\nfunc X() {\n\ty := 1\n",
+			wantFuncs:      []string{"X()"},
+			wantErrorLines: []int{4},
+			wantIncomplete: []string{"X"},
+		},
+		{
+			name:           "Test with an unclosed parameter list",
+			src:            "package gt\n\nfunc X( {",
+			wantFuncs:      []string{"X()"},
+			wantErrorLines: []int{3},
+			wantIncomplete: []string{"X"},
+		},
+		{
+			name:    "Test with a missing package clause",
+			src:     "func A() {}\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			details, err := extractSource("a.go", tc.src, describeOptions{Tolerant: true})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("extractSource() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(details.Funcs, tc.wantFuncs) {
+				t.Errorf("Funcs = %v, want %v", details.Funcs, tc.wantFuncs)
+			}
+			for _, name := range tc.wantStructs {
+				if _, ok := details.Structs[name]; !ok {
+					t.Errorf("Expected struct %s in %v", name, details.Structs)
+				}
+			}
+			var lines []int
+			for _, e := range details.SyntaxErrors {
+				lines = append(lines, e.Line)
+			}
+			if !reflect.DeepEqual(lines, tc.wantErrorLines) {
+				t.Errorf("SyntaxErrors lines = %v, want %v", lines, tc.wantErrorLines)
+			}
+			if !reflect.DeepEqual(details.Incomplete, tc.wantIncomplete) {
+				t.Errorf("Incomplete = %v, want %v", details.Incomplete, tc.wantIncomplete)
+			}
+		})
+	}
+}
+
+func TestExtractFileTolerantSkipsCache(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.go")
+	if err := os.WriteFile(source, []byte("package p\n\nfunc A() {\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write source: %v", err)
+	}
+
+	cache, err := newExtractCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatalf("newExtractCache() error = %v", err)
+	}
+	describeCache = cache
+	defer func() { describeCache = nil }()
+
+	if _, err := extractFile(source, describeOptions{Tolerant: true}); err != nil {
+		t.Fatalf("extractFile() tolerant error = %v", err)
+	}
+	if _, err := extractFile(source, describeOptions{}); err == nil {
+		t.Errorf("Expected strict extractFile() to fail after a tolerant run")
+	}
+	stats, err := cache.stats()
+	if err != nil {
+		t.Fatalf("stats() error = %v", err)
+	}
+	if stats.Entries != 0 {
+		t.Errorf("Entries = %d, want 0", stats.Entries)
+	}
+}
@@ -0,0 +1,555 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var traceCmd = &cobra.Command{
+	Use:   "trace [dump.txt | -]",
+	Short: "Map a panic or goroutine dump to the module's source as markdown",
+	Long: `Read a Go panic or goroutine dump, from the file given or from stdin, and map
+every frame back to the source of the module in --dir. Frames in the module
+show the declaration they are in, with the line of the frame marked; runs of
+frames in the standard library and other modules are collapsed to one line.
+Goroutines with identical stacks are shown once, and those without frames in
+the module are only counted. A summary of the types in the signatures of the
+module's frames follows.
+
+Frames are matched to files by their path, by their package path within the
+module, or by the longest suffix of their path found in the module, so dumps
+from binaries built elsewhere or with -trimpath work too.`,
+	Example: `  kubectl logs api-7d9f | gosymex trace
+  gosymex trace --dir ~/src/api crash.log`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runTraceCmd,
+}
+
+func init() {
+	traceCmd.Flags().String("dir", ".", "Directory inside the module the dump came from")
+	rootCmd.AddCommand(traceCmd)
+}
+
+// traceFrame is one frame of a goroutine's stack.
+type traceFrame struct {
+	Func    string // as printed, such as example.com/app/store.(*Cache).Get
+	File    string // as printed, which is the path at build time
+	Line    int
+	Created bool // the go statement that started the goroutine
+}
+
+// goroutineTrace is a stack shared by one or more goroutines.
+type goroutineTrace struct {
+	IDs    []int
+	State  string
+	Frames []traceFrame
+}
+
+// goroutineDump is a parsed panic or goroutine dump.
+type goroutineDump struct {
+	Header     string // the panic message and anything else before the first goroutine
+	Goroutines []*goroutineTrace
+}
+
+var (
+	goroutineHeader = regexp.MustCompile(`^goroutine (\d+)(?: [^\[]*)?\[(.*)\]:$`)
+	frameLocation   = regexp.MustCompile(`^\s+(.+):(\d+)(?: .*)?$`)
+)
+
+// Of declarations longer than traceMaxLines, only traceWindow lines either
+// side of the marked line are shown.
+const (
+	traceMaxLines = 60
+	traceWindow   = 15
+)
+
+func runTraceCmd(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("dir")
+	var in io.Reader = os.Stdin
+	if len(args) > 0 && args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("reading dump: %w", err)
+		}
+		defer file.Close()
+		in = file
+	}
+
+	dump, err := parseGoroutineDump(in)
+	if err != nil {
+		return err
+	}
+	goModPath, err := findGoMod(dir)
+	if err != nil {
+		return err
+	}
+	module, _, err := readGoModFile(goModPath)
+	if err != nil {
+		return err
+	}
+	source := newTraceSource(filepath.Dir(goModPath), module)
+	fmt.Print(source.render(dump))
+	return nil
+}
+
+// parseGoroutineDump reads the goroutines of a dump. Goroutines with the same
+// frames are merged.
+func parseGoroutineDump(r io.Reader) (*goroutineDump, error) {
+	dump := &goroutineDump{}
+	var header []string
+	var current *goroutineTrace
+	var pending *traceFrame
+	byStack := make(map[string]*goroutineTrace)
+	finish := func() {
+		if current == nil {
+			return
+		}
+		var key strings.Builder
+		for _, frame := range current.Frames {
+			fmt.Fprintf(&key, "%s %s:%d\n", frame.Func, frame.File, frame.Line)
+		}
+		if same, ok := byStack[key.String()]; ok {
+			same.IDs = append(same.IDs, current.IDs...)
+		} else {
+			byStack[key.String()] = current
+			dump.Goroutines = append(dump.Goroutines, current)
+		}
+		current = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if m := goroutineHeader.FindStringSubmatch(line); m != nil {
+			finish()
+			id, _ := strconv.Atoi(m[1])
+			current = &goroutineTrace{IDs: []int{id}, State: m[2]}
+			pending = nil
+			continue
+		}
+		if current == nil {
+			header = append(header, line)
+			continue
+		}
+		switch m := frameLocation.FindStringSubmatch(line); {
+		case strings.TrimSpace(line) == "":
+			finish()
+		case m != nil && pending != nil:
+			pending.File = m[1]
+			pending.Line, _ = strconv.Atoi(m[2])
+			current.Frames = append(current.Frames, *pending)
+			pending = nil
+		case !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t"):
+			pending = parseFrameFunc(line)
+		}
+	}
+	finish()
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading dump: %w", err)
+	}
+	if len(dump.Goroutines) == 0 {
+		return nil, withExitCode(exitParseError, errors.New("no goroutines found in the input"))
+	}
+	dump.Header = strings.TrimSpace(strings.Join(header, "\n"))
+	return dump, nil
+}
+
+// parseFrameFunc parses the function line of a frame, dropping its
+// arguments. It returns nil for lines that are not frames.
+func parseFrameFunc(line string) *traceFrame {
+	if rest, ok := strings.CutPrefix(line, "created by "); ok {
+		if i := strings.Index(rest, " in goroutine "); i >= 0 {
+			rest = rest[:i]
+		}
+		return &traceFrame{Func: rest, Created: true}
+	}
+	if !strings.HasSuffix(line, ")") {
+		return nil
+	}
+	i := strings.LastIndex(line, "(")
+	if i <= 0 {
+		return nil
+	}
+	return &traceFrame{Func: line[:i]}
+}
+
+// framePackage splits a frame function into its package path and the rest,
+// such as (*Cache).Get.func1.
+func framePackage(fn string) (string, string) {
+	slash := strings.LastIndex(fn, "/")
+	dot := strings.Index(fn[slash+1:], ".")
+	if dot < 0 {
+		return fn, ""
+	}
+	return fn[:slash+1+dot], fn[slash+2+dot:]
+}
+
+// closureSuffix matches the parts frame names add for function literals and
+// deferred or go calls, such as func1 or 2.
+var closureSuffix = regexp.MustCompile(`^(func|deferwrap|gowrap)?\d+$`)
+
+// frameDeclName returns the Name or Type.Method form of the declaration a
+// frame function is in: (*Cache[...]).Get.func1 becomes Cache.Get.
+func frameDeclName(fn string) string {
+	_, name := framePackage(fn)
+	for {
+		open := strings.Index(name, "[")
+		end := strings.Index(name, "]")
+		if open < 0 || end < open {
+			break
+		}
+		name = name[:open] + name[end+1:]
+	}
+	parts := strings.Split(strings.NewReplacer("(", "", ")", "", "*", "").Replace(name), ".")
+	if len(parts) > 1 && !closureSuffix.MatchString(parts[1]) {
+		return parts[0] + "." + parts[1]
+	}
+	return parts[0]
+}
+
+// tracedFile is a parsed local source file.
+type tracedFile struct {
+	Path    string // relative to the module root, with slashes
+	symbols []symbolSource
+	nodes   []ast.Node
+}
+
+// traceSource maps frames to the source of one module.
+type traceSource struct {
+	root   string
+	module string
+	files  map[string]*tracedFile
+}
+
+func newTraceSource(root, module string) *traceSource {
+	return &traceSource{root: root, module: module, files: make(map[string]*tracedFile)}
+}
+
+// locate returns the local file a frame ran in, or "" when it is not part
+// of the module.
+func (s *traceSource) locate(frame traceFrame) string {
+	pkg, _ := framePackage(frame.Func)
+	inModule := pkg == s.module || strings.HasPrefix(pkg, s.module+"/")
+	if !inModule && pkg != "main" {
+		return ""
+	}
+
+	var candidates []string
+	if filepath.IsAbs(frame.File) {
+		candidates = append(candidates, frame.File)
+	}
+	slashed := filepath.ToSlash(frame.File)
+	if inModule {
+		rel := strings.TrimPrefix(strings.TrimPrefix(pkg, s.module), "/")
+		candidates = append(candidates, filepath.Join(s.root, filepath.FromSlash(rel), filepath.Base(frame.File)))
+	}
+	if rest, ok := strings.CutPrefix(slashed, s.module+"/"); ok {
+		candidates = append(candidates, filepath.Join(s.root, filepath.FromSlash(rest)))
+	}
+	parts := strings.Split(slashed, "/")
+	for i := 1; i < len(parts); i++ {
+		candidates = append(candidates, filepath.Join(s.root, filepath.FromSlash(strings.Join(parts[i:], "/"))))
+	}
+
+	absRoot, _ := filepath.Abs(s.root)
+	for _, candidate := range candidates {
+		abs, err := filepath.Abs(candidate)
+		if err != nil || !within(abs, absRoot) {
+			continue
+		}
+		if info, err := os.Stat(abs); err == nil && !info.IsDir() {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// load parses a local file once.
+func (s *traceSource) load(filePath string) (*tracedFile, error) {
+	if file, ok := s.files[filePath]; ok {
+		return file, nil
+	}
+	src, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(s.root, filePath)
+	if err != nil {
+		return nil, err
+	}
+	file := &tracedFile{Path: filepath.ToSlash(rel)}
+	err = fileSymbols(filePath, src, func(name, kind string, node ast.Node, doc *ast.CommentGroup, fset *token.FileSet) {
+		file.symbols = append(file.symbols, declSource(fset, src, name, kind, node, doc))
+		file.nodes = append(file.nodes, node)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.files[filePath] = file
+	return file, nil
+}
+
+// enclosing returns the declaration spanning a line of a file.
+func (f *tracedFile) enclosing(line int) (symbolSource, ast.Node, bool) {
+	for i, symbol := range f.symbols {
+		if symbol.Line <= line && line <= symbol.EndLine {
+			return symbol, f.nodes[i], true
+		}
+	}
+	return symbolSource{}, nil, false
+}
+
+// markedSource returns the source of a declaration with a line marked,
+// shortened to the lines around it when the declaration is long.
+func markedSource(symbol symbolSource, line int) string {
+	lines := strings.Split(strings.TrimRight(symbol.Source, "\n"), "\n")
+	at := line - symbol.Line
+	if at >= 0 && at < len(lines) {
+		lines[at] += " // <-- here"
+	}
+	if len(lines) <= traceMaxLines {
+		return strings.Join(lines, "\n")
+	}
+	from, to := max(at-traceWindow, 0), min(at+traceWindow+1, len(lines))
+	var kept []string
+	if from > 0 {
+		kept = append(kept, lines[0], "\t// ...")
+	}
+	kept = append(kept, lines[from:to]...)
+	if to < len(lines) {
+		kept = append(kept, "\t// ...", lines[len(lines)-1])
+	}
+	return strings.Join(kept, "\n")
+}
+
+// traceType is a type of the module used by a traced function.
+type traceType struct {
+	Name string
+	File string // the local file declaring it
+}
+
+// signatureTypes returns the unqualified type names in the receiver,
+// parameters and results of a function.
+func signatureTypes(node ast.Node) []string {
+	fn, ok := node.(*ast.FuncDecl)
+	if !ok {
+		return nil
+	}
+	var fields []*ast.Field
+	for _, list := range []*ast.FieldList{fn.Recv, fn.Type.Params, fn.Type.Results} {
+		if list != nil {
+			fields = append(fields, list.List...)
+		}
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		ast.Inspect(field.Type, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				// Types of other packages are not described.
+				return false
+			case *ast.Ident:
+				if !seen[n.Name] && types.Universe.Lookup(n.Name) == nil {
+					seen[n.Name] = true
+					names = append(names, n.Name)
+				}
+			}
+			return true
+		})
+	}
+	return names
+}
+
+// render writes the dump as markdown.
+func (s *traceSource) render(dump *goroutineDump) string {
+	var b strings.Builder
+	b.WriteString("# Trace\n")
+	if dump.Header != "" {
+		fmt.Fprintf(&b, "\n```\n%s\n```\n", dump.Header)
+	}
+
+	var involved []traceType
+	seenTypes := make(map[traceType]bool)
+	var other []string
+	for _, g := range dump.Goroutines {
+		var section strings.Builder
+		inModule := false
+		var outside []traceFrame
+		flush := func() {
+			if len(outside) == 0 {
+				return
+			}
+			fmt.Fprintf(&section, "\n_%s outside the module: %s_\n", plural(len(outside), "frame"), framePackages(outside))
+			outside = nil
+		}
+
+		for i, frame := range g.Frames {
+			local := s.locate(frame)
+			if local == "" {
+				outside = append(outside, frame)
+				continue
+			}
+			file, err := s.load(local)
+			if err != nil {
+				outside = append(outside, frame)
+				continue
+			}
+			flush()
+			inModule = true
+
+			title := fmt.Sprintf("`%s`", frame.Func)
+			if frame.Created {
+				title = "created by " + title
+			}
+			fmt.Fprintf(&section, "\n### %d. %s at %s:%d\n\n", i+1, title, file.Path, frame.Line)
+			symbol, node, ok := file.enclosing(frame.Line)
+			if !ok {
+				fmt.Fprintf(&section, "Line %d is not inside a declaration; the source may have changed since the binary was built.\n", frame.Line)
+				continue
+			}
+			if symbol.Name != frameDeclName(frame.Func) {
+				fmt.Fprintf(&section, "Line %d is inside %s, not %s; the source may have changed since the binary was built.\n\n", frame.Line, symbol.Name, frameDeclName(frame.Func))
+			}
+			section.WriteString(codeFence(markedSource(symbol, frame.Line)))
+			for _, name := range signatureTypes(node) {
+				if declared := s.typeFile(filepath.Dir(local), name); declared != "" {
+					typ := traceType{Name: name, File: declared}
+					if !seenTypes[typ] {
+						seenTypes[typ] = true
+						involved = append(involved, typ)
+					}
+				}
+			}
+		}
+		flush()
+
+		ids := make([]string, len(g.IDs))
+		for i, id := range g.IDs {
+			ids[i] = strconv.Itoa(id)
+		}
+		if !inModule {
+			other = append(other, ids...)
+			continue
+		}
+		label := "Goroutine"
+		if len(ids) > 1 {
+			label = "Goroutines"
+		}
+		fmt.Fprintf(&b, "\n## %s %s [%s]\n", label, strings.Join(ids, ", "), g.State)
+		b.WriteString(section.String())
+	}
+
+	if len(other) > 0 {
+		fmt.Fprintf(&b, "\n## Other goroutines\n\n%s without frames in the module: %s.\n", plural(len(other), "goroutine"), strings.Join(other, ", "))
+	}
+	if len(involved) > 0 {
+		b.WriteString("\n## Types\n\n")
+		for _, typ := range involved {
+			b.WriteString(s.describeType(typ))
+		}
+	}
+	return b.String()
+}
+
+// typeFile returns the file of the package in dir declaring a type, or "".
+func (s *traceSource) typeFile(dir, name string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") || strings.HasSuffix(entry.Name(), "_test.go") {
+			continue
+		}
+		filePath := filepath.Join(dir, entry.Name())
+		file, err := s.load(filePath)
+		if err != nil {
+			continue
+		}
+		for _, symbol := range file.symbols {
+			if symbol.Kind == "type" && symbol.Name == name {
+				return filePath
+			}
+		}
+	}
+	return ""
+}
+
+// describeType summarizes a type as describe does: the fields of structs,
+// the methods of interfaces, and the declaration of anything else.
+func (s *traceSource) describeType(typ traceType) string {
+	file, _ := s.load(typ.File)
+	details, err := describeDetails(typ.File, describeOptions{})
+	if err == nil {
+		if fields, ok := details.Structs[typ.Name]; ok {
+			return fmt.Sprintf("- `%s` struct (%s): %s\n", typ.Name, file.Path, codeList(fields))
+		}
+		if methods, ok := details.Interfaces[typ.Name]; ok {
+			return fmt.Sprintf("- `%s` interface (%s): %s\n", typ.Name, file.Path, codeList(methods))
+		}
+	}
+	for _, symbol := range file.symbols {
+		if symbol.Kind != "type" || symbol.Name != typ.Name {
+			continue
+		}
+		// The first line after the doc comment, as a type declaration.
+		var decl string
+		for _, line := range strings.Split(symbol.Source, "\n") {
+			if !strings.HasPrefix(strings.TrimSpace(line), "//") {
+				decl = strings.TrimSpace(line)
+				break
+			}
+		}
+		if !strings.HasPrefix(decl, "type ") {
+			decl = "type " + decl
+		}
+		return fmt.Sprintf("- `%s` (%s): `%s`\n", typ.Name, file.Path, decl)
+	}
+	return ""
+}
+
+func codeList(items []string) string {
+	if len(items) == 0 {
+		return "empty"
+	}
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = "`" + item + "`"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// framePackages lists the packages of frames, in order of first appearance.
+func framePackages(frames []traceFrame) string {
+	var packages []string
+	seen := make(map[string]bool)
+	for _, frame := range frames {
+		pkg, _ := framePackage(frame.Func)
+		if !seen[pkg] {
+			seen[pkg] = true
+			packages = append(packages, pkg)
+		}
+	}
+	return strings.Join(packages, ", ")
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// traceDump comes from a binary built in /build/app.
+const traceDump = `2024/05/01 12:00:00 starting
+panic: runtime error: index out of range [5] with length 0 [recovered]
+
+goroutine 7 [running]:
+example.com/shapes.(*Square).Area(0xc000012345)
+	/build/app/shapes.go:19 +0x1d
+example.com/shapes.NewSquare(...)
+	/build/app/shapes.go:24
+net/http.HandlerFunc.ServeHTTP(0xc0000a0000?, {0x7a1e40, 0xc0000b4000}, 0xc0000c6000)
+	/usr/local/go/src/net/http/server.go:2136 +0x29
+net/http.(*conn).serve(0xc0000a2000, {0x7a2a58, 0xc0000901e0})
+	/usr/local/go/src/net/http/server.go:2039 +0x4e3
+created by example.com/shapes.Serve in goroutine 1
+	/build/app/shapes.go:25 +0x2a
+
+goroutine 1 [IO wait]:
+internal/poll.runtime_pollWait(0x7f0f3c1e0e80, 0x72)
+	/usr/local/go/src/runtime/netpoll.go:343 +0x85
+
+goroutine 9 [IO wait, 2 minutes]:
+internal/poll.runtime_pollWait(0x7f0f3c1e0e80, 0x72)
+	/usr/local/go/src/runtime/netpoll.go:343 +0x85
+`
+
+func TestParseGoroutineDump(t *testing.T) {
+	dump, err := parseGoroutineDump(strings.NewReader(traceDump))
+	if err != nil {
+		t.Fatalf("parseGoroutineDump() error = %v", err)
+	}
+	if !strings.HasSuffix(dump.Header, "length 0 [recovered]") {
+		t.Errorf("Expected the panic message in the header, but got %q", dump.Header)
+	}
+	if len(dump.Goroutines) != 2 {
+		t.Fatalf("Expected 2 distinct stacks, but got %d", len(dump.Goroutines))
+	}
+	if want := []int{1, 9}; !reflect.DeepEqual(dump.Goroutines[1].IDs, want) {
+		t.Errorf("Expected goroutines %v to share a stack, but got %v", want, dump.Goroutines[1].IDs)
+	}
+
+	want := traceFrame{Func: "example.com/shapes.Serve", File: "/build/app/shapes.go", Line: 25, Created: true}
+	frames := dump.Goroutines[0].Frames
+	if len(frames) != 5 || frames[4] != want {
+		t.Errorf("Expected 5 frames ending with %+v, but got %+v", want, frames)
+	}
+
+	if _, err := parseGoroutineDump(strings.NewReader("no dump here\n")); exitCode(err) != exitParseError {
+		t.Errorf("Expected a parse error without goroutines, but got %v", err)
+	}
+}
+
+func TestFrameDeclName(t *testing.T) {
+	testCases := map[string]string{
+		"main.main":                                   "main",
+		"main.main.func1":                             "main",
+		"example.com/app/store.(*Cache).Get":          "Cache.Get",
+		"example.com/app/store.Cache.Get.func2.1":     "Cache.Get",
+		"example.com/app/store.(*Map[...]).Load":      "Map.Load",
+		"example.com/app/store.Each.deferwrap1":       "Each",
+		"example.com/app/store.init.0":                "init",
+		"example.com/app/v2/store.(*Cache).Get.func1": "Cache.Get",
+	}
+	for fn, want := range testCases {
+		if got := frameDeclName(fn); got != want {
+			t.Errorf("frameDeclName(%q): expected %s, but got %s", fn, want, got)
+		}
+	}
+}
+
+func TestTraceRender(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":    "module example.com/shapes\n\ngo 1.21\n",
+		"shapes.go": symbolsFixture,
+	})
+	dump, err := parseGoroutineDump(strings.NewReader(traceDump))
+	if err != nil {
+		t.Fatalf("parseGoroutineDump() error = %v", err)
+	}
+
+	doc := newTraceSource(dir, "example.com/shapes").render(dump)
+	for _, want := range []string{
+		"```\n2024/05/01 12:00:00 starting\npanic: runtime error",
+		"## Goroutine 7 [running]\n\n### 1. `example.com/shapes.(*Square).Area` at shapes.go:19\n",
+		"\treturn Area(s.Side * s.Side) // <-- here\n",
+		"\n_2 frames outside the module: net/http_\n",
+		"### 5. created by `example.com/shapes.Serve` at shapes.go:25\n\nLine 25 is inside NewSquare, not Serve; the source may have changed",
+		"## Other goroutines\n\n2 goroutines without frames in the module: 1, 9.\n",
+		"## Types\n\n- `Square` struct (shapes.go): `Side float64`\n",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("Expected the trace to contain %q:\n%s", want, doc)
+		}
+	}
+}
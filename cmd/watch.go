@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fileStamp is what the poller compares between two scans of the tree.
+type fileStamp struct {
+	ModTime time.Time
+	Size    int64
+}
+
+// fileChange reports a file that was added, modified or removed between scans.
+type fileChange struct {
+	Path    string
+	Removed bool
+}
+
+// symbolEvent is one line of the incremental watch stream.
+type symbolEvent struct {
+	Event  string // added, removed or changed
+	File   string
+	Kind   string // import, struct, interface or func
+	Symbol string
+	Detail string `json:",omitempty"`
+}
+
+// fileRemoval is emitted in full watch mode when a described file disappears.
+type fileRemoval struct {
+	FilePath string
+	Removed  bool
+}
+
+// scanTree records the stamp of every Go file under root selected by opts.
+func scanTree(root string, opts walkOptions) (map[string]fileStamp, error) {
+	stamps := make(map[string]fileStamp)
+	err := walkGoFiles(root, opts, func(filePath string, info os.FileInfo) error {
+		stamps[filePath] = fileStamp{ModTime: info.ModTime(), Size: info.Size()}
+		return nil
+	})
+	return stamps, err
+}
+
+// changedFiles compares two scans and returns the differences sorted by path.
+func changedFiles(old, new map[string]fileStamp) []fileChange {
+	var changes []fileChange
+	for path, stamp := range new {
+		if prev, ok := old[path]; !ok || !prev.ModTime.Equal(stamp.ModTime) || prev.Size != stamp.Size {
+			changes = append(changes, fileChange{Path: path})
+		}
+	}
+	for path := range old {
+		if _, ok := new[path]; !ok {
+			changes = append(changes, fileChange{Path: path, Removed: true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// watchTree polls root every interval and calls onChange with the files that
+// changed since the previous scan. The first call reports every file as added.
+// It returns when ctx is cancelled.
+func watchTree(ctx context.Context, root string, interval time.Duration, opts walkOptions, onChange func([]fileChange)) error {
+	return pollTree(ctx, root, interval, opts, map[string]fileStamp{}, onChange)
+}
+
+// pollTree is watchTree starting from an earlier scan, so that only the files
+// changed since that scan are reported.
+func pollTree(ctx context.Context, root string, interval time.Duration, opts walkOptions, stamps map[string]fileStamp, onChange func([]fileChange)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		current, err := scanTree(root, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error scanning for changes:", err)
+		} else {
+			if changes := changedFiles(stamps, current); len(changes) > 0 {
+				onChange(changes)
+			}
+			stamps = current
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// funcKey returns the identity of a function signature produced by
+// handleFuncDecl: its receiver and name without the parameter list.
+func funcKey(sig string) string {
+	prefix := ""
+	if strings.HasPrefix(sig, "(") {
+		if i := strings.Index(sig, ")."); i >= 0 {
+			prefix, sig = sig[:i+2], sig[i+2:]
+		}
+	}
+	if i := strings.Index(sig, "("); i >= 0 {
+		sig = sig[:i]
+	}
+	return prefix + sig
+}
+
+// funcReceiverType returns the base receiver type name of a method signature
+// produced by handleFuncDecl, and false for plain functions.
+func funcReceiverType(sig string) (string, bool) {
+	recv, _, isMethod := strings.Cut(funcKey(sig), ").")
+	if !isMethod {
+		return "", false
+	}
+	recv = strings.TrimLeft(recv, "(*")
+	if i := strings.Index(recv, "["); i >= 0 {
+		recv = recv[:i]
+	}
+	return recv, true
+}
+
+// detailSymbols flattens the symbols of a file into kind -> name -> detail.
+func detailSymbols(details *FileDetails) map[string]map[string]string {
+	symbols := map[string]map[string]string{
+		"import":    {},
+		"struct":    {},
+		"interface": {},
+		"func":      {},
+	}
+	if details == nil {
+		return symbols
+	}
+	for _, imp := range details.Imports {
+		symbols["import"][imp] = ""
+	}
+	for name, fields := range details.Structs {
+		symbols["struct"][name] = strings.Join(fields, "; ")
+	}
+	for name, methods := range details.Interfaces {
+		symbols["interface"][name] = strings.Join(methods, "; ")
+	}
+	for _, sig := range details.Funcs {
+		symbols["func"][funcKey(sig)] = sig
+	}
+	return symbols
+}
+
+// diffDetails returns the symbol-level differences between two extractions
+// of the same file. A nil old means the file is new; a nil new means it was
+// removed.
+func diffDetails(filePath string, old, new *FileDetails) []symbolEvent {
+	before, after := detailSymbols(old), detailSymbols(new)
+
+	var events []symbolEvent
+	for _, kind := range []string{"import", "struct", "interface", "func"} {
+		for _, name := range sortedKeys(after[kind]) {
+			detail := after[kind][name]
+			prev, ok := before[kind][name]
+			switch {
+			case !ok:
+				events = append(events, symbolEvent{Event: "added", File: filePath, Kind: kind, Symbol: name, Detail: detail})
+			case prev != detail:
+				events = append(events, symbolEvent{Event: "changed", File: filePath, Kind: kind, Symbol: name, Detail: detail})
+			}
+		}
+		for _, name := range sortedKeys(before[kind]) {
+			if _, ok := after[kind][name]; !ok {
+				events = append(events, symbolEvent{Event: "removed", File: filePath, Kind: kind, Symbol: name})
+			}
+		}
+	}
+	return events
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// runDescribeWatch re-describes changed files until interrupted, writing one
+// JSON document per line to stdout. With events set it emits symbol-level
+// change events instead of whole file descriptions.
+func runDescribeWatch(path string, interval time.Duration, events bool, opts walkOptions, describeOpts describeOptions) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	encoder := json.NewEncoder(os.Stdout)
+	known := make(map[string]*FileDetails)
+
+	err := watchTree(ctx, path, interval, opts, func(changes []fileChange) {
+		for _, change := range changes {
+			var details *FileDetails
+			if !change.Removed {
+				var err error
+				details, err = describeDetails(change.Path, describeOpts)
+				if err != nil {
+					// Keep the last good description of a half-edited file.
+					reportFileError(change.Path, err)
+					continue
+				}
+			}
+
+			if events {
+				for _, event := range diffDetails(change.Path, known[change.Path], details) {
+					encoder.Encode(event)
+				}
+			} else if change.Removed {
+				encoder.Encode(fileRemoval{FilePath: change.Path, Removed: true})
+			} else {
+				encoder.Encode(details)
+			}
+
+			if change.Removed {
+				delete(known, change.Path)
+			} else {
+				known[change.Path] = details
+			}
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("watching: %w", err)
+	}
+	return nil
+}
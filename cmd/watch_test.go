@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFuncKey(t *testing.T) {
+	// Define a table of test cases
+	testCases := []struct {
+		name  string
+		input string // A signature as produced by handleFuncDecl
+		want  string
+	}{
+		{
+			name:  "Test with a plain function",
+			input: "MyFunc(param1 int, param2 string) returns (result bool)",
+			want:  "MyFunc",
+		},
+		{
+			name:  "Test with a pointer receiver",
+			input: "(*extractCache).load(filePath string, hash string) returns (*FileDetails, bool)",
+			want:  "(*extractCache).load",
+		},
+		{
+			name:  "Test with a function without parameters",
+			input: "mainTest()",
+			want:  "mainTest",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if got := funcKey(testCase.input); got != testCase.want {
+				t.Errorf("funcKey() = %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestDiffDetails(t *testing.T) {
+	base := &FileDetails{
+		Imports: []string{"fmt"},
+		Structs: map[string][]string{"MyStruct": {"Field1 int"}},
+		Funcs:   []string{"MyFunc(param1 int)", "mainTest()"},
+	}
+
+	// Define a table of test cases
+	testCases := []struct {
+		name string
+		old  *FileDetails
+		new  *FileDetails
+		want []symbolEvent
+	}{
+		{
+			name: "Test with a new file",
+			old:  nil,
+			new:  &FileDetails{Imports: []string{"fmt"}, Funcs: []string{"mainTest()"}},
+			want: []symbolEvent{
+				{Event: "added", File: "f.go", Kind: "import", Symbol: "fmt"},
+				{Event: "added", File: "f.go", Kind: "func", Symbol: "mainTest", Detail: "mainTest()"},
+			},
+		},
+		{
+			name: "Test with changed, added and removed symbols",
+			old:  base,
+			new: &FileDetails{
+				Imports: []string{"fmt", "os"},
+				Structs: map[string][]string{"MyStruct": {"Field1 int", "Field2 string"}},
+				Funcs:   []string{"MyFunc(param1 int, param2 string)"},
+			},
+			want: []symbolEvent{
+				{Event: "added", File: "f.go", Kind: "import", Symbol: "os"},
+				{Event: "changed", File: "f.go", Kind: "struct", Symbol: "MyStruct", Detail: "Field1 int; Field2 string"},
+				{Event: "changed", File: "f.go", Kind: "func", Symbol: "MyFunc", Detail: "MyFunc(param1 int, param2 string)"},
+				{Event: "removed", File: "f.go", Kind: "func", Symbol: "mainTest"},
+			},
+		},
+		{
+			name: "Test with an unchanged file",
+			old:  base,
+			new:  base,
+			want: nil,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			got := diffDetails("f.go", testCase.old, testCase.new)
+			if !reflect.DeepEqual(got, testCase.want) {
+				t.Errorf("diffDetails() = %+v, want %+v", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	now := time.Now()
+	old := map[string]fileStamp{
+		"a.go": {ModTime: now, Size: 10},
+		"b.go": {ModTime: now, Size: 10},
+		"c.go": {ModTime: now, Size: 10},
+	}
+	new := map[string]fileStamp{
+		"a.go": {ModTime: now, Size: 10},
+		"b.go": {ModTime: now.Add(time.Second), Size: 10},
+		"d.go": {ModTime: now, Size: 1},
+	}
+
+	want := []fileChange{
+		{Path: "b.go"},
+		{Path: "c.go", Removed: true},
+		{Path: "d.go"},
+	}
+	if got := changedFiles(old, new); !reflect.DeepEqual(got, want) {
+		t.Errorf("changedFiles() = %+v, want %+v", got, want)
+	}
+}